@@ -0,0 +1,397 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Các môi trường được hỗ trợ
+const (
+	EnvDev  = "dev"
+	EnvQC   = "qc"
+	EnvProd = "prod"
+)
+
+// Độ dài tối thiểu của khóa ký token ở prod
+const minProdSecretLength = 32
+
+// Secret là giá trị bí mật: in ra log hoặc JSON đều bị che, chỉ lấy giá trị thật qua Value()
+type Secret string
+
+func (s Secret) Value() string { return string(s) }
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "******"
+}
+
+func (s Secret) GoString() string { return strconv.Quote(s.String()) }
+
+func (s Secret) MarshalJSON() ([]byte, error) { return json.Marshal(s.String()) }
+
+type DatabaseConfig struct {
+	Host     string
+	Port     string
+	User     string
+	Password Secret
+	Name     string
+	SSLMode  string
+	TimeZone string
+}
+
+func (d DatabaseConfig) dsn(password string) string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=%s",
+		d.Host, d.User, password, d.Name, d.Port, d.SSLMode, d.TimeZone)
+}
+
+// DSN là chuỗi kết nối đầy đủ, không được ghi ra log
+func (d DatabaseConfig) DSN() string { return d.dsn(d.Password.Value()) }
+
+// RedactedDSN là chuỗi kết nối đã che mật khẩu, dùng cho log
+func (d DatabaseConfig) RedactedDSN() string { return d.dsn(d.Password.String()) }
+
+type RedisConfig struct {
+	Addr     string
+	Username string
+	Password Secret
+	DB       int
+}
+
+type JWTConfig struct {
+	AccessSecret        Secret
+	AccessKID           string
+	AccessPreviousKeys  Secret // "kid:secret,kid:secret", các khóa cũ còn được chấp nhận khi xoay vòng
+	RefreshSecret       Secret
+	RefreshKID          string
+	RefreshPreviousKeys Secret
+}
+
+type SecurityConfig struct {
+	OTPSecret              Secret
+	TOTPEncryptionKey      Secret
+	TOTPIssuer             string
+	TwoFactorRequiredRoles []int
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password Secret
+	From     string
+}
+
+// Configured cho biết đã có thông tin đăng nhập SMTP để gửi mail
+func (s SMTPConfig) Configured() bool {
+	return s.Username != "" && s.Password != ""
+}
+
+const (
+	MailBackendSMTP   = "smtp"
+	MailBackendFile   = "file"
+	MailBackendMemory = "memory"
+)
+
+// MailConfig chọn nơi gửi email: smtp (mặc định), file (ghi vào file mbox FilePath) hoặc memory.
+// Email trong hàng đợi được thử lại tối đa MaxAttempts lần, lần thử thứ n chờ RetryBaseSeconds*2^(n-1) giây.
+type MailConfig struct {
+	Backend          string
+	FilePath         string
+	MaxAttempts      int
+	RetryBaseSeconds int
+}
+
+type CloudinaryConfig struct {
+	CloudName string
+	APIKey    string
+	APISecret Secret
+}
+
+type PaymentConfig struct {
+	VNPayTmnCode    string
+	VNPayHashSecret Secret
+	VNPayPayURL     string
+	FakeSecret      Secret // Cổng giả lập, chỉ đăng ký khi đặt PAYMENT_FAKE_SECRET; không dùng ở prod
+}
+
+// PayoutConfig là tài khoản nhận phí thường niên của hệ thống (hiển thị và tạo mã VietQR)
+type PayoutConfig struct {
+	BankCode      string
+	AccountNumber string
+}
+
+type BookingConfig struct {
+	HoldMinutes int
+}
+
+type IntegrationConfig struct {
+	MapboxKey      Secret
+	GoogleClientID string
+}
+
+// AppConfig là toàn bộ cấu hình của ứng dụng, nạp một lần khi khởi động bằng Load
+type AppConfig struct {
+	Env         string
+	Port        string
+	FrontendURL string
+	BackendURL  string
+	// WebSocketOrigins là các Origin được mở /ws từ trình duyệt (mặc định chỉ FrontendURL)
+	WebSocketOrigins []string
+	// TrustedProxies là IP/CIDR của reverse proxy được tin header X-Forwarded-For; rỗng: dùng IP kết nối trực tiếp
+	TrustedProxies []string
+
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	JWT         JWTConfig
+	Security    SecurityConfig
+	SMTP        SMTPConfig
+	Mail        MailConfig
+	Cloudinary  CloudinaryConfig
+	Payment     PaymentConfig
+	Payout      PayoutConfig
+	Booking     BookingConfig
+	Integration IntegrationConfig
+}
+
+func (c *AppConfig) IsProd() bool { return c.Env == EnvProd }
+
+// Summary tóm tắt cấu hình cho log khi khởi động; các giá trị bí mật đã được che
+func (c *AppConfig) Summary() string {
+	return fmt.Sprintf("env=%s port=%s db=%q redis=%s mail=%s smtp=%s@%s:%d cloudinary=%s payout=%s-%s",
+		c.Env, c.Port, c.Database.RedactedDSN(), c.Redis.Addr, c.Mail.Backend,
+		c.SMTP.Username, c.SMTP.Host, c.SMTP.Port, c.Cloudinary.CloudName,
+		c.Payout.BankCode, c.Payout.AccountNumber)
+}
+
+// loaded là cấu hình đã nạp, dùng cho các hàm kết nối gọi lại nhiều lần như ConnectRedis
+var loaded *AppConfig
+
+// envReader đọc biến môi trường và gom mọi lỗi lại để báo một lần
+type envReader struct {
+	problems []string
+}
+
+func (r *envReader) str(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (r *envReader) required(key string) string {
+	value := r.str(key, "")
+	if value == "" {
+		r.problems = append(r.problems, "thiếu "+key)
+	}
+	return value
+}
+
+func (r *envReader) secret(key string, required bool) Secret {
+	if required {
+		return Secret(r.required(key))
+	}
+	return Secret(r.str(key, ""))
+}
+
+func (r *envReader) integer(key string, fallback int) int {
+	value := r.str(key, "")
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		r.problems = append(r.problems, fmt.Sprintf("%s không hợp lệ: %q", key, value))
+		return fallback
+	}
+	return n
+}
+
+func (r *envReader) strList(key string) []string {
+	var values []string
+	for _, part := range strings.Split(r.str(key, ""), ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+func (r *envReader) intList(key string) []int {
+	var values []int
+	for _, part := range strings.Split(r.str(key, ""), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			r.problems = append(r.problems, fmt.Sprintf("%s không hợp lệ: %q", key, part))
+			continue
+		}
+		values = append(values, n)
+	}
+	return values
+}
+
+// loadEnvFiles nạp CONFIG_FILE (nếu có) rồi .env. Biến môi trường thật luôn được ưu tiên,
+// sau đó tới CONFIG_FILE, cuối cùng là .env.
+func loadEnvFiles() error {
+	if file := os.Getenv("CONFIG_FILE"); file != "" {
+		if err := godotenv.Load(file); err != nil {
+			return fmt.Errorf("không thể đọc CONFIG_FILE %s: %w", file, err)
+		}
+	}
+	if _, err := os.Stat(".env"); err == nil {
+		if err := godotenv.Load(); err != nil {
+			return fmt.Errorf("không thể đọc .env: %w", err)
+		}
+	}
+	return nil
+}
+
+// Load đọc cấu hình từ biến môi trường / CONFIG_FILE / .env theo môi trường ENV (dev, qc, prod, bắt buộc).
+// Thiếu hoặc sai giá trị bắt buộc thì trả về lỗi liệt kê tất cả, ứng dụng không được khởi động.
+func Load() (*AppConfig, error) {
+	if err := loadEnvFiles(); err != nil {
+		return nil, err
+	}
+
+	r := &envReader{}
+	cfg := &AppConfig{Env: strings.ToLower(r.str("ENV", ""))}
+	switch cfg.Env {
+	case "":
+		return nil, errors.New("thiếu ENV (dev, qc hoặc prod)")
+	case EnvDev, EnvQC, EnvProd:
+	default:
+		return nil, fmt.Errorf("ENV không hợp lệ: %q (dev, qc hoặc prod)", cfg.Env)
+	}
+	strict := cfg.Env != EnvDev
+
+	cfg.Port = r.str("PORT", "8083")
+	cfg.FrontendURL = strings.TrimRight(r.str("FRONTEND_URL", "https://trothalo.click"), "/")
+	cfg.BackendURL = strings.TrimRight(r.str("BACKEND_URL", "https://backend.trothalo.click"), "/")
+	cfg.TrustedProxies = r.strList("TRUSTED_PROXIES")
+	cfg.WebSocketOrigins = r.strList("WS_ALLOWED_ORIGINS")
+	if len(cfg.WebSocketOrigins) == 0 {
+		cfg.WebSocketOrigins = []string{cfg.FrontendURL}
+	}
+
+	// Mỗi môi trường có bộ biến DB riêng: DEV_DB_*, QC_DB_*, PROD_DB_*
+	dbPrefix := strings.ToUpper(cfg.Env) + "_DB_"
+	cfg.Database = DatabaseConfig{
+		Host:     r.required(dbPrefix + "HOST"),
+		Port:     r.str(dbPrefix+"PORT", "5432"),
+		User:     r.required(dbPrefix + "USER"),
+		Password: r.secret(dbPrefix+"PASSWORD", true),
+		Name:     r.required(dbPrefix + "NAME"),
+		SSLMode:  r.str(dbPrefix+"SSLMODE", "require"),
+		TimeZone: r.str("DB_TIMEZONE", "Asia/Ho_Chi_Minh"),
+	}
+
+	cfg.Redis = RedisConfig{
+		Addr:     r.required("REDIS_ADDR"),
+		Username: r.str("REDIS_USER", ""),
+		Password: r.secret("REDIS_PASSWORD", false),
+	}
+
+	cfg.JWT = JWTConfig{
+		AccessSecret:        r.secret("SECRET_KEY_ACCESS_TOKEN", true),
+		AccessKID:           r.str("JWT_ACCESS_KID", "default"),
+		AccessPreviousKeys:  r.secret("JWT_ACCESS_PREVIOUS_KEYS", false),
+		RefreshSecret:       r.secret("SECRET_KEY_REFRESH_TOKEN", true),
+		RefreshKID:          r.str("JWT_REFRESH_KID", "default"),
+		RefreshPreviousKeys: r.secret("JWT_REFRESH_PREVIOUS_KEYS", false),
+	}
+
+	// Ở dev/qc các khóa OTP/TOTP mặc định dùng lại khóa access token; prod bắt buộc khóa riêng
+	cfg.Security = SecurityConfig{
+		OTPSecret:              r.secret("OTP_SECRET", cfg.IsProd()),
+		TOTPEncryptionKey:      r.secret("TOTP_ENCRYPTION_KEY", cfg.IsProd()),
+		TOTPIssuer:             r.str("TOTP_ISSUER", "Trothalo"),
+		TwoFactorRequiredRoles: r.intList("TWO_FACTOR_REQUIRED_ROLES"),
+	}
+	if cfg.Security.OTPSecret == "" {
+		cfg.Security.OTPSecret = cfg.JWT.AccessSecret
+	}
+	if cfg.Security.TOTPEncryptionKey == "" {
+		cfg.Security.TOTPEncryptionKey = cfg.JWT.AccessSecret
+	}
+
+	cfg.Mail = MailConfig{
+		Backend:          strings.ToLower(r.str("MAIL_BACKEND", MailBackendSMTP)),
+		FilePath:         r.str("MAIL_FILE_PATH", "mail.mbox"),
+		MaxAttempts:      r.integer("MAIL_MAX_ATTEMPTS", 8),
+		RetryBaseSeconds: r.integer("MAIL_RETRY_BASE_SECONDS", 30),
+	}
+	switch cfg.Mail.Backend {
+	case MailBackendSMTP, MailBackendFile, MailBackendMemory:
+	default:
+		r.problems = append(r.problems, fmt.Sprintf("MAIL_BACKEND không hợp lệ: %q (smtp, file hoặc memory)", cfg.Mail.Backend))
+	}
+
+	// Chỉ bắt buộc tài khoản SMTP khi thực sự gửi mail qua SMTP
+	requireSMTP := strict && cfg.Mail.Backend == MailBackendSMTP
+	cfg.SMTP = SMTPConfig{
+		Host:     r.str("SMTP_HOST", "smtp.gmail.com"),
+		Port:     r.integer("SMTP_PORT", 587),
+		Username: r.str("SMTP_USERNAME", ""),
+		Password: r.secret("SMTP_PASSWORD", requireSMTP),
+	}
+	if requireSMTP && cfg.SMTP.Username == "" {
+		r.problems = append(r.problems, "thiếu SMTP_USERNAME")
+	}
+	cfg.SMTP.From = r.str("SMTP_FROM", cfg.SMTP.Username)
+
+	cfg.Cloudinary = CloudinaryConfig{
+		CloudName: r.required("CLOUDINARY_CLOUD_NAME"),
+		APIKey:    r.required("CLOUDINARY_API_KEY"),
+		APISecret: r.secret("CLOUDINARY_API_SECRET", true),
+	}
+
+	cfg.Payment = PaymentConfig{
+		VNPayTmnCode:    r.str("VNPAY_TMN_CODE", ""),
+		VNPayHashSecret: r.secret("VNPAY_HASH_SECRET", false),
+		VNPayPayURL:     r.str("VNPAY_PAY_URL", "https://sandbox.vnpayment.vn/paymentv2/vpcpay.html"),
+		FakeSecret:      r.secret("PAYMENT_FAKE_SECRET", false),
+	}
+	if cfg.Payment.FakeSecret != "" && cfg.IsProd() {
+		r.problems = append(r.problems, "PAYMENT_FAKE_SECRET không được đặt ở prod")
+	}
+
+	if strict {
+		cfg.Payout = PayoutConfig{BankCode: r.required("PAYOUT_BANK_CODE"), AccountNumber: r.required("PAYOUT_ACCOUNT_NUMBER")}
+	} else {
+		cfg.Payout = PayoutConfig{BankCode: r.str("PAYOUT_BANK_CODE", ""), AccountNumber: r.str("PAYOUT_ACCOUNT_NUMBER", "")}
+	}
+
+	cfg.Booking = BookingConfig{HoldMinutes: r.integer("BOOKING_HOLD_MINUTES", 15)}
+
+	cfg.Integration = IntegrationConfig{
+		MapboxKey:      r.secret("MAPBOX_KEY", strict),
+		GoogleClientID: r.str("GOOGLE_CLIENT_ID", ""),
+	}
+
+	if cfg.IsProd() {
+		if len(cfg.JWT.AccessSecret) > 0 && len(cfg.JWT.AccessSecret) < minProdSecretLength {
+			r.problems = append(r.problems, fmt.Sprintf("SECRET_KEY_ACCESS_TOKEN phải dài ít nhất %d ký tự", minProdSecretLength))
+		}
+		if len(cfg.JWT.RefreshSecret) > 0 && len(cfg.JWT.RefreshSecret) < minProdSecretLength {
+			r.problems = append(r.problems, fmt.Sprintf("SECRET_KEY_REFRESH_TOKEN phải dài ít nhất %d ký tự", minProdSecretLength))
+		}
+	}
+
+	if len(r.problems) > 0 {
+		return nil, errors.New("cấu hình không hợp lệ: " + strings.Join(r.problems, "; "))
+	}
+
+	loaded = cfg
+	return cfg, nil
+}
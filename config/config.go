@@ -2,31 +2,16 @@ package config
 
 import (
 	"log"
-	"os"
 
 	"github.com/cloudinary/cloudinary-go/v2"
-	"github.com/joho/godotenv"
 )
 
 var Cloudinary *cloudinary.Cloudinary
 
-func ConnectCloudinary() {
+func ConnectCloudinary(cfg CloudinaryConfig) {
 	var err error
-	Cloudinary, err = cloudinary.NewFromParams("dqipg0or3", "921786437263773", "cK1ylPWzyoC4bTWWtahq0QDVZUw")
+	Cloudinary, err = cloudinary.NewFromParams(cfg.CloudName, cfg.APIKey, cfg.APISecret.Value())
 	if err != nil {
 		log.Fatalf("Lỗi khi khởi tạo Cloudinary: %v", err)
 	}
 }
-
-func LoadEnv() error {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatalf("Error loading .env file")
-	}
-
-	return err
-}
-
-func GetEnv(key string) string {
-	return os.Getenv(key)
-}
@@ -11,7 +11,6 @@ import (
 	"new/config"
 	"new/models"
 	"new/services"
-	"os"
 	"regexp"
 	"sort"
 	"strconv"
@@ -47,6 +46,7 @@ type AccommodationRequest struct {
 	Benefits         []models.Benefit `json:"benefits" gorm:"many2many:accommodation_benefits;"`
 	People           int              `json:"people"`
 	Price            int              `json:"price"`
+	WeekendPrice     *int             `json:"weekendPrice"`
 	TimeCheckOut     string           `json:"timeCheckOut"`
 	TimeCheckIn      string           `json:"timeCheckIn"`
 	Province         string           `json:"province"`
@@ -122,6 +122,7 @@ type AccommodationDetailResponse struct {
 	Num              int              `json:"num"`
 	People           int              `json:"people"`
 	Price            int              `json:"price"`
+	WeekendPrice     int              `json:"weekendPrice"`
 	NumBed           int              `json:"numBed"`
 	NumTolet         int              `json:"numTolet"`
 	Furniture        json.RawMessage  `json:"furniture" gorm:"type:json"`
@@ -172,8 +173,14 @@ func filterAccommodationStatusesByDate(statuses []models.AccommodationStatus, fr
 	var filteredStatuses []models.AccommodationStatus
 	fromDate = fromDate.Truncate(24 * time.Hour)
 	toDate = toDate.Truncate(24 * time.Hour)
+	now := time.Now()
 
 	for _, status := range statuses {
+		// Giữ chỗ đã quá hạn nhưng cron chưa kịp nhả thì không tính là đã kín
+		if !status.IsActive(now) {
+			continue
+		}
+
 		// Chuẩn hóa thời gian để tránh sai lệch múi giờ
 		statusFromDate := status.FromDate.Truncate(24 * time.Hour)
 		statusToDate := status.ToDate.Truncate(24 * time.Hour)
@@ -229,7 +236,25 @@ func GetAccBookingDates(c *gin.Context) {
 		return
 	}
 
+	// Lấy giá từng đêm trong tháng theo lịch giá
+	var accommodation models.Accommodation
+	if err := db.First(&accommodation, accommodationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chỗ ở không tồn tại"})
+		return
+	}
+	nightlyPrices, err := services.NightlyPrices(db, services.AccommodationRateTarget(accommodation), firstDay, lastDay.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Error retrieving nightly prices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi khi lấy lịch giá chỗ ở"})
+		return
+	}
+	priceMap := make(map[string]int)
+	for _, night := range nightlyPrices {
+		priceMap[night.Date] = night.Price
+	}
+
 	dateFormat := "02/01/2006"
+	now := time.Now()
 	var roomResponses []map[string]interface{}
 
 	for _, currentDate := range allDates {
@@ -238,6 +263,9 @@ func GetAccBookingDates(c *gin.Context) {
 		var status int
 
 		for _, accStatus := range statuses {
+			if !accStatus.IsActive(now) {
+				continue
+			}
 			if currentDate.After(accStatus.FromDate.AddDate(0, 0, -1)) && currentDate.Before(accStatus.ToDate) {
 				status = accStatus.Status
 				statusFound = true
@@ -252,6 +280,7 @@ func GetAccBookingDates(c *gin.Context) {
 		roomResponse := map[string]interface{}{
 			"date":   dateStr,
 			"status": status,
+			"price":  priceMap[dateStr],
 		}
 
 		// Nếu có khách đặt phòng, gán vào response (dạng object)
@@ -331,16 +360,9 @@ func getGuestBookings(accommodationID string) (map[string]map[string]string, err
 }
 
 func GetAllAccommodations(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -375,13 +397,8 @@ func GetAllAccommodations(c *gin.Context) {
 			//Lấy data theo vai trò Admin (Role = 2)
 			tx = tx.Where("user_id = ?", currentUserID)
 		} else if currentUserRole == 3 {
-			//Lấy data theo vai trò Receptionist (Role = 3)
-			var adminID int
-			if err := config.DB.Model(&models.User{}).Select("admin_id").Where("id = ?", currentUserID).Scan(&adminID).Error; err != nil {
-				c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
-				return
-			}
-			tx = tx.Where("user_id = ?", adminID)
+			//Lấy data theo vai trò Receptionist (Role = 3): các chỗ ở được giao
+			tx = tx.Where("id IN (?)", services.PermittedAccommodations(currentUserID, services.PermAccommodationView))
 		}
 
 		// Lấy dữ liệu từ DB
@@ -1119,16 +1136,9 @@ func normalizeBenefitName(name string) string {
 }
 
 func CreateAccommodation(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 	var newAccommodation models.Accommodation
@@ -1158,6 +1168,12 @@ func CreateAccommodation(c *gin.Context) {
 		return
 	}
 
+	// weekendPrice được nhận ngay khi tạo, 0 = dùng Price cho cả cuối tuần
+	if newAccommodation.WeekendPrice < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Giá cuối tuần không hợp lệ"})
+		return
+	}
+
 	imgJSON, err := json.Marshal(newAccommodation.Img)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể mã hóa hình ảnh", "details": err.Error()})
@@ -1193,7 +1209,7 @@ func CreateAccommodation(c *gin.Context) {
 		newAccommodation.District,
 		newAccommodation.Province,
 		newAccommodation.Ward,
-		os.Getenv("MAPBOX_KEY"),
+		integrationConfig.MapboxKey.Value(),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "message": "Không thể mã hóa địa chỉ", "details": err.Error()})
@@ -1256,6 +1272,7 @@ func CreateAccommodation(c *gin.Context) {
 		Furniture:        newAccommodation.Furniture,
 		People:           newAccommodation.People,
 		Price:            newAccommodation.Price,
+		WeekendPrice:     newAccommodation.WeekendPrice,
 		NumBed:           newAccommodation.NumBed,
 		NumTolet:         newAccommodation.NumTolet,
 		Benefits:         newAccommodation.Benefits,
@@ -1317,6 +1334,7 @@ func GetAccommodationDetail(c *gin.Context) {
 					Num:              acc.Num,
 					People:           acc.People,
 					Price:            price,
+					WeekendPrice:     acc.WeekendPrice,
 					NumBed:           acc.NumBed,
 					NumTolet:         acc.NumTolet,
 					Furniture:        acc.Furniture,
@@ -1382,6 +1400,7 @@ func GetAccommodationDetail(c *gin.Context) {
 		Num:              accommodation.Num,
 		People:           accommodation.People,
 		Price:            price,
+		WeekendPrice:     accommodation.WeekendPrice,
 		NumBed:           accommodation.NumBed,
 		NumTolet:         accommodation.NumTolet,
 		Furniture:        accommodation.Furniture,
@@ -1409,16 +1428,9 @@ func GetAccommodationDetail(c *gin.Context) {
 
 func UpdateAccommodation(c *gin.Context) {
 	var request AccommodationRequest
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -1451,7 +1463,7 @@ func UpdateAccommodation(c *gin.Context) {
 		request.District,
 		request.Province,
 		request.Ward,
-		os.Getenv("MAPBOX_KEY"),
+		integrationConfig.MapboxKey.Value(),
 	)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "message": "Không thể mã hóa địa chỉ", "details": err.Error()})
@@ -1470,6 +1482,13 @@ func UpdateAccommodation(c *gin.Context) {
 	if request.Price != -1 {
 		accommodation.Price = request.Price
 	}
+	if request.WeekendPrice != nil {
+		if *request.WeekendPrice < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Giá cuối tuần không hợp lệ"})
+			return
+		}
+		accommodation.WeekendPrice = *request.WeekendPrice
+	}
 	if request.Avatar != "" {
 		accommodation.Avatar = request.Avatar
 	}
@@ -1594,6 +1613,7 @@ func UpdateAccommodation(c *gin.Context) {
 		Num:              accommodation.Num,
 		Furniture:        accommodation.Furniture,
 		People:           accommodation.People,
+		WeekendPrice:     accommodation.WeekendPrice,
 		NumBed:           accommodation.NumBed,
 		NumTolet:         accommodation.NumTolet,
 		Benefits:         benefits,
@@ -1607,16 +1627,9 @@ func UpdateAccommodation(c *gin.Context) {
 }
 
 func ChangeAccommodationStatus(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
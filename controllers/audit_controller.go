@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// filterAuditLogs áp dụng bộ lọc chung từ query: actorId, action, entityType, entityId, accommodationId, fromDate, toDate (dd/mm/yyyy)
+func filterAuditLogs(c *gin.Context, query *gorm.DB) (*gorm.DB, bool) {
+	for param, column := range map[string]string{
+		"actorId":         "actor_id",
+		"entityId":        "entity_id",
+		"accommodationId": "accommodation_id",
+	} {
+		if value := c.Query(param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": param + " không hợp lệ"})
+				return nil, false
+			}
+			query = query.Where(column+" = ?", id)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if entityType := c.Query("entityType"); entityType != "" {
+		query = query.Where("entity_type = ?", entityType)
+	}
+
+	if fromDateStr := c.Query("fromDate"); fromDateStr != "" {
+		fromDate, err := time.ParseInLocation("02/01/2006", fromDateStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày bắt đầu không hợp lệ"})
+			return nil, false
+		}
+		query = query.Where("created_at >= ?", fromDate)
+	}
+	if toDateStr := c.Query("toDate"); toDateStr != "" {
+		toDate, err := time.ParseInLocation("02/01/2006", toDateStr, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày kết thúc không hợp lệ"})
+			return nil, false
+		}
+		query = query.Where("created_at < ?", toDate.AddDate(0, 0, 1))
+	}
+	return query, true
+}
+
+func respondAuditLogs(c *gin.Context, query *gorm.DB) {
+	page, limit := 0, 20
+	if parsedPage, err := strconv.Atoi(c.Query("page")); err == nil && parsedPage >= 0 {
+		page = parsedPage
+	}
+	if parsedLimit, err := strconv.Atoi(c.Query("limit")); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+		limit = parsedLimit
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đếm nhật ký"})
+		return
+	}
+
+	var logs []models.AuditLog
+	if err := query.Order("id DESC").Offset(page * limit).Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy nhật ký"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"mess": "Lấy nhật ký thành công",
+		"data": logs,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetAuditLogs: superadmin xem toàn bộ nhật ký, lọc thêm theo adminId
+func GetAuditLogs(c *gin.Context) {
+	query, ok := filterAuditLogs(c, config.DB.Model(&models.AuditLog{}))
+	if !ok {
+		return
+	}
+	if value := c.Query("adminId"); value != "" {
+		adminID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "adminId không hợp lệ"})
+			return
+		}
+		query = query.Where("admin_id = ?", adminID)
+	}
+
+	respondAuditLogs(c, query)
+}
+
+// GetAdminAuditLogs: admin xem nhật ký thuộc chỗ ở của mình cùng các thay đổi trên tài khoản của mình
+// và nhân viên mình quản lý (không gắn chỗ ở); nhân viên có quyền audit.view xem nhật ký của chỗ ở được giao
+func GetAdminAuditLogs(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if !services.CanAny(currentUserID, currentUserRole, services.PermAuditView) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền truy cập"})
+		return
+	}
+
+	if value := c.Query("accommodationId"); value != "" {
+		accommodationID, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || !services.Can(currentUserID, currentUserRole, services.PermAuditView, uint(accommodationID)) {
+			c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền truy cập"})
+			return
+		}
+	}
+
+	permitted := services.PermittedAccommodations(currentUserID, services.PermAuditView)
+	query := config.DB.Model(&models.AuditLog{}).
+		Where("accommodation_id IN (?) OR (accommodation_id IS NULL AND admin_id = ?)", permitted, currentUserID)
+
+	query, ok := filterAuditLogs(c, query)
+	if !ok {
+		return
+	}
+
+	respondAuditLogs(c, query)
+}
@@ -2,19 +2,15 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"log"
 	"net/http"
 	"new/config"
 	"new/models"
 	"new/services"
-	"os"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
@@ -86,14 +82,41 @@ func Login(c *gin.Context) {
 
 	input.Identifier = strings.ToLower(input.Identifier)
 
+	// Tài khoản đang bị tạm khóa do đăng nhập sai nhiều lần
+	if lockedFor := services.LoginLockedFor(c.Request.Context(), input.Identifier); lockedFor > 0 {
+		c.Header("Retry-After", services.RetryAfterSeconds(lockedFor))
+		c.JSON(http.StatusTooManyRequests, gin.H{"code": 0, "mess": "Tài khoản tạm khóa do đăng nhập sai nhiều lần, vui lòng thử lại sau"})
+		return
+	}
+
+	loginFailed := func() {
+		if lockedFor := services.RecordLoginFailure(c.Request.Context(), input.Identifier); lockedFor > 0 {
+			c.Header("Retry-After", services.RetryAfterSeconds(lockedFor))
+			c.JSON(http.StatusTooManyRequests, gin.H{"code": 0, "mess": "Tài khoản tạm khóa do đăng nhập sai nhiều lần, vui lòng thử lại sau"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Email hoặc mật khẩu không hợp lệ"})
+	}
+
 	var user models.User
 	if err := config.DB.Preload("Banks").Where("email = ? OR phone_number = ?", input.Identifier, input.Identifier).First(&user).Error; err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Email hoặc mật khẩu không hợp lệ"})
+		loginFailed()
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Email hoặc mật khẩu không hợp lệ"})
+		loginFailed()
+		return
+	}
+
+	services.ResetLoginFailures(c.Request.Context(), input.Identifier)
+
+	if rejectBannedUser(c, user) {
+		return
+	}
+
+	// Tài khoản bật (hoặc bắt buộc) 2FA: chỉ trả về challenge, token được cấp ở VerifyTwoFactorLogin
+	if respondTwoFactorChallenge(c, user) {
 		return
 	}
 
@@ -102,12 +125,31 @@ func Login(c *gin.Context) {
 		Role:   user.Role,
 	}
 
-	accessToken, err := services.GenerateToken(userInfo, 60*24*3, true)
+	tokens, err := services.IssueTokenPair(userInfo, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đăng nhập thành công", "data": gin.H{
+		"user_info":    newUserLoginResponse(user),
+		"accessToken":  tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+	}})
+}
+
+// rejectBannedUser trả 403 nếu tài khoản đã bị khóa (Status 1); mọi luồng đăng nhập gọi trước khi
+// tạo challenge 2FA hoặc cấp token. Trả về true khi đã phản hồi.
+func rejectBannedUser(c *gin.Context, user models.User) bool {
+	if user.Status != 1 {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Tài khoản đã bị khóa"})
+	return true
+}
+
+func newUserLoginResponse(user models.User) UserLoginResponse {
 	var banks []Bank
 
 	// Nếu không, lấy Bank của user hiện tại
@@ -119,7 +161,7 @@ func Login(c *gin.Context) {
 		})
 	}
 
-	userResponse := UserLoginResponse{
+	return UserLoginResponse{
 		UserID:       user.ID,
 		UserName:     user.Name,
 		UserEmail:    user.Email,
@@ -134,14 +176,62 @@ func Login(c *gin.Context) {
 		DateOfBirth:  user.DateOfBirth,
 		Amount:       user.Amount,
 	}
+}
 
-	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đăng nhập thành công", "data": gin.H{
-		"user_info":   userResponse,
-		"accessToken": accessToken,
-	}})
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// RefreshToken đổi refresh token lấy access token mới, refresh token cũ bị xoay và không dùng lại được
+func RefreshToken(c *gin.Context) {
+	var input RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Thiếu refresh token"})
+		return
+	}
+
+	tokens, err := services.RotateRefreshToken(input.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidToken) || errors.Is(err, services.ErrExpiredToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể làm mới token", "detail": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Làm mới token thành công", "data": tokens})
 }
 
+// Logout thu hồi phiên của access token và refresh token gửi lên; all=true (kèm access token) thu hồi mọi phiên của người dùng
 func Logout(c *gin.Context) {
+	var input RefreshTokenInput
+	_ = c.ShouldBindJSON(&input)
+	if claims, err := services.AuthenticateRequest(c); err == nil {
+		if err := services.RevokeSession(claims.UserInfo.UserId, claims.SessionID, "logout", nil); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đăng xuất", "detail": err.Error()})
+			return
+		}
+	}
+	if input.RefreshToken != "" {
+		if _, err := services.RevokeRefreshToken(input.RefreshToken); err != nil && !errors.Is(err, services.ErrInvalidToken) && !errors.Is(err, services.ErrExpiredToken) {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đăng xuất", "detail": err.Error()})
+			return
+		}
+	}
+
+	if c.Query("all") == "true" {
+		currentUserID, _, err := currentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		if err := services.RevokeUserTokens(currentUserID, "logout_all"); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+	}
+
 	cookies := c.Request.Cookies()
 	for _, cookie := range cookies {
 
@@ -151,29 +241,36 @@ func Logout(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đăng xuất thành công"})
 }
 
+// otpErrorStatus: mã sai/hết hạn/quá số lần thử là lỗi của người dùng, còn lại là lỗi hệ thống
+func otpErrorStatus(err error) int {
+	if errors.Is(err, services.ErrOTPInvalid) || errors.Is(err, services.ErrOTPExpired) || errors.Is(err, services.ErrOTPTooManyAttempts) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 func VerifyEmail(c *gin.Context) {
+	email := c.Query("email")
 	code := c.Query("token")
-	if code == "" {
+	if email == "" || code == "" {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "mess": "Cần mã xác thực"})
 		return
 	}
 
 	var user models.User
-	result := config.DB.Where("code = ?", code).First(&user)
+	result := config.DB.Where("email = ?", email).First(&user)
 	if result.Error != nil {
 		c.JSON(http.StatusOK, gin.H{"code": 0, "mess": "Có lỗi xảy ra khi xác minh email", "detai": result.Error.Error()})
 		return
 	}
 
-	// Kiểm tra xem mã xác thực đã hết hạn chưa (5 phút)
-	if time.Since(user.CodeCreatedAt) > 5*time.Minute {
-		c.JSON(http.StatusOK, gin.H{"code": 0, "mess": "Mã xác thực đã hết hạn. Vui lòng yêu cầu mã mới."})
+	if err := services.ConsumeOTP(user.ID, models.OTPPurposeVerifyEmail, code); err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
 	user.IsVerified = true
-	user.Code = ""
-	config.DB.Save(&user)
+	config.DB.Model(&user).Update("is_verified", true)
 
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Email đã được xác thực", "data": user})
 }
@@ -246,14 +343,25 @@ func ForgetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Mã xác nhận để đặt lại mật khẩu đã được gửi đến email của bạn."})
 }
 
+// ResetPassword đổi mật khẩu khi có resetToken (nhận từ VerifyCode) hoặc trực tiếp bằng mã đặt lại mật khẩu
 func ResetPassword(c *gin.Context) {
-	var input LoginInput
+	var input struct {
+		Identifier string `json:"identifier" binding:"required"`
+		Password   string `json:"password" binding:"required"`
+		ResetToken string `json:"resetToken"`
+		Code       string `json:"code"`
+	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
+	if input.ResetToken == "" && input.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Cần mã xác thực để đổi mật khẩu"})
+		return
+	}
+
 	var user models.User
 	result := config.DB.Where("email = ? OR phone_number = ?", input.Identifier, input.Identifier).First(&user)
 	if result.Error != nil {
@@ -261,7 +369,18 @@ func ResetPassword(c *gin.Context) {
 		return
 	}
 
-	err := services.NewPass(user, input.Password)
+	var err error
+	if input.ResetToken != "" {
+		err = services.ConsumeOTP(user.ID, models.OTPPurposeResetPasswordGrant, input.ResetToken)
+	} else {
+		err = services.ConsumeOTP(user.ID, models.OTPPurposeResetPassword, input.Code)
+	}
+	if err != nil {
+		c.JSON(otpErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	err = services.NewPass(user, input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đổi mật khẩu: " + err.Error()})
 		return
@@ -270,10 +389,13 @@ func ResetPassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Mật khẩu đổi thành công"})
 }
 
+// VerifyCode kiểm tra mã theo mục đích (mặc định xác minh email).
+// Với mã đặt lại mật khẩu, trả về resetToken dùng một lần cho ResetPassword.
 func VerifyCode(c *gin.Context) {
 	var input struct {
-		Email string `json:"email" binding:"required"`
-		Code  string `json:"code" binding:"required"`
+		Email   string `json:"email" binding:"required"`
+		Code    string `json:"code" binding:"required"`
+		Purpose string `json:"purpose"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -281,6 +403,14 @@ func VerifyCode(c *gin.Context) {
 		return
 	}
 
+	if input.Purpose == "" {
+		input.Purpose = models.OTPPurposeVerifyEmail
+	}
+	if input.Purpose != models.OTPPurposeVerifyEmail && input.Purpose != models.OTPPurposeResetPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Mục đích mã xác thực không hợp lệ"})
+		return
+	}
+
 	var user models.User
 	result := config.DB.Where("email = ?", input.Email).First(&user)
 	if result.Error != nil {
@@ -288,89 +418,50 @@ func VerifyCode(c *gin.Context) {
 		return
 	}
 
-	if user.Code != input.Code {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Mã xác thực không hợp lệ"})
+	if err := services.ConsumeOTP(user.ID, input.Purpose, input.Code); err != nil {
+		c.JSON(otpErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
-	if time.Since(user.CodeCreatedAt) > 5*time.Minute {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Mã xác thực đã hết hạn. Vui lòng yêu cầu mã mới."})
+	if input.Purpose == models.OTPPurposeResetPassword {
+		resetToken, err := services.IssueOTPToken(user.ID, models.OTPPurposeResetPasswordGrant)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xác thực thành công", "resetToken": resetToken})
 		return
 	}
 
-	user.Code = ""
 	if !user.IsVerified {
-		user.IsVerified = true
+		config.DB.Model(&user).Update("is_verified", true)
 	}
 
-	config.DB.Save(&user)
-
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xác thực thành công"})
 }
 
+// GetUserIDFromToken xác thực chữ ký, thuật toán và hạn của access token rồi trả về userID và role
 func GetUserIDFromToken(tokenString string) (uint, int, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return 0, 0, fmt.Errorf("invalid token format")
-	}
-
-	// Giải mã phần payload của token
-	payload, err := jwt.DecodeSegment(parts[1])
+	claims, err := services.ParseAccessToken(tokenString)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to decode token payload: %w", err)
-	}
-
-	claimsMap := jwt.MapClaims{}
-	if err := json.Unmarshal(payload, &claimsMap); err != nil {
-		return 0, 0, fmt.Errorf("failed to unmarshal token payload: %w", err)
-	}
-
-	// Trích xuất userID và role từ claims
-	userInfo, ok := claimsMap["userinfo"].(map[string]interface{})
-	if !ok {
-		return 0, 0, fmt.Errorf("userinfo not found in token claims")
-	}
-
-	userID, okID := userInfo["userid"].(float64)
-	if !okID {
-		return 0, 0, fmt.Errorf("user ID not found in userinfo")
+		return 0, 0, err
 	}
-
-	role, okRole := userInfo["role"].(float64)
-	if !okRole {
-		return 0, 0, fmt.Errorf("role not found in userinfo")
-	}
-
-	return uint(userID), int(role), nil // Trả về userID và role
+	return claims.UserInfo.UserId, claims.UserInfo.Role, nil
 }
 
 func GetIDFromToken(tokenString string) (uint, error) {
-	parts := strings.Split(tokenString, ".")
-	if len(parts) != 3 {
-		return 0, fmt.Errorf("invalid token format")
-	}
+	userID, _, err := GetUserIDFromToken(tokenString)
+	return userID, err
+}
 
-	payload, err := jwt.DecodeSegment(parts[1])
+// currentUser trả về người dùng đã xác thực của request (do AuthMiddleware đặt vào context
+// hoặc xác thực từ header Authorization nếu route không có middleware)
+func currentUser(c *gin.Context) (uint, int, error) {
+	claims, err := services.AuthenticateRequest(c)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decode token payload: %w", err)
+		return 0, 0, err
 	}
-
-	claimsMap := jwt.MapClaims{}
-	if err := json.Unmarshal(payload, &claimsMap); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal token payload: %w", err)
-	}
-
-	userInfo, ok := claimsMap["userinfo"].(map[string]interface{})
-	if !ok {
-		return 0, fmt.Errorf("userinfo not found in token claims")
-	}
-
-	userID, okID := userInfo["userid"].(float64)
-	if !okID {
-		return 0, fmt.Errorf("user ID not found in userinfo")
-	}
-
-	return uint(userID), nil
+	return claims.UserInfo.UserId, claims.UserInfo.Role, nil
 }
 
 type GoogleUser struct {
@@ -426,6 +517,14 @@ func AuthGoogle(c *gin.Context) {
 		return
 	}
 
+	if rejectBannedUser(c, user) {
+		return
+	}
+
+	if respondTwoFactorChallenge(c, user) {
+		return
+	}
+
 	userResponse := UserLoginResponse{
 		UserID:       user.ID,
 		UserName:     user.Name,
@@ -444,7 +543,7 @@ func AuthGoogle(c *gin.Context) {
 		Role:   user.Role,
 	}
 
-	accessToken, err := services.GenerateToken(userInfo, 15, true)
+	tokens, err := services.IssueTokenPair(userInfo, c.Request.UserAgent(), c.ClientIP())
 	if err != nil {
 		log.Println("Error generating access token:", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -454,15 +553,17 @@ func AuthGoogle(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"code": 1,
 		"message": "Login successful",
 		"data": gin.H{
-			"user_info":   userResponse,
-			"accessToken": accessToken,
+			"user_info":    userResponse,
+			"accessToken":  tokens.AccessToken,
+			"refreshToken": tokens.RefreshToken,
+			"expiresIn":    tokens.ExpiresIn,
 		},
 	})
 }
 
 // verifyGoogleIDToken function - Xác thực ID token từ Google
 func verifyGoogleIDToken(tokenId string) (*idtoken.Payload, error) {
-	clientID := os.Getenv("GOOGLE_CLIENT_ID")
+	clientID := integrationConfig.GoogleClientID
 	payload, err := idtoken.Validate(context.Background(), tokenId, clientID)
 	if err != nil {
 		return nil, err
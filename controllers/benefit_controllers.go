@@ -76,13 +76,11 @@ func filterBenefits(benefits []models.Benefit, statusFilter, nameFilter string)
 }
 
 func GetAllBenefit(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
 	currentUserRole := 0
-	if authHeader != "" {
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		_, role, err := GetUserIDFromToken(tokenString)
+	if c.GetHeader("Authorization") != "" {
+		_, role, err := currentUser(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 			return
 		}
 		currentUserRole = role
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type CancellationPolicyRequest struct {
+	AccommodationID uint                      `json:"accommodationId" binding:"required"`
+	Type            string                    `json:"type" binding:"required"`
+	Tiers           []models.CancellationTier `json:"tiers"`
+}
+
+type CancellationPolicyResponse struct {
+	AccommodationID uint                      `json:"accommodationId"`
+	Type            string                    `json:"type"`
+	Tiers           []models.CancellationTier `json:"tiers"`
+}
+
+// getCancellationPolicy lấy chính sách hủy của chỗ ở, chưa khai báo thì dùng mặc định
+func getCancellationPolicy(db *gorm.DB, accommodationID uint) (models.CancellationPolicy, error) {
+	var policy models.CancellationPolicy
+	err := db.Where("accommodation_id = ?", accommodationID).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.DefaultCancellationPolicy(accommodationID), nil
+	}
+	return policy, err
+}
+
+func toCancellationPolicyResponse(policy models.CancellationPolicy) CancellationPolicyResponse {
+	tiers, _ := policy.GetTiers()
+	return CancellationPolicyResponse{
+		AccommodationID: policy.AccommodationID,
+		Type:            policy.Type,
+		Tiers:           tiers,
+	}
+}
+
+func GetCancellationPolicy(c *gin.Context) {
+	var accommodation models.Accommodation
+	if err := config.DB.First(&accommodation, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy chỗ ở"})
+		return
+	}
+
+	policy, err := getCancellationPolicy(config.DB, accommodation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy chính sách hủy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy chính sách hủy thành công", "data": toCancellationPolicyResponse(policy)})
+}
+
+func UpdateCancellationPolicy(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var request CancellationPolicyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var accommodation models.Accommodation
+	if err := config.DB.First(&accommodation, request.AccommodationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy chỗ ở"})
+		return
+	}
+
+	if !services.Can(currentUserID, currentUserRole, services.PermAccommodationEdit, accommodation.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền chỉnh sửa chỗ ở này"})
+		return
+	}
+
+	tiers, _ := json.Marshal(request.Tiers)
+	policy, err := getCancellationPolicy(config.DB, accommodation.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy chính sách hủy"})
+		return
+	}
+	policy.Type = request.Type
+	policy.Tiers = tiers
+
+	if err := policy.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&policy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lưu chính sách hủy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật chính sách hủy thành công", "data": toCancellationPolicyResponse(policy)})
+}
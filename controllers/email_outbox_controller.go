@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetOutboxEmails: superadmin xem hàng đợi email, lọc theo status (0 chờ gửi, 1 đang gửi, 2 đã gửi, 3 lỗi hẳn)
+func GetOutboxEmails(c *gin.Context) {
+	var status *int
+	if raw := c.Query("status"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Trạng thái không hợp lệ"})
+			return
+		}
+		status = &parsed
+	}
+
+	page, limit := 0, 20
+	if parsedPage, err := strconv.Atoi(c.Query("page")); err == nil && parsedPage >= 0 {
+		page = parsedPage
+	}
+	if parsedLimit, err := strconv.Atoi(c.Query("limit")); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+		limit = parsedLimit
+	}
+
+	emails, total, err := services.ListOutboxEmails(status, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy hàng đợi email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"mess": "Lấy hàng đợi email thành công",
+		"data": emails,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// ResendOutboxEmail đưa email bị lỗi về hàng đợi để worker gửi lại ngay
+func ResendOutboxEmail(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "ID không hợp lệ"})
+		return
+	}
+
+	email, err := services.ResendOutboxEmail(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrOutboxEmailNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": err.Error()})
+		case errors.Is(err, services.ErrOutboxEmailNotFailing):
+			c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể gửi lại email"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Email đã được đưa lại vào hàng đợi", "data": email})
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserEmail lấy email tài khoản của người dùng hiện tại
+func currentUserEmail(c *gin.Context) (string, bool) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return "", false
+	}
+
+	var user models.User
+	if err := config.DB.Select("email").First(&user, currentUserID).Error; err != nil || user.Email == "" {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Tài khoản chưa có email"})
+		return "", false
+	}
+	return user.Email, true
+}
+
+// GetEmailPreferences cho biết người dùng có nhận email nhắc lịch nhận phòng và mời đánh giá hay không
+func GetEmailPreferences(c *gin.Context) {
+	email, ok := currentUserEmail(c)
+	if !ok {
+		return
+	}
+
+	optedOut, err := services.IsEmailOptedOut(email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy cài đặt email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy cài đặt email thành công", "data": gin.H{"reminders": !optedOut}})
+}
+
+func UpdateEmailPreferences(c *gin.Context) {
+	var input struct {
+		Reminders *bool `json:"reminders" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	email, ok := currentUserEmail(c)
+	if !ok {
+		return
+	}
+
+	if err := services.SetEmailOptOut(email, !*input.Reminders); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật cài đặt email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật cài đặt email thành công", "data": gin.H{"reminders": *input.Reminders}})
+}
+
+// UnsubscribeEmail xử lý liên kết hủy đăng ký trong email nhắc lịch (không cần đăng nhập, kiểm tra bằng token ký)
+func UnsubscribeEmail(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	if err := services.UnsubscribeEmail(input.Email, input.Token); err != nil {
+		if errors.Is(err, services.ErrUnsubscribeLinkInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể hủy đăng ký"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Bạn sẽ không nhận email nhắc lịch và mời đánh giá nữa"})
+}
@@ -18,21 +18,25 @@ import (
 	"github.com/redis/go-redis/v9"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type InvoiceResponse struct {
-	ID              uint                `json:"id"`
-	InvoiceCode     string              `json:"invoiceCode"`
-	OrderID         uint                `json:"orderId"`
-	TotalAmount     float64             `json:"totalAmount"`
-	PaidAmount      float64             `json:"paidAmount"`
-	RemainingAmount float64             `json:"remainingAmount"`
-	Status          int                 `json:"status"`
-	PaymentDate     *string             `json:"paymentDate,omitempty"`
-	CreatedAt       string              `json:"createdAt"`
-	UpdatedAt       string              `json:"updatedAt"`
-	User            InvoiceUserResponse `json:"user"`
-	AdminID         uint                `json:"adminId"`
+	ID              uint                    `json:"id"`
+	InvoiceCode     string                  `json:"invoiceCode"`
+	OrderID         uint                    `json:"orderId"`
+	TotalAmount     float64                 `json:"totalAmount"`
+	PaidAmount      float64                 `json:"paidAmount"`
+	RemainingAmount float64                 `json:"remainingAmount"`
+	Status          int                     `json:"status"`
+	PaymentDate     *string                 `json:"paymentDate,omitempty"`
+	CreatedAt       string                  `json:"createdAt"`
+	UpdatedAt       string                  `json:"updatedAt"`
+	User            InvoiceUserResponse     `json:"user"`
+	AdminID         uint                    `json:"adminId"`
+	Payments        []models.InvoicePayment `json:"payments,omitempty"`
+	RefundAmount    float64                 `json:"refundAmount"`
+	Refunds         []models.Refund         `json:"refunds,omitempty"`
 }
 
 type InvoiceUserResponse struct {
@@ -54,16 +58,9 @@ type ToTalResponse struct {
 }
 
 func GetInvoices(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -117,15 +114,10 @@ func GetInvoices(c *gin.Context) {
 				Joins("JOIN accommodations ON accommodations.id = orders.accommodation_id").
 				Where("accommodations.user_id = ?", currentUserID))
 		} else if currentUserRole == 3 {
-			var adminID int
-			if err := config.DB.Model(&models.User{}).Select("admin_id").Where("id = ?", currentUserID).Scan(&adminID).Error; err != nil {
-				c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
-				return
-			}
+			// Lễ tân: hóa đơn của các chỗ ở được giao
 			tx = tx.Where("order_id IN (?)", config.DB.Table("orders").
 				Select("orders.id").
-				Joins("JOIN accommodations ON accommodations.id = orders.accommodation_id").
-				Where("accommodations.user_id = ?", adminID))
+				Where("orders.accommodation_id IN (?)", services.PermittedAccommodations(currentUserID, services.PermAccommodationView)))
 		}
 
 		var invoices []models.Invoice
@@ -203,7 +195,9 @@ func GetInvoices(c *gin.Context) {
 
 func GetDetailInvoice(c *gin.Context) {
 	var invoice models.Invoice
-	if err := config.DB.Where("id = ?", c.Param("id")).First(&invoice).Error; err != nil {
+	if err := config.DB.Preload("Payments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("paid_at ASC, id ASC")
+	}).Preload("Refunds").Where("id = ?", c.Param("id")).First(&invoice).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 0, "message": "Không tìm thấy hóa đơn!"})
 		return
 	}
@@ -229,6 +223,9 @@ func GetDetailInvoice(c *gin.Context) {
 		CreatedAt:       invoice.CreatedAt.Format("2006-01-02 15:04:05"),
 		UpdatedAt:       invoice.UpdatedAt.Format("2006-01-02 15:04:05"),
 		AdminID:         invoice.AdminID,
+		Payments:        invoice.Payments,
+		RefundAmount:    invoice.RefundAmount,
+		Refunds:         invoice.Refunds,
 		User: InvoiceUserResponse{
 			ID:          user.ID,
 			Email:       user.Email,
@@ -262,14 +259,59 @@ func UpdatePaymentStatus(c *gin.Context) {
 		return
 	}
 
-	invoice.PaymentType = &request.PaymentType
-	currentTime := time.Now()
-	invoice.PaymentDate = &currentTime
-	invoice.Status = 1
-	invoice.RemainingAmount = 0
-	invoice.PaidAmount = invoice.TotalAmount
+	// Thu nốt số tiền còn lại bằng một khoản trong sổ thanh toán, trạng thái hóa đơn được tính lại từ sổ
+	var staffID *uint
+	if userID, _, err := currentUser(c); err == nil {
+		staffID = &userID
+	}
+
+	actor := services.AuditActorFromRequest(c)
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		lockedInvoice, err := services.LockInvoice(tx, invoice.ID)
+		if err != nil {
+			return err
+		}
+		if err := services.RecalculateInvoice(tx, lockedInvoice); err != nil {
+			return err
+		}
+		if lockedInvoice.RemainingAmount <= 0 {
+			return nil
+		}
 
-	if err := config.DB.Save(&invoice).Error; err != nil {
+		before := map[string]interface{}{
+			"paidAmount":      lockedInvoice.PaidAmount,
+			"remainingAmount": lockedInvoice.RemainingAmount,
+			"status":          lockedInvoice.Status,
+		}
+		if err := services.RecordInvoicePayment(tx, lockedInvoice, &models.InvoicePayment{
+			Amount:  lockedInvoice.RemainingAmount,
+			Method:  request.PaymentType,
+			PaidAt:  time.Now(),
+			StaffID: staffID,
+		}); err != nil {
+			return err
+		}
+
+		var accommodationID uint
+		if err := tx.Model(&models.Order{}).Where("id = ?", lockedInvoice.OrderID).Select("accommodation_id").Scan(&accommodationID).Error; err != nil {
+			return err
+		}
+		return services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:          services.AuditInvoicePaymentUpdate,
+			EntityType:      "invoice",
+			EntityID:        lockedInvoice.ID,
+			AccommodationID: &accommodationID,
+			AdminID:         &lockedInvoice.AdminID,
+			Before:          before,
+			After: map[string]interface{}{
+				"paidAmount":      lockedInvoice.PaidAmount,
+				"remainingAmount": lockedInvoice.RemainingAmount,
+				"status":          lockedInvoice.Status,
+				"paymentType":     request.PaymentType,
+			},
+		})
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật trạng thái thanh toán"})
 		return
 	}
@@ -360,16 +402,9 @@ func UpdatePaymentStatus(c *gin.Context) {
 }
 
 func SendPay(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -394,19 +429,16 @@ func SendPay(c *gin.Context) {
 	vatLastMonth := request.VatLastMonth
 	totalVat := vat + vatLastMonth
 
-	qrCodeURL := fmt.Sprintf(
-		"https://img.vietqr.io/image/SACOMBANK-060915374450-compact.jpg?amount=%d&addInfo=Chuyen%%20khoan%%20phi%%20",
-		totalVat,
-	)
+	qrCodeURL := services.PayoutQRCodeURL(totalVat)
 
-	if err := services.SendPayEmail(email, vat, vatLastMonth, totalVat, qrCodeURL); err != nil {
+	if err := services.SendPayEmail(config.DB, email, vat, vatLastMonth, totalVat, qrCodeURL); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể gửi email", "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 1,
-		"mess": "Email đã được gửi thành công",
+		"mess": "Email đã được xếp hàng để gửi",
 	})
 }
 
@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type InvoicePaymentRequest struct {
+	InvoiceID uint    `json:"invoiceId" binding:"required"`
+	Amount    float64 `json:"amount" binding:"required"`
+	Method    int     `json:"method"`
+	PaidAt    string  `json:"paidAt"` // dd/mm/yyyy hh:mm, để trống = thời điểm hiện tại
+	Note      string  `json:"note"`
+}
+
+type VoidInvoicePaymentRequest struct {
+	ID     uint   `json:"id" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// authorizeInvoice kiểm tra token và quyền của nhân viên trên đơn hàng của hóa đơn
+func authorizeInvoice(c *gin.Context, invoiceID uint) (uint, bool) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return 0, false
+	}
+
+	var invoice models.Invoice
+	if err := config.DB.First(&invoice, invoiceID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Hóa đơn không tìm thấy"})
+		return 0, false
+	}
+
+	var order models.Order
+	if err := config.DB.Preload("Accommodation").First(&order, invoice.OrderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy đơn hàng liên quan"})
+		return 0, false
+	}
+
+	if !services.Can(currentUserID, currentUserRole, services.PermInvoicePayment, order.AccommodationID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền với hóa đơn này"})
+		return 0, false
+	}
+
+	return currentUserID, true
+}
+
+func clearInvoiceCache() {
+	rdb, err := config.ConnectRedis()
+	if err != nil {
+		return
+	}
+	if err := DeleteKeysByPattern(config.Ctx, rdb, "invoices:*"); err != nil {
+		fmt.Printf("Lỗi khi xóa các key con của invoices: %v\n", err)
+	}
+}
+
+func GetInvoicePayments(c *gin.Context) {
+	var invoice models.Invoice
+	if err := config.DB.First(&invoice, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Hóa đơn không tìm thấy"})
+		return
+	}
+	if _, ok := authorizeInvoice(c, invoice.ID); !ok {
+		return
+	}
+
+	var payments []models.InvoicePayment
+	if err := config.DB.Where("invoice_id = ?", invoice.ID).Order("paid_at ASC, id ASC").Find(&payments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy sổ thanh toán"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy sổ thanh toán thành công", "data": gin.H{
+		"invoice":  invoice,
+		"payments": payments,
+	}})
+}
+
+// RecordInvoicePayment ghi thêm một khoản thu vào hóa đơn (đặt cọc, trả nốt...)
+func RecordInvoicePayment(c *gin.Context) {
+	var request InvoicePaymentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	currentUserID, ok := authorizeInvoice(c, request.InvoiceID)
+	if !ok {
+		return
+	}
+
+	paidAt := time.Now()
+	if request.PaidAt != "" {
+		parsed, err := time.ParseInLocation("02/01/2006 15:04", request.PaidAt, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Thời gian thanh toán không hợp lệ, vui lòng sử dụng định dạng dd/mm/yyyy hh:mm"})
+			return
+		}
+		paidAt = parsed
+	}
+
+	payment := models.InvoicePayment{
+		InvoiceID: request.InvoiceID,
+		Amount:    request.Amount,
+		Method:    request.Method,
+		PaidAt:    paidAt,
+		StaffID:   &currentUserID,
+		Note:      request.Note,
+	}
+	if err := payment.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	actor := services.AuditActorFromRequest(c)
+	var invoice *models.Invoice
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.LockInvoice(tx, request.InvoiceID)
+		if err != nil {
+			return err
+		}
+		if err := services.RecalculateInvoice(tx, invoice); err != nil {
+			return err
+		}
+
+		if invoice.Status == 2 {
+			return &orderTxError{status: http.StatusConflict, mess: "Hóa đơn đã bị hủy"}
+		}
+
+		before := services.InvoiceAuditSnapshot(invoice)
+		if err := services.RecordInvoicePayment(tx, invoice, &payment); err != nil {
+			return err
+		}
+		after := services.InvoiceAuditSnapshot(invoice)
+		after["paymentId"] = payment.ID
+		after["amount"] = payment.Amount
+		after["method"] = payment.Method
+		return services.RecordInvoiceAudit(tx, actor, invoice, services.AuditEntry{
+			Action:     services.AuditInvoicePaymentRecord,
+			EntityType: "invoice",
+			EntityID:   invoice.ID,
+			Before:     before,
+			After:      after,
+		})
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
+		if errors.Is(err, services.ErrPaymentExceedsRemaining) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể ghi nhận thanh toán", "detail": err.Error()})
+		return
+	}
+
+	clearInvoiceCache()
+
+	c.JSON(http.StatusCreated, gin.H{"code": 1, "mess": "Ghi nhận thanh toán thành công", "data": gin.H{
+		"payment": payment,
+		"invoice": invoice,
+	}})
+}
+
+// VoidInvoicePayment hủy một khoản thu ghi nhầm. Khoản thu không bị xóa mà được đánh dấu hủy kèm lý do.
+func VoidInvoicePayment(c *gin.Context) {
+	var request VoidInvoicePaymentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var payment models.InvoicePayment
+	if err := config.DB.First(&payment, request.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy khoản thanh toán"})
+		return
+	}
+
+	currentUserID, ok := authorizeInvoice(c, payment.InvoiceID)
+	if !ok {
+		return
+	}
+
+	actor := services.AuditActorFromRequest(c)
+	var invoice *models.Invoice
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = services.LockInvoice(tx, payment.InvoiceID)
+		if err != nil {
+			return err
+		}
+		// Hóa đơn đã hủy đã chốt số tiền hoàn theo số đã thu, không được hủy bớt khoản thu
+		if invoice.Status == 2 {
+			return &orderTxError{status: http.StatusConflict, mess: "Hóa đơn đã bị hủy"}
+		}
+
+		if err := tx.First(&payment, request.ID).Error; err != nil {
+			return err
+		}
+		if payment.VoidedAt != nil {
+			return &orderTxError{status: http.StatusConflict, mess: "Khoản thanh toán đã bị hủy trước đó"}
+		}
+
+		before := services.InvoiceAuditSnapshot(invoice)
+		now := time.Now()
+		payment.VoidedAt = &now
+		payment.VoidedBy = &currentUserID
+		payment.VoidReason = request.Reason
+		if err := tx.Save(&payment).Error; err != nil {
+			return err
+		}
+		if err := services.RecalculateInvoice(tx, invoice); err != nil {
+			return err
+		}
+
+		after := services.InvoiceAuditSnapshot(invoice)
+		after["paymentId"] = payment.ID
+		after["amount"] = payment.Amount
+		after["reason"] = payment.VoidReason
+		return services.RecordInvoiceAudit(tx, actor, invoice, services.AuditEntry{
+			Action:     services.AuditInvoicePaymentVoid,
+			EntityType: "invoice",
+			EntityID:   invoice.ID,
+			Before:     before,
+			After:      after,
+		})
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể hủy khoản thanh toán", "detail": err.Error()})
+		return
+	}
+
+	clearInvoiceCache()
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Hủy khoản thanh toán thành công", "data": gin.H{
+		"payment": payment,
+		"invoice": invoice,
+	}})
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UpdateBalanceRequest struct {
@@ -72,16 +73,9 @@ func getUserIDs(users []models.User) []uint {
 }
 
 func GetUserAcc(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -205,23 +199,43 @@ func (u UserController) UpdateUserBalance(c *gin.Context) {
 	}
 
 	var user models.User
+	actor := services.AuditActorFromRequest(c)
 
-	if err := config.DB.First(&user, req.UserID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Người dùng không tồn tại"})
-		return
-	}
+	// Số dư và nhật ký được ghi cùng transaction, khóa dòng user để hai lần cập nhật không chồng lên nhau
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, req.UserID).Error; err != nil {
+			return &orderTxError{status: http.StatusNotFound, mess: "Người dùng không tồn tại"}
+		}
 
-	now := time.Now()
+		now := time.Now()
 
-	if user.DateCheck.Year() == now.Year() && user.DateCheck.Month() == now.Month() {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Bạn đã cập nhật lương trong tháng này rồi, không thể cập nhật nữa!"})
-		return
-	}
+		if user.DateCheck.Year() == now.Year() && user.DateCheck.Month() == now.Month() {
+			return &orderTxError{status: http.StatusBadRequest, mess: "Bạn đã cập nhật lương trong tháng này rồi, không thể cập nhật nữa!"}
+		}
 
-	user.Amount += req.Amount
-	user.DateCheck = now
+		before := map[string]interface{}{"amount": user.Amount, "dateCheck": user.DateCheck}
+		user.Amount += req.Amount
+		user.DateCheck = now
 
-	if err := config.DB.Save(&user).Error; err != nil {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"amount": user.Amount, "date_check": user.DateCheck}).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi khi cập nhật số dư"}
+		}
+
+		return services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:     services.AuditUserBalanceUpdate,
+			EntityType: "user",
+			EntityID:   user.ID,
+			AdminID:    user.AdminId,
+			Before:     before,
+			After:      map[string]interface{}{"amount": user.Amount, "dateCheck": user.DateCheck},
+		})
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật số dư"})
 		return
 	}
@@ -243,16 +257,9 @@ func (u UserController) UpdateUserBalance(c *gin.Context) {
 }
 
 func (u UserController) UpdateUserAccommodation(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -295,8 +302,8 @@ func (u UserController) UpdateUserAccommodation(c *gin.Context) {
 		return
 	}
 
-	user.AccommodationIDs = req.AccommodationIDs
-	if err := config.DB.Save(&user).Error; err != nil {
+	// Giao vai trò lễ tân trên đúng các chỗ ở được chọn
+	if err := services.ReplaceAccommodationAssignments(currentUserID, user.ID, services.RoleReceptionist, req.AccommodationIDs); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật địa điểm điểm danh"})
 		return
 	}
@@ -312,7 +319,7 @@ func (u UserController) UpdateUserAccommodation(c *gin.Context) {
 		"mess": "Phân quyền thành công",
 		"data": gin.H{
 			"userId":          user.ID,
-			"accommodationId": user.AccommodationIDs,
+			"accommodationId": req.AccommodationIDs,
 		},
 	})
 }
@@ -337,13 +344,14 @@ func (u UserController) CheckInUser(c *gin.Context) {
 		return
 	}
 
-	if user.AccommodationIDs == nil || len(user.AccommodationIDs) == 0 {
+	accommodationIDs, err := services.AssignedAccommodationIDs(user.ID)
+	if err != nil || len(accommodationIDs) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Người dùng chưa có thông tin lưu trú"})
 		return
 	}
 
 	var accommodations []models.Accommodation
-	if err := config.DB.Where("id IN ?", user.AccommodationIDs).Find(&accommodations).Error; err != nil {
+	if err := config.DB.Where("id IN ?", accommodationIDs).Find(&accommodations).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi lấy thông tin lưu trú"})
 		return
 	}
@@ -416,16 +424,9 @@ func (u UserController) CheckInUser(c *gin.Context) {
 }
 
 func GetUserCalendar(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -495,15 +496,9 @@ func GetUserCalendar(c *gin.Context) {
 }
 
 func CalculateUserSalaryInit(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -588,16 +583,9 @@ func CalculateUserSalaryInit(c *gin.Context) {
 }
 
 func CalculateUserSalary(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -669,16 +657,9 @@ func CalculateUserSalary(c *gin.Context) {
 }
 
 func UpdateSalaryStatus(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -710,11 +691,43 @@ func UpdateSalaryStatus(c *gin.Context) {
 	}
 
 	// Cập nhật trạng thái
-	userSalary.Status = req.Status
-	if err := config.DB.Save(&userSalary).Error; err != nil {
+	actor := services.AuditActorFromRequest(c)
+	var notifications []models.Notification
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		wasPaid := userSalary.Status
+		before := map[string]interface{}{"status": userSalary.Status}
+		if err := tx.Model(&userSalary).Update("status", req.Status).Error; err != nil {
+			return err
+		}
+		if err := services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:     services.AuditSalaryStatusUpdate,
+			EntityType: "user_salary",
+			EntityID:   userSalary.ID,
+			AdminID:    user.AdminId,
+			Before:     before,
+			After:      map[string]interface{}{"status": req.Status},
+		}); err != nil {
+			return err
+		}
+
+		// Chỉ báo khi lương chuyển sang đã trả
+		if !req.Status || wasPaid {
+			return nil
+		}
+		var err error
+		notifications, err = services.CreateNotifications(tx, []uint{userSalary.UserID}, services.NotificationInput{
+			Type:    services.NotificationSalaryPaid,
+			Title:   "Đã nhận lương",
+			Body:    fmt.Sprintf("Lương tháng %s: %d đã được thanh toán.", userSalary.SalaryDate.Format("01/2006"), userSalary.TotalSalary),
+			Payload: map[string]interface{}{"salaryId": userSalary.ID, "totalSalary": userSalary.TotalSalary},
+		})
+		return err
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật trạng thái"})
 		return
 	}
+	services.PublishNotifications(notifications)
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 1,
@@ -727,16 +740,9 @@ func UpdateSalaryStatus(c *gin.Context) {
 }
 
 func GetUserCheckin(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -874,16 +880,9 @@ func GetUserCheckin(c *gin.Context) {
 }
 
 func GetUserSalary(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -1004,15 +1003,9 @@ func GetAccommodationReceptionist(c *gin.Context) {
 	var user models.User
 	var accommodations []models.Accommodation
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing!"})
-		return
-	}
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 	}
 
 	//Tạo cache key Redis
@@ -1036,13 +1029,13 @@ func GetAccommodationReceptionist(c *gin.Context) {
 			return
 		}
 
-		// Kiểm tra xem user có danh sách accommodation không
-		if len(user.AccommodationIDs) > 0 {
-			var ids []int64
-			for _, id := range user.AccommodationIDs {
-				ids = append(ids, id)
-			}
-
+		// Các chỗ ở user được giao vai trò
+		ids, err := services.AssignedAccommodationIDs(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Error fetching accommodations"})
+			return
+		}
+		if len(ids) > 0 {
 			if err := config.DB.Where("id IN (?)", ids).Find(&accommodations).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Error fetching accommodations"})
 				return
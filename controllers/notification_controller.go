@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetNotifications liệt kê hộp thư của người dùng hiện tại, ?unread=true chỉ lấy thông báo chưa đọc
+func GetNotifications(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	page, limit := 0, 20
+	if parsedPage, err := strconv.Atoi(c.Query("page")); err == nil && parsedPage >= 0 {
+		page = parsedPage
+	}
+	if parsedLimit, err := strconv.Atoi(c.Query("limit")); err == nil && parsedLimit > 0 && parsedLimit <= 100 {
+		limit = parsedLimit
+	}
+
+	notifications, total, err := services.ListNotifications(currentUserID, c.Query("unread") == "true", page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy thông báo"})
+		return
+	}
+	unread, err := services.UnreadNotificationCount(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đếm thông báo chưa đọc"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":        1,
+		"mess":        "Lấy thông báo thành công",
+		"data":        notifications,
+		"unreadCount": unread,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+func GetUnreadNotificationCount(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	unread, err := services.UnreadNotificationCount(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đếm thông báo chưa đọc"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy số thông báo chưa đọc thành công", "data": gin.H{"unreadCount": unread}})
+}
+
+func MarkNotificationRead(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	notificationID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "ID thông báo không hợp lệ"})
+		return
+	}
+
+	if err := services.MarkNotificationRead(currentUserID, uint(notificationID)); err != nil {
+		if errors.Is(err, services.ErrNotificationNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật thông báo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã đánh dấu thông báo là đã đọc"})
+}
+
+func MarkAllNotificationsRead(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	updated, err := services.MarkAllNotificationsRead(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật thông báo"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã đánh dấu tất cả thông báo là đã đọc", "data": gin.H{"updated": updated}})
+}
@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ModifyOrderRequest: trường để trống (hoặc roomId = null) là giữ nguyên giá trị cũ
+type ModifyOrderRequest struct {
+	ID           uint    `json:"id" binding:"required"`
+	CheckInDate  string  `json:"checkInDate"`
+	CheckOutDate string  `json:"checkOutDate"`
+	RoomID       *[]uint `json:"roomId"`
+	GuestName    string  `json:"guestName"`
+	GuestEmail   string  `json:"guestEmail"`
+	GuestPhone   string  `json:"guestPhone"`
+}
+
+// canManageOrder: người đặt luôn được với đơn của chính mình, nhân viên cần permission trên chỗ ở của đơn
+// (superadmin và chủ chỗ ở luôn có)
+func canManageOrder(order models.Order, currentUserID uint, currentUserRole int, permission string) bool {
+	if order.UserID != nil && *order.UserID == currentUserID {
+		return true
+	}
+	return services.Can(currentUserID, currentUserRole, permission, order.AccommodationID)
+}
+
+func orderRoomIDs(order models.Order) []uint {
+	roomIDs := []uint{}
+	for _, room := range order.Room {
+		roomIDs = append(roomIDs, room.RoomId)
+	}
+	return roomIDs
+}
+
+func sameRoomIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[uint]int)
+	for _, id := range a {
+		seen[id]++
+	}
+	for _, id := range b {
+		if seen[id] == 0 {
+			return false
+		}
+		seen[id]--
+	}
+	return true
+}
+
+// orderDiscountPercent lấy lại % giảm giá đã áp dụng cho đơn để sửa đơn không tiêu thêm lượt mã giảm giá
+func orderDiscountPercent(order models.Order) float64 {
+	if len(order.PriceItems) > 0 {
+		for _, item := range order.PriceItems {
+			if item.Type == models.RuleDiscount {
+				return -item.Percent
+			}
+		}
+		return 0
+	}
+	// Đơn cũ chưa có bảng giá chi tiết thì suy ra từ cột DiscountPrice
+	if order.Price > 0 && order.DiscountPrice > 0 {
+		return order.DiscountPrice * 100 / float64(order.Price)
+	}
+	return 0
+}
+
+func toOrderSnapshot(order models.Order, roomIDs []uint) models.OrderSnapshot {
+	return models.OrderSnapshot{
+		CheckInDate:  order.CheckInDate,
+		CheckOutDate: order.CheckOutDate,
+		RoomID:       roomIDs,
+		GuestName:    order.GuestName,
+		GuestEmail:   order.GuestEmail,
+		GuestPhone:   order.GuestPhone,
+		TotalPrice:   order.TotalPrice,
+	}
+}
+
+// ModifyOrder sửa ngày, phòng hoặc thông tin khách của đơn đang hoạt động.
+// Đổi ngày/phòng sẽ kiểm tra lại lịch trống, chuyển trạng thái phòng, tính lại giá
+// và điều chỉnh hóa đơn (nếu có) theo phần chênh lệch.
+func ModifyOrder(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var request ModifyOrderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.
+		Preload("Accommodation").
+		Preload("Room").
+		Preload("PriceItems").
+		First(&order, request.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Đơn hàng không tồn tại"})
+		return
+	}
+
+	if !canManageOrder(order, currentUserID, currentUserRole, services.PermOrderManage) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền sửa đơn hàng này"})
+		return
+	}
+
+	if order.Status == 2 {
+		c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Đơn hàng đã bị hủy, không thể sửa"})
+		return
+	}
+
+	now := time.Now()
+	if order.Status == 0 && order.HoldExpiresAt != nil && order.HoldExpiresAt.Before(now) {
+		c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Đơn hàng đã hết thời gian giữ chỗ"})
+		return
+	}
+
+	oldRoomIDs := orderRoomIDs(order)
+	before := toOrderSnapshot(order, oldRoomIDs)
+
+	newCheckIn, newCheckOut, newRoomIDs := order.CheckInDate, order.CheckOutDate, oldRoomIDs
+	if request.CheckInDate != "" {
+		newCheckIn = request.CheckInDate
+	}
+	if request.CheckOutDate != "" {
+		newCheckOut = request.CheckOutDate
+	}
+	isRoomBooking := order.Accommodation.Type == 0 && len(oldRoomIDs) > 0
+	if request.RoomID != nil && isRoomBooking {
+		newRoomIDs = *request.RoomID
+		if len(newRoomIDs) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Đơn phải có ít nhất một phòng"})
+			return
+		}
+	}
+
+	rebook := newCheckIn != order.CheckInDate || newCheckOut != order.CheckOutDate || !sameRoomIDs(newRoomIDs, oldRoomIDs)
+
+	var checkInDate, checkOutDate time.Time
+	var numDays int
+	if rebook {
+		checkInDate, err = time.Parse("02/01/2006", newCheckIn)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày nhận phòng không hợp lệ"})
+			return
+		}
+		// Khách đang ở vẫn được gia hạn ngày trả phòng, chỉ chặn khi dời ngày nhận phòng về quá khứ
+		if newCheckIn != order.CheckInDate && checkInDate.Before(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày nhận phòng không được nhỏ hơn ngày hiện tại"})
+			return
+		}
+		checkOutDate, err = time.Parse("02/01/2006", newCheckOut)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày trả phòng không hợp lệ"})
+			return
+		}
+		numDays = int(checkOutDate.Sub(checkInDate).Hours() / 24)
+		if numDays <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày trả phòng phải sau ngày nhận phòng"})
+			return
+		}
+	}
+
+	oldTotalPrice := order.TotalPrice
+	var change models.OrderChange
+
+	actor := services.AuditActorFromRequest(c)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if rebook {
+			// Nhả lịch cũ của đơn trước rồi mới kiểm tra, để đơn không tự trùng với chính nó
+			if err := services.ReleaseOrderStatuses(tx, order); err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+			}
+
+			discountPercent := orderDiscountPercent(order)
+			quote, err := quoteBooking(tx, bookingQuoteInput{
+				Accommodation:   order.Accommodation,
+				RoomIDs:         newRoomIDs,
+				CheckInDate:     checkInDate,
+				CheckOutDate:    checkOutDate,
+				Nights:          numDays,
+				Now:             now,
+				Lock:            true,
+				DiscountPercent: &discountPercent,
+			})
+			if err != nil {
+				return err
+			}
+			if len(quote.Conflicts) > 0 {
+				return &orderTxError{status: http.StatusConflict, mess: "Phòng đã được đặt hoặc không khả dụng trong khoảng thời gian này"}
+			}
+
+			order.CheckInDate = newCheckIn
+			order.CheckOutDate = newCheckOut
+			order.Price = quote.BasePrice
+			services.SummarizePriceLines(&order, quote.Lines)
+
+			if err := tx.Where("order_id = ?", order.ID).Delete(&models.OrderPriceItem{}).Error; err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật bảng giá của đơn"}
+			}
+			for i := range order.PriceItems {
+				order.PriceItems[i].OrderID = order.ID
+			}
+			if len(order.PriceItems) > 0 {
+				if err := tx.Create(&order.PriceItems).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật bảng giá của đơn"}
+				}
+			}
+
+			// Đơn chờ xác nhận vẫn giữ chỗ tới hạn cũ, đơn đã xác nhận thì đặt luôn
+			status, expiresAt := models.StatusBooked, (*time.Time)(nil)
+			if order.Status == 0 && order.HoldExpiresAt != nil {
+				status, expiresAt = models.StatusHold, order.HoldExpiresAt
+			}
+
+			if isRoomBooking {
+				var rooms []models.Room
+				for _, roomID := range newRoomIDs {
+					rooms = append(rooms, models.Room{RoomId: roomID})
+				}
+				if err := tx.Model(&order).Association("Room").Replace(rooms); err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể liên kết phòng với đơn hàng"}
+				}
+
+				for _, roomID := range newRoomIDs {
+					roomStatus := models.RoomStatus{
+						RoomID:    roomID,
+						OrderID:   &order.ID,
+						Status:    status,
+						FromDate:  checkInDate,
+						ToDate:    checkOutDate,
+						ExpiresAt: expiresAt,
+					}
+					if err := tx.Create(&roomStatus).Error; err != nil {
+						return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật trạng thái phòng"}
+					}
+				}
+			} else {
+				accStatus := models.AccommodationStatus{
+					AccommodationID: order.AccommodationID,
+					OrderID:         &order.ID,
+					Status:          status,
+					FromDate:        checkInDate,
+					ToDate:          checkOutDate,
+					ExpiresAt:       expiresAt,
+				}
+				if err := tx.Create(&accStatus).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật trạng thái phòng"}
+				}
+			}
+		}
+
+		if request.GuestName != "" {
+			order.GuestName = request.GuestName
+		}
+		if request.GuestEmail != "" {
+			order.GuestEmail = request.GuestEmail
+		}
+		if request.GuestPhone != "" {
+			order.GuestPhone = request.GuestPhone
+		}
+		order.UpdatedAt = now
+
+		if err := tx.Omit(clause.Associations).Save(&order).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật đơn hàng"}
+		}
+
+		priceDifference := order.TotalPrice - oldTotalPrice
+		if priceDifference != 0 {
+			auditBefore := map[string]interface{}{"totalPrice": oldTotalPrice}
+			auditAfter := map[string]interface{}{"totalPrice": order.TotalPrice, "priceDifference": priceDifference}
+
+			var invoice models.Invoice
+			err := tx.Where("order_id = ?", order.ID).First(&invoice).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi truy vấn hóa đơn"}
+			}
+			if err == nil && invoice.Status != 2 {
+				lockedInvoice, err := services.LockInvoice(tx, invoice.ID)
+				if err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể điều chỉnh hóa đơn"}
+				}
+				auditBefore["invoice"] = services.InvoiceAuditSnapshot(lockedInvoice)
+				lockedInvoice.TotalAmount += priceDifference
+				if err := tx.Model(lockedInvoice).Update("total_amount", lockedInvoice.TotalAmount).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể điều chỉnh hóa đơn"}
+				}
+				if err := services.RecalculateInvoice(tx, lockedInvoice); err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể điều chỉnh hóa đơn"}
+				}
+
+				// Tổng mới thấp hơn số đã thu: phần thu dư (trừ các khoản hoàn đã tạo trước) chờ hoàn cho khách
+				var refunded float64
+				if err := tx.Model(&models.Refund{}).
+					Where("invoice_id = ? AND status <> ?", lockedInvoice.ID, models.RefundRejected).
+					Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi truy vấn hoàn tiền của hóa đơn"}
+				}
+				if excess := lockedInvoice.PaidAmount - lockedInvoice.TotalAmount - refunded; excess >= 1 {
+					refund := models.Refund{
+						InvoiceID: lockedInvoice.ID,
+						OrderID:   order.ID,
+						AdminID:   lockedInvoice.AdminID,
+						Amount:    excess,
+						Percent:   int(math.Round(excess / lockedInvoice.PaidAmount * 100)),
+						Reason:    "Sửa đơn làm tổng tiền thấp hơn số đã thanh toán",
+						Status:    models.RefundPending,
+						CreatedBy: currentUserID,
+					}
+					if err := tx.Create(&refund).Error; err != nil {
+						return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tạo yêu cầu hoàn tiền"}
+					}
+					if err := tx.Model(lockedInvoice).Update("refund_amount", refunded+excess).Error; err != nil {
+						return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi khi ghi nhận hoàn tiền cho hóa đơn"}
+					}
+					lockedInvoice.RefundAmount = refunded + excess
+					auditAfter["refundId"] = refund.ID
+				}
+				// Phần chênh lệch ghi vào ngày lập hóa đơn, hoặc hôm nay nếu ngày đó đã chuyển số dư
+				if err := services.AdjustInvoiceRevenue(tx, invoice.AdminID, invoice.CreatedAt, priceDifference, 0); err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+				}
+				auditAfter["invoice"] = services.InvoiceAuditSnapshot(lockedInvoice)
+			}
+
+			if err := services.RecordAudit(tx, actor, services.AuditEntry{
+				Action:          services.AuditOrderModify,
+				EntityType:      "order",
+				EntityID:        order.ID,
+				AccommodationID: &order.AccommodationID,
+				AdminID:         &order.Accommodation.UserID,
+				Before:          auditBefore,
+				After:           auditAfter,
+			}); err != nil {
+				return err
+			}
+		}
+
+		beforeJSON, _ := json.Marshal(before)
+		afterJSON, _ := json.Marshal(toOrderSnapshot(order, newRoomIDs))
+		change = models.OrderChange{
+			OrderID:         order.ID,
+			ChangedBy:       currentUserID,
+			ChangedByRole:   currentUserRole,
+			Before:          beforeJSON,
+			After:           afterJSON,
+			PriceDifference: priceDifference,
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể ghi lịch sử sửa đơn"}
+		}
+
+		return nil
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể sửa đơn hàng", "detail": err.Error()})
+		return
+	}
+
+	rdb, redisErr := config.ConnectRedis()
+	if redisErr == nil {
+		if err := DeleteKeysByPattern(config.Ctx, rdb, "invoices:*"); err != nil {
+			fmt.Printf("Lỗi khi xóa các key con của invoices: %v\n", err)
+		}
+		_ = services.DeleteFromRedis(config.Ctx, rdb, "orders:all")
+		_ = services.DeleteFromRedis(config.Ctx, rdb, "accommodations:statuses")
+		_ = services.DeleteFromRedis(config.Ctx, rdb, "rooms:statuses")
+		if order.UserID != nil {
+			_ = services.DeleteFromRedis(config.Ctx, rdb, fmt.Sprintf("orders:all:user:%d", *order.UserID))
+		}
+		_ = services.DeleteFromRedis(config.Ctx, rdb, fmt.Sprintf("orders:all:user:%d", currentUserID))
+	}
+
+	order = models.Order{}
+	if err := config.DB.Preload("User").
+		Preload("Accommodation").
+		Preload("Room").
+		Preload("PriceItems", preloadOrderPriceItems).
+		Preload("Changes").
+		First(&order, request.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tải dữ liệu đơn hàng sau khi sửa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Sửa đơn hàng thành công", "data": gin.H{
+		"order":           toOrderDetailResponse(order),
+		"priceDifference": change.PriceDifference,
+		"change":          change,
+	}})
+}
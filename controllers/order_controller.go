@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"new/config"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderUserResponse struct {
@@ -35,6 +37,13 @@ type OrderUserResponse struct {
 	DiscountPrice    float64                    `json:"discountPrice"`    // Giá discount
 	TotalPrice       float64                    `json:"totalPrice"`
 	InvoiceCode      string                     `json:"invoiceCode"`
+	HoldExpiresAt    *time.Time                 `json:"holdExpiresAt,omitempty"`
+	PriceItems       []models.OrderPriceItem    `json:"priceItems"`
+	Changes          []models.OrderChange       `json:"changes,omitempty"`
+}
+
+func preloadOrderPriceItems(db *gorm.DB) *gorm.DB {
+	return db.Order("sort")
 }
 
 type OrderAccommodationResponse struct {
@@ -67,6 +76,16 @@ type CreateOrderRequest struct {
 	GuestPhone      string `json:"guestPhone,omitempty"`
 }
 
+// orderTxError mang mã HTTP và thông báo ra khỏi transaction đặt phòng để controller trả về client
+type orderTxError struct {
+	status int
+	mess   string
+}
+
+func (e *orderTxError) Error() string {
+	return e.mess
+}
+
 func convertToOrderAccommodationResponse(accommodation models.Accommodation) OrderAccommodationResponse {
 	return OrderAccommodationResponse{
 		ID:       accommodation.ID,
@@ -100,18 +119,10 @@ func ConvertDateToISOFormat(dateStr string) (time.Time, error) {
 }
 
 func GetOrders(c *gin.Context) {
-	// Lấy Authorization Header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	// Xử lý token
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	// Lấy người dùng đã xác thực
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -131,7 +142,8 @@ func GetOrders(c *gin.Context) {
 		baseTx := config.DB.Model(&models.Order{}).
 			Preload("Accommodation").
 			Preload("Room").
-			Preload("User")
+			Preload("User").
+			Preload("PriceItems", preloadOrderPriceItems)
 
 		// Áp dụng quyền truy cập
 		if currentUserRole == 2 {
@@ -139,14 +151,12 @@ func GetOrders(c *gin.Context) {
 			baseTx = baseTx.Where("orders.accommodation_id IN (?)",
 				config.DB.Model(&models.Accommodation{}).Select("id").Where("user_id = ?", currentUserID))
 		} else if currentUserRole == 3 {
-			// Receptionist: Lọc theo các chỗ ở thuộc về Admin của Receptionist
-			var adminID int
-			if err := config.DB.Model(&models.User{}).Select("admin_id").Where("id = ?", currentUserID).Scan(&adminID).Error; err != nil || adminID == 0 {
-				c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
-				return
-			}
+			// Receptionist: Lọc theo các chỗ ở được giao
 			baseTx = baseTx.Where("orders.accommodation_id IN (?)",
-				config.DB.Model(&models.Accommodation{}).Select("id").Where("user_id = ?", adminID))
+				services.PermittedAccommodations(currentUserID, services.PermAccommodationView))
+		} else if currentUserRole == 0 {
+			// Người dùng: chỉ đơn của mình
+			baseTx = baseTx.Where("orders.user_id = ?", currentUserID)
 		}
 
 		// Truy vấn tất cả đơn hàng từ DB
@@ -288,6 +298,7 @@ func GetOrders(c *gin.Context) {
 			SoldOutPrice:     order.SoldOutPrice,
 			DiscountPrice:    order.DiscountPrice,
 			TotalPrice:       order.TotalPrice,
+			PriceItems:       order.PriceItems,
 		}
 		orderResponses = append(orderResponses, orderResponse)
 	}
@@ -315,16 +326,28 @@ func CreateOrder(c *gin.Context) {
 	var userId *uint
 	var actor Actor
 
+	// Người dùng đã đăng nhập luôn đặt cho chính mình, userId trong body chỉ dùng cho khách chưa đăng nhập
+	var discountUserID uint
 	if authHeader != "" {
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		userID, _, err := GetUserIDFromToken(tokenString)
+		userID, _, err := currentUser(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		currentUserID = userID
+		discountUserID = userID
 
-		if err == nil {
-			currentUserID = userID
-		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		var userInfo models.User
+		if err := config.DB.Where("id = ?", userID).First(&userInfo).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy người dùng"})
 			return
 		}
+		userId = &userInfo.ID
+		actor = Actor{
+			Name:        userInfo.Name,
+			Email:       userInfo.Email,
+			PhoneNumber: userInfo.PhoneNumber,
+		}
 	} else {
 		if request.UserID != 0 {
 			currentUserID = request.UserID
@@ -365,20 +388,9 @@ func CreateOrder(c *gin.Context) {
 		}
 	}
 
-	checkInDate, err := time.Parse("02/01/2006", request.CheckInDate)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày nhận phòng không hợp lệ"})
-		return
-	}
-
-	if checkInDate.Before(time.Now()) {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày nhận phòng không được nhỏ hơn ngày hiện tại"})
-		return
-	}
-
-	checkOutDate, err := time.Parse("02/01/2006", request.CheckOutDate)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày trả phòng không hợp lệ"})
+	checkInDate, checkOutDate, numDays, mess := parseBookingDates(request.CheckInDate, request.CheckOutDate)
+	if mess != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": mess})
 		return
 	}
 
@@ -394,14 +406,6 @@ func CreateOrder(c *gin.Context) {
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
-	numDays := int(checkOutDate.Sub(checkInDate).Hours() / 24)
-	if numDays <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày trả phòng phải sau ngày nhận phòng"})
-		return
-	}
-
-	price := 0
-	soldOutPrice := 0.0
 
 	var accommodation models.Accommodation
 	if err := config.DB.First(&accommodation, request.AccommodationID).Error; err != nil {
@@ -409,158 +413,117 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	if accommodation.Type == 0 && len(order.RoomID) > 0 {
-		var rooms []models.Room
-		if err := config.DB.Where("room_id IN ?", order.RoomID).Find(&rooms).Error; err != nil || len(rooms) != len(order.RoomID) {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tìm thấy phòng"})
-			return
-		}
-
-		for _, room := range rooms {
-			if room.AccommodationID != request.AccommodationID {
-				c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "AccommodationID không hợp lệ"})
-				return
-			}
-
-			var roomStatus []models.RoomStatus
-			err := config.DB.Where("room_id = ? AND status = 1 AND ((from_date < ? AND to_date > ?) OR (from_date < ? AND to_date > ?))",
-				room.RoomId, checkOutDate, checkInDate, checkOutDate, checkInDate).Find(&roomStatus).Error
+	if len(request.RoomID) > 0 {
+		order.RoomID = request.RoomID
+	} else {
+		order.RoomID = []uint{}
+	}
 
-			if err != nil {
-				c.JSON(http.StatusCreated, gin.H{"code": 0, "mess": "Lỗi kiểm tra trạng thái phòng"})
-				return
-			}
+	// Đơn mới chỉ giữ chỗ trong một khoảng thời gian, quá hạn chưa xác nhận sẽ bị cron nhả ra
+	now := time.Now()
+	holdExpiresAt := now.Add(services.BookingHoldDuration())
+	order.HoldExpiresAt = &holdExpiresAt
+
+	// Toàn bộ việc kiểm tra phòng trống, tạo đơn và ghi trạng thái chạy trong một transaction.
+	// Các dòng phòng/chỗ ở được khóa FOR UPDATE nên hai yêu cầu đặt cùng phòng sẽ xếp hàng,
+	// yêu cầu sau chỉ kiểm tra trùng lịch khi yêu cầu trước đã commit hoặc rollback.
+	var notifications []models.Notification
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		quote, err := quoteBooking(tx, bookingQuoteInput{
+			Accommodation:   accommodation,
+			RoomIDs:         order.RoomID,
+			CheckInDate:     checkInDate,
+			CheckOutDate:    checkOutDate,
+			Nights:          numDays,
+			UserID:          discountUserID,
+			Now:             now,
+			Lock:            true,
+			ConsumeDiscount: true,
+		})
+		if err != nil {
+			return err
+		}
 
-			if len(roomStatus) > 0 {
-				c.JSON(http.StatusCreated, gin.H{"code": 0, "mess": "Phòng đã được đặt hoặc không khả dụng trong khoảng thời gian này"})
-				return
+		if len(quote.Conflicts) > 0 {
+			if accommodation.Type == 0 && len(order.RoomID) > 0 {
+				return &orderTxError{status: http.StatusConflict, mess: "Phòng đã được đặt hoặc không khả dụng trong khoảng thời gian này"}
 			}
-			price += room.Price * numDays
-
+			return &orderTxError{status: http.StatusConflict, mess: "Chỗ ở đã được đặt hoặc không khả dụng trong khoảng thời gian này"}
 		}
-	} else {
 
-		var accommodationStatus []models.AccommodationStatus
-		if err := config.DB.Where("accommodation_id = ? AND status = 1 AND ((from_date < ? AND to_date > ?) OR (from_date < ? AND to_date > ?))",
-			request.AccommodationID, checkOutDate, checkInDate, checkOutDate, checkInDate).Find(&accommodationStatus).Error; err != nil {
-			c.JSON(http.StatusCreated, gin.H{"code": 0, "mess": "Lỗi kiểm tra trạng thái chỗ ở"})
-			return
-		}
+		order.Price = quote.BasePrice
+		services.SummarizePriceLines(&order, quote.Lines)
 
-		if len(accommodationStatus) > 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Chỗ ở đã được đặt hoặc không khả dụng trong khoảng thời gian này"})
-			return
+		if err := tx.Create(&order).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tạo đơn"}
 		}
 
-		price = accommodation.Price * numDays
-	}
+		if accommodation.Type == 0 && len(order.RoomID) > 0 {
+			var roomsToAppend []models.Room
+			for _, roomID := range request.RoomID {
+				roomsToAppend = append(roomsToAppend, models.Room{RoomId: roomID})
+			}
 
-	order.Price = price
-	order.SoldOutPrice = soldOutPrice
+			if err := tx.Model(&order).Association("Room").Append(roomsToAppend); err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể liên kết phòng với đơn hàng"}
+			}
 
-	if request.UserID != 0 {
-		order.UserID = &request.UserID
-		isEligibleForDiscount := services.CheckUserEligibilityForDiscount(request.UserID)
-		if isEligibleForDiscount {
-			var user models.User
-			if err := config.DB.First(&user, request.UserID).Error; err == nil {
-				discountPrice, err := services.ApplyDiscountForUser(user)
-				if err != nil {
-					fmt.Println(err.Error())
-					return
+			for _, roomID := range request.RoomID {
+				roomStatus := models.RoomStatus{
+					RoomID:    roomID,
+					OrderID:   &order.ID,
+					Status:    models.StatusHold,
+					FromDate:  checkInDate,
+					ToDate:    checkOutDate,
+					ExpiresAt: &holdExpiresAt,
 				}
-				order.DiscountPrice = float64(price) * discountPrice / 100
-			} else {
-				fmt.Println("Không tìm thấy người dùng")
-				return
+				if err := tx.Create(&roomStatus).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật trạng thái phòng"}
+				}
+			}
+		} else {
+			accStatus := models.AccommodationStatus{
+				AccommodationID: request.AccommodationID,
+				OrderID:         &order.ID,
+				Status:          models.StatusHold,
+				FromDate:        checkInDate,
+				ToDate:          checkOutDate,
+				ExpiresAt:       &holdExpiresAt,
+			}
+			if err := tx.Create(&accStatus).Error; err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật trạng thái phòng"}
 			}
 		}
-	}
-
-	var holidays []models.Holiday
-	if err := config.DB.Find(&holidays).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy thông tin ngày lễ"})
-		return
-	}
 
-	holidayPrice := 0
-	for _, holiday := range holidays {
-		fromDate, err := time.Parse("02/01/2006", holiday.FromDate)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Ngày bắt đầu kỳ nghỉ không hợp lệ"})
-			return
+		// Email xác nhận được xếp hàng cùng đơn, gửi nền sau khi commit
+		if actor.Email != "" {
+			if err := services.SendOrderEmail(tx, actor.Email, order.ID, order.TotalPrice, order.CheckInDate, order.CheckOutDate); err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tạo email xác nhận đơn"}
+			}
 		}
 
-		toDate, err := time.Parse("02/01/2006", holiday.ToDate)
+		recipients, err := services.OrderRecipients(tx, accommodation.ID, accommodation.UserID, nil, currentUserID)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Ngày kết thúc kỳ nghỉ không hợp lệ"})
-			return
-		}
-
-		if (checkInDate.Before(toDate) && checkOutDate.After(fromDate)) ||
-			checkInDate.Equal(fromDate) ||
-			checkOutDate.Equal(toDate) {
-			holidayPrice += holiday.Price
-		}
-	}
-	order.HolidayPrice = float64(price*holidayPrice) / 100
-
-	numDaysToCheckIn := int(checkInDate.Sub(order.CreatedAt).Hours() / 24)
-
-	if numDaysToCheckIn <= 3 {
-		order.CheckInRushPrice = float64(price*5) / 100
-	} else {
-		order.CheckInRushPrice = 0
-	}
-
-	order.TotalPrice = float64(price) + order.HolidayPrice + order.CheckInRushPrice + order.SoldOutPrice - order.DiscountPrice
-
-	if len(request.RoomID) > 0 {
-		order.RoomID = request.RoomID
-	} else {
-		order.RoomID = []uint{}
-	}
-
-	if err := config.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo đơn", "detai": err})
-		return
-	}
-
-	if accommodation.Type == 0 && len(order.RoomID) > 0 {
-		var roomsToAppend []models.Room
-		for _, roomID := range request.RoomID {
-			roomsToAppend = append(roomsToAppend, models.Room{RoomId: roomID})
-		}
-
-		if err := config.DB.Model(&order).Association("Room").Append(roomsToAppend); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể liên kết phòng với đơn hàng", "detail": err})
-			return
-		}
-
-		for _, roomID := range request.RoomID {
-			roomStatus := models.RoomStatus{
-				RoomID:   roomID,
-				Status:   1,
-				FromDate: checkInDate,
-				ToDate:   checkOutDate,
-			}
-			if err := config.DB.Create(&roomStatus).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật trạng thái phòng", "detail": err})
-				return
-			}
+			return err
 		}
-	} else {
-		roomStatus := models.AccommodationStatus{
-			AccommodationID: request.AccommodationID,
-			Status:          1,
-			FromDate:        checkInDate,
-			ToDate:          checkOutDate,
-		}
-		if err := config.DB.Create(&roomStatus).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật trạng thái phòng", "detail": err})
+		notifications, err = services.CreateNotifications(tx, recipients, services.NotificationInput{
+			Type:    services.NotificationOrderCreated,
+			Title:   "Đơn đặt phòng mới",
+			Body:    fmt.Sprintf("Đơn #%d tại %s, từ %s đến %s.", order.ID, accommodation.Name, order.CheckInDate, order.CheckOutDate),
+			Payload: map[string]interface{}{"orderId": order.ID, "accommodationId": accommodation.ID},
+		})
+		return err
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
 			return
 		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo đơn", "detail": err.Error()})
+		return
 	}
+	services.PublishNotifications(notifications)
 
 	if err := config.DB.Preload("User").Preload("Accommodation").Preload("Room").First(&order, order.ID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tải dữ liệu đơn hàng sau khi tạo"})
@@ -593,18 +556,14 @@ func CreateOrder(c *gin.Context) {
 		Status:           order.Status,
 		CreatedAt:        order.CreatedAt,
 		UpdatedAt:        order.UpdatedAt,
-		Price:            price,
+		Price:            order.Price,
 		HolidayPrice:     order.HolidayPrice,
 		CheckInRushPrice: order.CheckInRushPrice,
 		SoldOutPrice:     order.SoldOutPrice,
 		DiscountPrice:    order.DiscountPrice,
 		TotalPrice:       order.TotalPrice,
-	}
-
-	if orderResponse.User.Email != "" {
-		if err := services.SendOrderEmail(orderResponse.User.Email, order.ID, order.TotalPrice, order.CheckInDate, order.CheckOutDate); err != nil {
-			fmt.Println("Gửi email không thành công:", err)
-		}
+		PriceItems:       order.PriceItems,
+		HoldExpiresAt:    order.HoldExpiresAt,
 	}
 
 	//Xóa redis
@@ -625,22 +584,16 @@ func CreateOrder(c *gin.Context) {
 
 func ChangeOrderStatus(c *gin.Context) {
 	type StatusUpdateRequest struct {
-		ID         uint    `json:"id"`
-		Status     int     `json:"status"`
-		PaidAmount float64 `json:"paidAmount"`
-	}
-
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
+		ID            uint    `json:"id"`
+		Status        int     `json:"status"`
+		PaidAmount    float64 `json:"paidAmount"`
+		PaymentMethod int     `json:"paymentMethod"`
+		Reason        string  `json:"reason"`
 	}
 
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -649,164 +602,233 @@ func ChangeOrderStatus(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
 		return
 	}
+	// Chỉ hỗ trợ xác nhận (1) và hủy (2), các trạng thái khác đi qua luồng giữ chỗ / thanh toán riêng
+	if req.Status != 1 && req.Status != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Trạng thái đơn hàng không hợp lệ"})
+		return
+	}
 
 	var order models.Order
 	if err := config.DB.
 		Preload("Accommodation.User").
+		Preload("Room").
 		First(&order, req.ID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Đơn hàng không tồn tại"})
 		return
 	}
 
-	timeSinceCreation := time.Since(order.CreatedAt).Hours()
+	// Khách (đã qua OwnOrder) chỉ được tự hủy đơn của mình; xác nhận đơn và ghi nhận tiền thu
+	// cần quyền quản lý đơn trên chỗ ở
+	canManage := services.Can(currentUserID, currentUserRole, services.PermOrderManage, order.AccommodationID)
+	if !canManage && (req.Status != 2 || req.PaidAmount > 0) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền cập nhật trạng thái đơn hàng này"})
+		return
+	}
 
-	if currentUserRole == 0 && req.Status == 2 {
-		if timeSinceCreation > 24 {
-			c.JSON(http.StatusAccepted, gin.H{"code": 0, "mess": "Liên hệ Admin để được hủy đơn"})
-			return
+	var refundPercent int
+	var refundAmount float64
+	var cancelled []models.Notification
+
+	// Trạng thái mới của đơn được lưu cùng nhật ký, trong cùng transaction với hóa đơn / hoàn tiền của từng nhánh
+	actor := services.AuditActorFromRequest(c)
+	previousStatus := order.Status
+	applyStatus := func(tx *gorm.DB) error {
+		order.Status = req.Status
+		order.UpdatedAt = time.Now()
+		if err := tx.Omit(clause.Associations).Save(&order).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể chuyển trạng thái đơn hàng"}
 		}
+
+		after := map[string]interface{}{"status": order.Status}
+		if req.Status == 2 {
+			after["refundPercent"] = refundPercent
+			after["refundAmount"] = refundAmount
+			after["reason"] = req.Reason
+		}
+		return services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:          services.AuditOrderStatusUpdate,
+			EntityType:      "order",
+			EntityID:        order.ID,
+			AccommodationID: &order.AccommodationID,
+			AdminID:         &order.Accommodation.UserID,
+			Before:          map[string]interface{}{"status": previousStatus},
+			After:           after,
+		})
 	}
 
 	if req.Status == 2 {
-		if order.Status == 1 {
-			var invoice models.Invoice
-			if err := config.DB.Where("order_id = ?", order.ID).First(&invoice).Error; err == nil {
-				// Xóa invoice
-				if err := config.DB.Delete(&invoice).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"code": 0,
-						"mess": "Lỗi khi xóa hóa đơn",
-						"data": err.Error(),
-					})
-					return
+		if order.Status == 2 {
+			c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Đơn hàng đã được hủy trước đó"})
+			return
+		}
+
+		checkInDate, err := time.ParseInLocation("02/01/2006", order.CheckInDate, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày nhận phòng của đơn không hợp lệ"})
+			return
+		}
+
+		// Số ngày theo lịch từ hôm nay tới ngày nhận phòng (hủy trong ngày nhận phòng = 0),
+		// làm tròn để ngày chuyển giờ mùa hè không lệch một ngày
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+		daysBeforeCheckIn := int(math.Round(checkInDate.Sub(today).Hours() / 24))
+		// Quá ngày nhận phòng chỉ nhân viên quản lý đơn của chỗ ở được hủy
+		if daysBeforeCheckIn < 0 && !canManage {
+			c.JSON(http.StatusAccepted, gin.H{"code": 0, "mess": "Liên hệ Admin để được hủy đơn"})
+			return
+		}
+
+		policy, err := getCancellationPolicy(config.DB, order.AccommodationID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy chính sách hủy"})
+			return
+		}
+		refundPercent = policy.RefundPercent(daysBeforeCheckIn)
+
+		err = config.DB.Transaction(func(tx *gorm.DB) error {
+			// Khóa đơn và đọc lại trạng thái để hai yêu cầu hủy đồng thời không cùng hoàn tiền, đảo doanh thu
+			var locked models.Order
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").First(&locked, order.ID).Error; err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể khóa đơn hàng"}
+			}
+			if locked.Status == 2 {
+				return &orderTxError{status: http.StatusConflict, mess: "Đơn hàng đã được hủy trước đó"}
+			}
+			order.Status, previousStatus = locked.Status, locked.Status
+
+			if order.Status == 1 {
+				var invoiceID uint
+				if err := tx.Model(&models.Invoice{}).Where("order_id = ?", order.ID).Select("id").Scan(&invoiceID).Error; err != nil || invoiceID == 0 {
+					return &orderTxError{status: http.StatusNotFound, mess: "Không tìm thấy invoice cho đơn hàng này"}
+				}
+				invoice, err := services.LockInvoice(tx, invoiceID)
+				if err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể khóa hóa đơn"}
+				}
+				if invoice.Status == 2 {
+					return &orderTxError{status: http.StatusConflict, mess: "Hóa đơn của đơn hàng đã được hủy trước đó"}
+				}
+				if err := services.RecalculateInvoice(tx, invoice); err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
 				}
 
-				today := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, time.Local)
+				// Hóa đơn được giữ lại làm lịch sử, chỉ chuyển sang trạng thái đã hủy
+				refundAmount = invoice.PaidAmount * float64(refundPercent) / 100
+				if err := tx.Model(invoice).Updates(map[string]interface{}{
+					"status":        2,
+					"refund_amount": refundAmount,
+				}).Error; err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi khi ghi nhận hoàn tiền cho hóa đơn"}
+				}
 
-				var userRevenue models.UserRevenue
-				if err := config.DB.Where("user_id = ? AND date = ?", invoice.AdminID, today).First(&userRevenue).Error; err == nil {
-					newRevenue := userRevenue.Revenue - invoice.TotalAmount
-					newOrderCount := userRevenue.OrderCount - 1
-					if newOrderCount < 0 {
-						newOrderCount = 0
+				if refundAmount > 0 {
+					refund := models.Refund{
+						InvoiceID: invoice.ID,
+						OrderID:   order.ID,
+						AdminID:   invoice.AdminID,
+						Amount:    refundAmount,
+						Percent:   refundPercent,
+						Reason:    req.Reason,
+						Status:    models.RefundPending,
+						CreatedBy: currentUserID,
 					}
-
-					if err := config.DB.Model(&userRevenue).Updates(map[string]interface{}{
-						"revenue":     newRevenue,
-						"order_count": newOrderCount,
-					}).Error; err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{
-							"code": 0,
-							"mess": "Lỗi khi cập nhật doanh thu người dùng sau xóa hóa đơn",
-							"data": err.Error(),
-						})
-						return
+					if err := tx.Create(&refund).Error; err != nil {
+						return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tạo yêu cầu hoàn tiền"}
 					}
-				} else {
-
-					c.JSON(http.StatusNotFound, gin.H{
-						"code": 0,
-						"mess": "Không tìm thấy doanh thu người dùng trong ngày",
-						"data": nil,
-					})
-					return
 				}
-			} else {
 
-				c.JSON(http.StatusNotFound, gin.H{
-					"code": 0,
-					"mess": "Không tìm thấy invoice cho đơn hàng này",
-					"data": nil,
-				})
-				return
+				// Đảo ngược doanh thu của hóa đơn, chỉ giữ lại phần đã thu mà không phải hoàn (phí hủy);
+				// ngày lập hóa đơn đã chuyển số dư thì phần trừ được ghi vào hôm nay
+				retained := invoice.PaidAmount - refundAmount
+				if err := services.AdjustInvoiceRevenue(tx, invoice.AdminID, invoice.CreatedAt, retained-invoice.TotalAmount, -1); err != nil {
+					return &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi khi cập nhật doanh thu người dùng sau khi hủy hóa đơn"}
+				}
 			}
-		}
 
-		if len(order.RoomID) > 0 {
-			for _, room := range order.Room {
-				var roomStatus models.RoomStatus
-				if err := config.DB.Where("room_id = ? AND status = ?", room.RoomId, 1).First(&roomStatus).Error; err == nil {
-					roomStatus.Status = 0
-					if err := config.DB.Save(&roomStatus).Error; err != nil {
-						c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật trạng thái phòng"})
-						return
-					}
-				}
+			if err := services.ReleaseOrderStatuses(tx, order); err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
 			}
-		} else {
-			var accommodationStatus models.AccommodationStatus
-			if err := config.DB.Where("accommodation_id = ? AND status = ?", order.AccommodationID, 1).First(&accommodationStatus).Error; err == nil {
-				accommodationStatus.Status = 0
-				if err := config.DB.Save(&accommodationStatus).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật trạng thái accommodation"})
-					return
-				}
+			order.HoldExpiresAt = nil
+			if err := applyStatus(tx); err != nil {
+				return err
 			}
 
+			recipients, err := services.OrderRecipients(tx, order.AccommodationID, order.Accommodation.UserID, order.UserID, currentUserID)
+			if err != nil {
+				return err
+			}
+			body := fmt.Sprintf("Đơn #%d tại %s đã bị hủy.", order.ID, order.Accommodation.Name)
+			if req.Reason != "" {
+				body += " Lý do: " + req.Reason
+			}
+			cancelled, err = services.CreateNotifications(tx, recipients, services.NotificationInput{
+				Type:    services.NotificationOrderCancelled,
+				Title:   "Đơn đặt phòng đã bị hủy",
+				Body:    body,
+				Payload: map[string]interface{}{"orderId": order.ID, "accommodationId": order.AccommodationID, "refundAmount": refundAmount},
+			})
+			return err
+		})
+		if err != nil {
+			var txErr *orderTxError
+			if errors.As(err, &txErr) {
+				c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess, "data": nil})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể hủy đơn hàng", "data": err.Error()})
+			return
 		}
 	}
 
 	if req.Status == 1 {
-		var existingInvoice models.Invoice
-		if err := config.DB.Where("order_id = ?", order.ID).First(&existingInvoice).Error; err == nil {
-			c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Hóa đơn đã tồn tại cho đơn hàng này"})
+		if order.Status == 2 {
+			c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Đơn hàng đã bị hủy hoặc đã hết thời gian giữ chỗ"})
 			return
 		}
 
-		var Remaining = order.TotalPrice - req.PaidAmount
-
-		invoice := models.Invoice{
-			OrderID:         order.ID,
-			TotalAmount:     order.TotalPrice,
-			PaidAmount:      req.PaidAmount,
-			RemainingAmount: Remaining,
-			AdminID:         order.Accommodation.UserID,
-		}
-
-		if err := config.DB.Create(&invoice).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi tạo hóa đơn"})
+		var existingInvoice models.Invoice
+		if err := config.DB.Where("order_id = ?", order.ID).First(&existingInvoice).Error; err == nil {
+			c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Hóa đơn đã tồn tại cho đơn hàng này"})
 			return
 		}
 
-		today := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day(), 0, 0, 0, 0, time.Local)
-
-		var userRevenue models.UserRevenue
-		if err := config.DB.Where("user_id = ? AND date = ?", invoice.AdminID, today).First(&userRevenue).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-
-				newUserRevenue := models.UserRevenue{
-					UserID:     invoice.AdminID,
-					Date:       today,
-					Revenue:    invoice.TotalAmount,
-					OrderCount: 1,
-				}
-				if err := config.DB.Create(&newUserRevenue).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi tạo doanh thu người dùng"})
-					return
+		// Giữ chỗ, hóa đơn, doanh thu trong ngày lập hóa đơn và số tiền thu khi xác nhận (đặt cọc,
+		// ghi thành khoản đầu tiên trong sổ thanh toán) được ghi cùng một transaction
+		err := config.DB.Transaction(func(tx *gorm.DB) error {
+			invoice, err := services.ConfirmOrder(tx, &order, order.Accommodation.UserID)
+			if err != nil {
+				return err
+			}
+			if req.PaidAmount > 0 {
+				if err := services.RecordInvoicePayment(tx, invoice, &models.InvoicePayment{
+					Amount:  req.PaidAmount,
+					Method:  req.PaymentMethod,
+					PaidAt:  time.Now(),
+					StaffID: &currentUserID,
+				}); err != nil {
+					return err
 				}
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi truy vấn doanh thu người dùng"})
+			}
+			return applyStatus(tx)
+		})
+		if err != nil {
+			var txErr *orderTxError
+			if errors.As(err, &txErr) {
+				c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
 				return
 			}
-		} else {
-
-			if err := config.DB.Model(&userRevenue).Updates(map[string]interface{}{
-				"revenue":     userRevenue.Revenue + invoice.TotalAmount,
-				"order_count": userRevenue.OrderCount + 1,
-			}).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi cập nhật doanh thu người dùng"})
+			if errors.Is(err, services.ErrHoldExpired) {
+				c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": err.Error()})
 				return
 			}
+			if errors.Is(err, services.ErrPaymentExceedsRemaining) {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi tạo hóa đơn", "data": err.Error()})
+			return
 		}
-
-	}
-
-	order.Status = req.Status
-	order.UpdatedAt = time.Now()
-
-	if err := config.DB.Save(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể chuyển trạng thái đơn hàng"})
-		return
 	}
 
 	rdb, redisErr := config.ConnectRedis()
@@ -825,24 +847,25 @@ func ChangeOrderStatus(c *gin.Context) {
 		_ = services.DeleteFromRedis(config.Ctx, rdb, "accommodations:statuses")
 		_ = services.DeleteFromRedis(config.Ctx, rdb, "rooms:statuses")
 		_ = services.DeleteFromRedis(config.Ctx, rdb, cacheKeyUser)
+		if order.UserID != nil {
+			_ = services.DeleteFromRedis(config.Ctx, rdb, fmt.Sprintf("orders:all:user:%d", *order.UserID))
+		}
+	}
+
+	if req.Status == 2 {
+		services.PublishNotifications(cancelled)
+		c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Trạng thái đơn hàng đã được cập nhật", "data": gin.H{
+			"refundPercent": refundPercent,
+			"refundAmount":  refundAmount,
+		}})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Trạng thái đơn hàng đã được cập nhật"})
 }
 
-func GetOrderDetail(c *gin.Context) {
-	orderId := c.Param("id")
-
-	var order models.Order
-	if err := config.DB.Preload("User").
-		Preload("Accommodation").
-		Preload("Room").
-		Where("id = ?", orderId).
-		First(&order).Error; err != nil {
-
-		c.JSON(http.StatusNotFound, gin.H{"code": 0, "error": "Không tìm thấy Order"})
-		return
-	}
+// toOrderDetailResponse chuyển đơn đã preload User, Accommodation, Room, PriceItems sang dữ liệu trả về
+func toOrderDetailResponse(order models.Order) OrderUserResponse {
 	var user Actor
 	if order.UserID != nil {
 		user = Actor{Name: order.User.Name, Email: order.User.Email, PhoneNumber: order.User.PhoneNumber}
@@ -857,7 +880,7 @@ func GetOrderDetail(c *gin.Context) {
 		roomResponse := convertToOrderRoomResponse(room)
 		roomResponses = append(roomResponses, roomResponse)
 	}
-	orderResponse := OrderUserResponse{
+	return OrderUserResponse{
 		ID:               order.ID,
 		User:             user,
 		Accommodation:    accommodationResponse,
@@ -873,22 +896,35 @@ func GetOrderDetail(c *gin.Context) {
 		SoldOutPrice:     order.SoldOutPrice,
 		DiscountPrice:    order.DiscountPrice,
 		TotalPrice:       order.TotalPrice,
+		PriceItems:       order.PriceItems,
+		HoldExpiresAt:    order.HoldExpiresAt,
+		Changes:          order.Changes,
 	}
-	c.JSON(http.StatusOK, gin.H{"code": 1, "data": orderResponse})
 }
 
-func GetOrdersByUserId(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
+func GetOrderDetail(c *gin.Context) {
+	orderId := c.Param("id")
+
+	var order models.Order
+	if err := config.DB.Preload("User").
+		Preload("Accommodation").
+		Preload("Room").
+		Preload("PriceItems", preloadOrderPriceItems).
+		Preload("Changes").
+		Where("id = ?", orderId).
+		First(&order).Error; err != nil {
+
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "error": "Không tìm thấy Order"})
 		return
 	}
+	orderResponse := toOrderDetailResponse(order)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "data": orderResponse})
+}
 
-	// Xử lý token
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, _, err := GetUserIDFromToken(tokenString)
+func GetOrdersByUserId(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -946,6 +982,7 @@ func GetOrdersByUserId(c *gin.Context) {
 	result := config.DB.Preload("User").
 		Preload("Accommodation").
 		Preload("Room").
+		Preload("PriceItems", preloadOrderPriceItems).
 		Where("user_id = ?", currentUserID).
 		Order("created_at DESC").
 		Offset(page * limit).
@@ -1001,6 +1038,7 @@ func GetOrdersByUserId(c *gin.Context) {
 			SoldOutPrice:     order.SoldOutPrice,
 			DiscountPrice:    order.DiscountPrice,
 			TotalPrice:       order.TotalPrice,
+			PriceItems:       order.PriceItems,
 			InvoiceCode:      invoiceCode,
 		}
 		orderResponses = append(orderResponses, orderResponse)
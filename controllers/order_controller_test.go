@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupCancelDB bổ sung các bảng mà luồng hủy đơn ghi vào: chính sách hủy, hoàn tiền, thông báo và phân quyền
+func setupCancelDB(t *testing.T) {
+	t.Helper()
+	setupPaymentDB(t)
+	if err := config.DB.AutoMigrate(
+		&models.Room{}, &models.CancellationPolicy{}, &models.Refund{}, &models.Notification{},
+		&models.Permission{}, &models.Role{}, &models.RoleAssignment{},
+	); err != nil {
+		t.Fatalf("không tạo được bảng: %v", err)
+	}
+}
+
+// seedConfirmedOrder tạo đơn đã xác nhận nhận phòng sau checkInIn ngày, hóa đơn 1000000 lập lúc invoicedAt
+// đã thu 400000, cùng dòng doanh thu của ngày lập hóa đơn. Chỗ ở dùng chính sách hủy moderate.
+func seedConfirmedOrder(t *testing.T, checkInIn int, invoicedAt time.Time) (models.Order, models.Invoice) {
+	t.Helper()
+	owner := models.User{Name: "Chủ nhà", Email: "owner@example.com", PhoneNumber: "0900000001", Role: 2}
+	if err := config.DB.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	accommodation := models.Accommodation{Name: "Homestay", UserID: owner.ID}
+	if err := config.DB.Omit("User").Create(&accommodation).Error; err != nil {
+		t.Fatal(err)
+	}
+	policy := models.CancellationPolicy{AccommodationID: accommodation.ID, Type: models.PolicyModerate}
+	if err := config.DB.Create(&policy).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	checkIn := time.Date(now.Year(), now.Month(), now.Day()+checkInIn, 0, 0, 0, 0, time.Local)
+	checkOut := checkIn.AddDate(0, 0, 2)
+	order := models.Order{
+		AccommodationID: accommodation.ID,
+		CheckInDate:     checkIn.Format("02/01/2006"),
+		CheckOutDate:    checkOut.Format("02/01/2006"),
+		TotalPrice:      1000000,
+		Status:          1,
+	}
+	if err := config.DB.Omit("Accommodation", "User").Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	booked := models.AccommodationStatus{
+		AccommodationID: accommodation.ID,
+		OrderID:         &order.ID,
+		FromDate:        checkIn,
+		ToDate:          checkOut,
+		Status:          models.StatusBooked,
+	}
+	if err := config.DB.Create(&booked).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	invoice := models.Invoice{
+		OrderID:         order.ID,
+		TotalAmount:     1000000,
+		PaidAmount:      400000,
+		RemainingAmount: 600000,
+		AdminID:         owner.ID,
+		CreatedAt:       invoicedAt,
+	}
+	if err := config.DB.Omit("Order", "Payments").Create(&invoice).Error; err != nil {
+		t.Fatal(err)
+	}
+	payment := models.InvoicePayment{InvoiceID: invoice.ID, Amount: 400000, PaidAt: invoicedAt}
+	if err := config.DB.Create(&payment).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := services.AddUserRevenue(config.DB, owner.ID, invoicedAt, invoice.TotalAmount, 1); err != nil {
+		t.Fatal(err)
+	}
+	return order, invoice
+}
+
+// callAsSuperAdmin gọi handler với body JSON và quyền superadmin
+func callAsSuperAdmin(t *testing.T, handler gin.HandlerFunc, payload gin.H) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	body, _ := json.Marshal(payload)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Set(services.ClaimsContextKey, &services.Claims{UserInfo: services.UserInfo{UserId: 9999, Role: 1}})
+	handler(c)
+	return w
+}
+
+func cancelOrder(t *testing.T, orderID uint) *httptest.ResponseRecorder {
+	t.Helper()
+	return callAsSuperAdmin(t, ChangeOrderStatus, gin.H{"id": orderID, "status": 2, "reason": "Khách đổi lịch"})
+}
+
+func revenueOn(t *testing.T, userID uint, day time.Time) models.UserRevenue {
+	t.Helper()
+	var revenue models.UserRevenue
+	config.DB.Where("user_id = ? AND date = ?", userID, services.RevenueDay(day)).Limit(1).Find(&revenue)
+	return revenue
+}
+
+func TestCancelOrderRefundsByPolicyAndReversesRevenue(t *testing.T) {
+	setupCancelDB(t)
+	// Còn 3 ngày trước ngày nhận phòng: chính sách moderate hoàn 50% số đã thu
+	order, invoice := seedConfirmedOrder(t, 3, time.Now())
+
+	if w := cancelOrder(t, order.ID); w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), muốn %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+
+	var refund models.Refund
+	if err := config.DB.Where("order_id = ?", order.ID).First(&refund).Error; err != nil {
+		t.Fatalf("không có yêu cầu hoàn tiền: %v", err)
+	}
+	if refund.Amount != 200000 || refund.Percent != 50 || refund.Status != models.RefundPending {
+		t.Fatalf("hoàn tiền = %.0f (%d%%, trạng thái %d), muốn 200000 (50%%, chờ xử lý)", refund.Amount, refund.Percent, refund.Status)
+	}
+
+	config.DB.First(&invoice, invoice.ID)
+	if invoice.Status != 2 || invoice.RefundAmount != 200000 || invoice.PaidAmount != 400000 {
+		t.Fatalf("hóa đơn chưa chuyển sang đã hủy: %+v", invoice)
+	}
+
+	// Doanh thu chỉ giữ lại phí hủy: 1000000 + (400000 - 200000 - 1000000) = 200000
+	revenue := revenueOn(t, invoice.AdminID, time.Now())
+	if revenue.Revenue != 200000 || revenue.OrderCount != 0 {
+		t.Fatalf("doanh thu = %.0f (%d đơn), muốn 200000 (0 đơn)", revenue.Revenue, revenue.OrderCount)
+	}
+
+	var hold models.AccommodationStatus
+	config.DB.Where("order_id = ?", order.ID).First(&hold)
+	if hold.Status != models.StatusAvailable {
+		t.Fatalf("lịch của đơn chưa được nhả: status %d", hold.Status)
+	}
+
+	// Hủy lần hai không hoàn tiền hay đảo doanh thu thêm lần nữa
+	if w := cancelOrder(t, order.ID); w.Code != http.StatusConflict {
+		t.Fatalf("hủy lần hai: status = %d, muốn %d", w.Code, http.StatusConflict)
+	}
+	var refunds int64
+	config.DB.Model(&models.Refund{}).Where("order_id = ?", order.ID).Count(&refunds)
+	if refunds != 1 {
+		t.Fatalf("có %d yêu cầu hoàn tiền, muốn 1", refunds)
+	}
+	if again := revenueOn(t, invoice.AdminID, time.Now()); again.Revenue != revenue.Revenue {
+		t.Fatalf("doanh thu sau khi hủy lần hai = %.0f, muốn %.0f", again.Revenue, revenue.Revenue)
+	}
+}
+
+func TestCancelOrderOnPaidOutDayAdjustsToday(t *testing.T) {
+	setupCancelDB(t)
+	// Hóa đơn lập hôm qua (doanh thu đã chuyển số dư), hủy sát ngày nhận phòng nên không được hoàn tiền
+	yesterday := time.Now().AddDate(0, 0, -1)
+	order, invoice := seedConfirmedOrder(t, 0, yesterday)
+
+	if w := cancelOrder(t, order.ID); w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), muốn %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+
+	var refunds int64
+	config.DB.Model(&models.Refund{}).Where("order_id = ?", order.ID).Count(&refunds)
+	if refunds != 0 {
+		t.Fatalf("có %d yêu cầu hoàn tiền, muốn 0", refunds)
+	}
+
+	// Ngày lập hóa đơn giữ nguyên số tiền đã chuyển, chỉ bớt số đơn
+	previous := revenueOn(t, invoice.AdminID, yesterday)
+	if previous.Revenue != 1000000 || previous.OrderCount != 0 {
+		t.Fatalf("doanh thu hôm qua = %.0f (%d đơn), muốn 1000000 (0 đơn)", previous.Revenue, previous.OrderCount)
+	}
+	// Phần chưa thu được trừ vào hôm nay: 400000 - 0 - 1000000
+	today := revenueOn(t, invoice.AdminID, time.Now())
+	if today.Revenue != -600000 || today.OrderCount != 0 {
+		t.Fatalf("doanh thu hôm nay = %.0f (%d đơn), muốn -600000 (0 đơn)", today.Revenue, today.OrderCount)
+	}
+}
+
+func TestRejectRefundRestoresInvoiceAndRevenue(t *testing.T) {
+	setupCancelDB(t)
+	order, invoice := seedConfirmedOrder(t, 3, time.Now())
+	if w := cancelOrder(t, order.ID); w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), muốn %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+	var refund models.Refund
+	if err := config.DB.Where("order_id = ?", order.ID).First(&refund).Error; err != nil {
+		t.Fatalf("không có yêu cầu hoàn tiền: %v", err)
+	}
+
+	reject := gin.H{"id": refund.ID, "status": models.RefundRejected, "reason": "Khách không đủ điều kiện"}
+	if w := callAsSuperAdmin(t, UpdateRefundStatus, reject); w.Code != http.StatusOK {
+		t.Fatalf("status = %d (%s), muốn %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+
+	config.DB.First(&invoice, invoice.ID)
+	if invoice.Status != 2 || invoice.RefundAmount != 0 {
+		t.Fatalf("hóa đơn vẫn còn nợ hoàn tiền: trạng thái %d, hoàn %.0f", invoice.Status, invoice.RefundAmount)
+	}
+	// Từ chối hoàn thì admin giữ toàn bộ số đã thu: 200000 + 200000 = 400000
+	revenue := revenueOn(t, invoice.AdminID, time.Now())
+	if revenue.Revenue != 400000 {
+		t.Fatalf("doanh thu = %.0f, muốn 400000", revenue.Revenue)
+	}
+
+	// Khoản đã xử lý không được xử lý lại
+	if w := callAsSuperAdmin(t, UpdateRefundStatus, reject); w.Code != http.StatusConflict {
+		t.Fatalf("xử lý lần hai: status = %d, muốn %d", w.Code, http.StatusConflict)
+	}
+	if again := revenueOn(t, invoice.AdminID, time.Now()); again.Revenue != 400000 {
+		t.Fatalf("doanh thu sau khi xử lý lần hai = %.0f, muốn 400000", again.Revenue)
+	}
+}
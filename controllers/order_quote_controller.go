@@ -0,0 +1,275 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BookingConflict là một lịch đặt/giữ chỗ đang chiếm khoảng ngày yêu cầu
+type BookingConflict struct {
+	RoomID          *uint  `json:"roomId,omitempty"`
+	AccommodationID uint   `json:"accommodationId"`
+	FromDate        string `json:"fromDate"`
+	ToDate          string `json:"toDate"`
+	Status          int    `json:"status"`
+}
+
+// BookingRate là giá từng đêm của một phòng hoặc cả chỗ ở trong đơn
+type BookingRate struct {
+	RoomID          *uint                 `json:"roomId,omitempty"`
+	AccommodationID uint                  `json:"accommodationId"`
+	Nights          []services.NightPrice `json:"nights"`
+	Subtotal        int                   `json:"subtotal"`
+}
+
+// bookingQuoteInput là dữ liệu đầu vào dùng chung cho tạo đơn và báo giá
+type bookingQuoteInput struct {
+	Accommodation models.Accommodation
+	RoomIDs       []uint
+	CheckInDate   time.Time
+	CheckOutDate  time.Time
+	Nights        int
+	UserID        uint
+	Now           time.Time
+	// Lock khóa FOR UPDATE các dòng phòng/chỗ ở, chỉ dùng khi đặt thật trong transaction
+	Lock bool
+	// ConsumeDiscount ghi nhận lượt dùng mã giảm giá, báo giá chỉ xem trước nên không ghi
+	ConsumeDiscount bool
+	// DiscountPercent khác nil thì dùng đúng % này thay vì chọn mã mới (khi sửa đơn đã có giảm giá)
+	DiscountPercent *float64
+}
+
+// bookingQuote là kết quả kiểm tra phòng trống và tính giá cho một yêu cầu đặt
+type bookingQuote struct {
+	BasePrice int
+	Rates     []BookingRate
+	Lines     []services.PriceLine
+	Conflicts []BookingConflict
+}
+
+// quoteBooking kiểm tra lịch trống và tính giá theo đúng logic của CreateOrder.
+// Các lịch bị trùng được gom vào Conflicts thay vì dừng ngay, để báo giá trả đủ cho client.
+func quoteBooking(tx *gorm.DB, in bookingQuoteInput) (*bookingQuote, error) {
+	quote := &bookingQuote{Conflicts: []BookingConflict{}}
+	dateFormat := "02/01/2006"
+
+	if in.Accommodation.Type == 0 && len(in.RoomIDs) > 0 {
+		roomIDs := append([]uint(nil), in.RoomIDs...)
+		sort.Slice(roomIDs, func(i, j int) bool { return roomIDs[i] < roomIDs[j] })
+
+		query := tx
+		if in.Lock {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var rooms []models.Room
+		if err := query.Where("room_id IN ?", roomIDs).
+			Order("room_id").
+			Find(&rooms).Error; err != nil || len(rooms) != len(in.RoomIDs) {
+			return nil, &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tìm thấy phòng"}
+		}
+
+		for _, room := range rooms {
+			if room.AccommodationID != in.Accommodation.ID {
+				return nil, &orderTxError{status: http.StatusBadRequest, mess: "AccommodationID không hợp lệ"}
+			}
+
+			var roomStatus []models.RoomStatus
+			if err := tx.Scopes(services.BlockingStatusScope(in.Now)).
+				Where("room_id = ? AND from_date < ? AND to_date > ?", room.RoomId, in.CheckOutDate, in.CheckInDate).
+				Find(&roomStatus).Error; err != nil {
+				return nil, &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi kiểm tra trạng thái phòng"}
+			}
+			for _, status := range roomStatus {
+				roomID := status.RoomID
+				quote.Conflicts = append(quote.Conflicts, BookingConflict{
+					RoomID:          &roomID,
+					AccommodationID: room.AccommodationID,
+					FromDate:        status.FromDate.Format(dateFormat),
+					ToDate:          status.ToDate.Format(dateFormat),
+					Status:          status.Status,
+				})
+			}
+
+			nights, err := services.NightlyPrices(tx, services.RoomRateTarget(room), in.CheckInDate, in.CheckOutDate)
+			if err != nil {
+				return nil, &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+			}
+			roomID := room.RoomId
+			subtotal := services.SumNightlyPrices(nights)
+			quote.Rates = append(quote.Rates, BookingRate{RoomID: &roomID, AccommodationID: room.AccommodationID, Nights: nights, Subtotal: subtotal})
+			quote.BasePrice += subtotal
+		}
+	} else {
+		if in.Lock {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				First(&models.Accommodation{}, in.Accommodation.ID).Error; err != nil {
+				return nil, &orderTxError{status: http.StatusInternalServerError, mess: "Không thể tìm thấy thông tin chỗ ở"}
+			}
+		}
+
+		var accommodationStatus []models.AccommodationStatus
+		if err := tx.Scopes(services.BlockingStatusScope(in.Now)).
+			Where("accommodation_id = ? AND from_date < ? AND to_date > ?", in.Accommodation.ID, in.CheckOutDate, in.CheckInDate).
+			Find(&accommodationStatus).Error; err != nil {
+			return nil, &orderTxError{status: http.StatusInternalServerError, mess: "Lỗi kiểm tra trạng thái chỗ ở"}
+		}
+		for _, status := range accommodationStatus {
+			quote.Conflicts = append(quote.Conflicts, BookingConflict{
+				AccommodationID: status.AccommodationID,
+				FromDate:        status.FromDate.Format(dateFormat),
+				ToDate:          status.ToDate.Format(dateFormat),
+				Status:          status.Status,
+			})
+		}
+
+		nights, err := services.NightlyPrices(tx, services.AccommodationRateTarget(in.Accommodation), in.CheckInDate, in.CheckOutDate)
+		if err != nil {
+			return nil, &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+		}
+		subtotal := services.SumNightlyPrices(nights)
+		quote.Rates = append(quote.Rates, BookingRate{AccommodationID: in.Accommodation.ID, Nights: nights, Subtotal: subtotal})
+		quote.BasePrice = subtotal
+	}
+
+	discountPercent := 0.0
+	if in.DiscountPercent != nil {
+		discountPercent = *in.DiscountPercent
+	} else if in.UserID != 0 && services.CheckUserEligibilityForDiscount(in.UserID) {
+		var user models.User
+		if err := tx.First(&user, in.UserID).Error; err != nil {
+			return nil, &orderTxError{status: http.StatusNotFound, mess: "Không tìm thấy người dùng"}
+		}
+		if in.ConsumeDiscount {
+			percent, err := services.ApplyDiscountForUser(tx, user)
+			if err != nil {
+				return nil, &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+			}
+			discountPercent = percent
+		} else {
+			discount, err := services.FindDiscountForUser(tx, user)
+			if err != nil {
+				return nil, &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+			}
+			discountPercent = float64(discount.Discount)
+		}
+	}
+
+	lines, err := services.CalculatePrice(tx, &services.PricingContext{
+		Accommodation:   in.Accommodation,
+		RoomIDs:         in.RoomIDs,
+		BasePrice:       quote.BasePrice,
+		CheckInDate:     in.CheckInDate,
+		CheckOutDate:    in.CheckOutDate,
+		Nights:          in.Nights,
+		BookedAt:        in.Now,
+		DiscountPercent: discountPercent,
+	})
+	if err != nil {
+		return nil, &orderTxError{status: http.StatusInternalServerError, mess: err.Error()}
+	}
+	quote.Lines = lines
+
+	return quote, nil
+}
+
+// parseBookingDates kiểm tra ngày nhận/trả phòng của yêu cầu đặt, trả về thông báo lỗi nếu không hợp lệ
+func parseBookingDates(checkIn, checkOut string) (time.Time, time.Time, int, string) {
+	checkInDate, err := time.Parse("02/01/2006", checkIn)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, "Ngày nhận phòng không hợp lệ"
+	}
+
+	if checkInDate.Before(time.Now()) {
+		return time.Time{}, time.Time{}, 0, "Ngày nhận phòng không được nhỏ hơn ngày hiện tại"
+	}
+
+	checkOutDate, err := time.Parse("02/01/2006", checkOut)
+	if err != nil {
+		return time.Time{}, time.Time{}, 0, "Ngày trả phòng không hợp lệ"
+	}
+
+	numDays := int(checkOutDate.Sub(checkInDate).Hours() / 24)
+	if numDays <= 0 {
+		return time.Time{}, time.Time{}, 0, "Ngày trả phòng phải sau ngày nhận phòng"
+	}
+
+	return checkInDate, checkOutDate, numDays, ""
+}
+
+// QuoteOrder chạy thử kiểm tra phòng trống và tính giá như khi tạo đơn nhưng không lưu gì,
+// không ghi nhận lượt dùng mã giảm giá và không gửi email
+func QuoteOrder(c *gin.Context) {
+	var request CreateOrderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	checkInDate, checkOutDate, numDays, mess := parseBookingDates(request.CheckInDate, request.CheckOutDate)
+	if mess != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": mess})
+		return
+	}
+
+	var accommodation models.Accommodation
+	if err := config.DB.First(&accommodation, request.AccommodationID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không thể tìm thấy thông tin chỗ ở"})
+		return
+	}
+
+	// Giảm giá chỉ tính cho người đang đăng nhập, bỏ qua userId trong body để không dò được mã giảm giá của người khác
+	var userID uint
+	if claims, err := services.AuthenticateRequest(c); err == nil {
+		userID = claims.UserInfo.UserId
+	}
+
+	quote, err := quoteBooking(config.DB, bookingQuoteInput{
+		Accommodation: accommodation,
+		RoomIDs:       request.RoomID,
+		CheckInDate:   checkInDate,
+		CheckOutDate:  checkOutDate,
+		Nights:        numDays,
+		UserID:        userID,
+		Now:           time.Now(),
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể báo giá", "detail": err.Error()})
+		return
+	}
+
+	// Dùng một Order tạm để gom giá giống hệt đơn thật, không lưu xuống DB
+	order := models.Order{Price: quote.BasePrice}
+	services.SummarizePriceLines(&order, quote.Lines)
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Báo giá thành công", "data": gin.H{
+		"accommodationId":  accommodation.ID,
+		"roomId":           request.RoomID,
+		"checkInDate":      request.CheckInDate,
+		"checkOutDate":     request.CheckOutDate,
+		"nights":           numDays,
+		"available":        len(quote.Conflicts) == 0,
+		"conflicts":        quote.Conflicts,
+		"rates":            quote.Rates,
+		"price":            order.Price,
+		"holidayPrice":     order.HolidayPrice,
+		"checkInRushPrice": order.CheckInRushPrice,
+		"soldOutPrice":     order.SoldOutPrice,
+		"discountPrice":    order.DiscountPrice,
+		"totalPrice":       order.TotalPrice,
+		"priceItems":       order.PriceItems,
+	}})
+}
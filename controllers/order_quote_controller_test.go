@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// setupQuoteDB bổ sung các bảng phòng và bảng giá mà quoteBooking đọc khi tính giá
+func setupQuoteDB(t *testing.T) {
+	t.Helper()
+	setupPaymentDB(t)
+	if err := config.DB.AutoMigrate(
+		&models.Room{}, &models.DailyRate{}, &models.SeasonalRate{},
+		&models.PricingRule{}, &models.Holiday{},
+	); err != nil {
+		t.Fatalf("không tạo được bảng: %v", err)
+	}
+}
+
+// seedQuoteRooms tạo chỗ ở loại phòng với hai phòng giá 300000 mỗi đêm
+func seedQuoteRooms(t *testing.T) (models.Accommodation, []models.Room) {
+	t.Helper()
+	owner := models.User{Name: "Chủ nhà", Email: "owner@example.com", PhoneNumber: "0900000001", Role: 2}
+	if err := config.DB.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	accommodation := models.Accommodation{Name: "Khách sạn", UserID: owner.ID}
+	if err := config.DB.Omit("User").Create(&accommodation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rooms := []models.Room{
+		{AccommodationID: accommodation.ID, RoomName: "101", Price: 300000},
+		{AccommodationID: accommodation.ID, RoomName: "102", Price: 300000},
+	}
+	for i := range rooms {
+		if err := config.DB.Omit(clause.Associations).Create(&rooms[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return accommodation, rooms
+}
+
+func TestQuoteBookingReportsOverlappingRoomStatuses(t *testing.T) {
+	setupQuoteDB(t)
+	accommodation, rooms := seedQuoteRooms(t)
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	active := now.Add(10 * time.Minute)
+	day := func(d int) time.Time { return time.Date(2030, 12, d, 0, 0, 0, 0, time.Local) }
+
+	statuses := []models.RoomStatus{
+		// Phòng 101 đã đặt 02/12 - 04/12, trùng một đêm với yêu cầu
+		{RoomID: rooms[0].RoomId, FromDate: day(2), ToDate: day(4), Status: models.StatusBooked},
+		// Phòng 102 đang giữ chỗ còn hạn 30/11 - 02/12
+		{RoomID: rooms[1].RoomId, FromDate: day(1).AddDate(0, 0, -1), ToDate: day(2), Status: models.StatusHold, ExpiresAt: &active},
+		// Giữ chỗ đã hết hạn và lịch bắt đầu đúng ngày trả phòng không chặn yêu cầu
+		{RoomID: rooms[1].RoomId, FromDate: day(1), ToDate: day(3), Status: models.StatusHold, ExpiresAt: &expired},
+		{RoomID: rooms[0].RoomId, FromDate: day(3), ToDate: day(5), Status: models.StatusBooked},
+	}
+	if err := config.DB.Create(&statuses).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := quoteBooking(config.DB, bookingQuoteInput{
+		Accommodation: accommodation,
+		RoomIDs:       []uint{rooms[1].RoomId, rooms[0].RoomId},
+		CheckInDate:   day(1),
+		CheckOutDate:  day(3),
+		Nights:        2,
+		Now:           now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(quote.Conflicts) != 2 {
+		t.Fatalf("có %d lịch trùng, muốn 2: %+v", len(quote.Conflicts), quote.Conflicts)
+	}
+	booked, hold := quote.Conflicts[0], quote.Conflicts[1]
+	if booked.RoomID == nil || *booked.RoomID != rooms[0].RoomId || booked.Status != models.StatusBooked ||
+		booked.FromDate != "02/12/2030" || booked.ToDate != "04/12/2030" {
+		t.Fatalf("lịch đã đặt không đúng: %+v", booked)
+	}
+	if hold.RoomID == nil || *hold.RoomID != rooms[1].RoomId || hold.Status != models.StatusHold {
+		t.Fatalf("lịch giữ chỗ không đúng: %+v", hold)
+	}
+	if quote.BasePrice != 1200000 || len(quote.Rates) != 2 {
+		t.Fatalf("giá gốc = %d (%d phòng), muốn 1200000 (2 phòng)", quote.BasePrice, len(quote.Rates))
+	}
+}
+
+func TestQuoteBookingAvailableWithoutOverlap(t *testing.T) {
+	setupQuoteDB(t)
+	accommodation, rooms := seedQuoteRooms(t)
+	checkIn := time.Date(2030, 12, 1, 0, 0, 0, 0, time.Local)
+	checkOut := checkIn.AddDate(0, 0, 2)
+
+	// Lịch kết thúc đúng ngày nhận phòng và lịch đã nhả không tính là trùng
+	statuses := []models.RoomStatus{
+		{RoomID: rooms[0].RoomId, FromDate: checkIn.AddDate(0, 0, -2), ToDate: checkIn, Status: models.StatusBooked},
+		{RoomID: rooms[0].RoomId, FromDate: checkIn, ToDate: checkOut, Status: models.StatusAvailable},
+	}
+	if err := config.DB.Create(&statuses).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	quote, err := quoteBooking(config.DB, bookingQuoteInput{
+		Accommodation: accommodation,
+		RoomIDs:       []uint{rooms[0].RoomId},
+		CheckInDate:   checkIn,
+		CheckOutDate:  checkOut,
+		Nights:        2,
+		Now:           time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quote.Conflicts) != 0 {
+		t.Fatalf("phòng trống nhưng báo trùng lịch: %+v", quote.Conflicts)
+	}
+
+	// Phòng của chỗ ở khác bị từ chối
+	other := models.Accommodation{Name: "Chỗ ở khác", UserID: accommodation.UserID}
+	if err := config.DB.Omit("User").Create(&other).Error; err != nil {
+		t.Fatal(err)
+	}
+	_, err = quoteBooking(config.DB, bookingQuoteInput{
+		Accommodation: other,
+		RoomIDs:       []uint{rooms[0].RoomId},
+		CheckInDate:   checkIn,
+		CheckOutDate:  checkOut,
+		Nights:        2,
+		Now:           time.Now(),
+	})
+	var txErr *orderTxError
+	if !errors.As(err, &txErr) || txErr.status != http.StatusBadRequest {
+		t.Fatalf("err = %v, muốn lỗi 400 AccommodationID không hợp lệ", err)
+	}
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreatePaymentIntentRequest struct {
+	OrderID   uint   `json:"orderId" binding:"required"`
+	Provider  string `json:"provider" binding:"required"`
+	ReturnURL string `json:"returnUrl"`
+}
+
+// authorizePaymentOrder kiểm tra token và quyền của người gọi trên đơn hàng cần thanh toán
+func authorizePaymentOrder(c *gin.Context, orderID uint) (*models.Order, uint, bool) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return nil, 0, false
+	}
+
+	var order models.Order
+	if err := config.DB.Preload("Accommodation").First(&order, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy đơn hàng"})
+		return nil, 0, false
+	}
+
+	if !canManageOrder(order, currentUserID, currentUserRole, services.PermInvoicePayment) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền thanh toán đơn hàng này"})
+		return nil, 0, false
+	}
+
+	return &order, currentUserID, true
+}
+
+// CreatePaymentIntent tạo link/QR thanh toán online cho phần còn phải trả của đơn
+func CreatePaymentIntent(c *gin.Context) {
+	var request CreatePaymentIntentRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	provider, exists := services.GetPaymentProvider(request.Provider)
+	if !exists {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Cổng thanh toán không được hỗ trợ"})
+		return
+	}
+
+	order, currentUserID, ok := authorizePaymentOrder(c, request.OrderID)
+	if !ok {
+		return
+	}
+
+	intent, err := services.CreatePaymentIntent(*order, provider, &currentUserID, request.ReturnURL, c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": 1, "mess": "Tạo yêu cầu thanh toán thành công", "data": intent})
+}
+
+// GetPaymentIntent trả về trạng thái yêu cầu thanh toán để client kiểm tra sau khi quay về từ cổng
+func GetPaymentIntent(c *gin.Context) {
+	var intent models.PaymentIntent
+	if err := config.DB.Where("code = ?", c.Param("code")).First(&intent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy yêu cầu thanh toán"})
+		return
+	}
+
+	if _, _, ok := authorizePaymentOrder(c, intent.OrderID); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy yêu cầu thanh toán thành công", "data": intent})
+}
+
+// PaymentWebhook nhận callback/IPN từ cổng thanh toán. Không dùng token, thay vào đó chữ ký HMAC
+// của cổng được xác thực; callback trùng lặp được trả về thành công mà không ghi nhận lại.
+func PaymentWebhook(c *gin.Context) {
+	provider, exists := services.GetPaymentProvider(c.Param("provider"))
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Cổng thanh toán không được hỗ trợ"})
+		return
+	}
+
+	status, body := handlePaymentWebhook(provider, c.Request)
+	c.JSON(status, body)
+}
+
+func handlePaymentWebhook(provider services.PaymentProvider, r *http.Request) (int, interface{}) {
+	event, err := provider.ParseWebhook(r)
+	if err == nil {
+		_, err = services.HandlePaymentEvent(provider, event)
+	}
+	if err != nil && !errors.Is(err, services.ErrPaymentEventDuplicate) {
+		log.Printf("Webhook %s lỗi: %v\n", provider.Name(), err)
+	}
+	return provider.Acknowledge(err)
+}
+
+// FakePaymentCheckout là trang thanh toán của cổng giả lập: tạo webhook đã ký với kết quả
+// result=success|failed và xử lý như callback thật, dùng khi chạy thử không có mạng
+func FakePaymentCheckout(c *gin.Context) {
+	provider, exists := services.GetPaymentProvider("fake")
+	fake, isFake := provider.(*services.FakePaymentProvider)
+	if !exists || !isFake {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Cổng thanh toán giả lập không được bật"})
+		return
+	}
+
+	var intent models.PaymentIntent
+	if err := config.DB.Where("code = ? AND provider = ?", c.Param("code"), fake.Name()).First(&intent).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy yêu cầu thanh toán"})
+		return
+	}
+
+	req, err := fake.SignedWebhook(intent, c.DefaultQuery("result", "success") == "success")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo webhook giả lập"})
+		return
+	}
+
+	status, body := handlePaymentWebhook(fake, req)
+	if status != http.StatusOK {
+		c.JSON(status, body)
+		return
+	}
+
+	if returnURL := c.Query("returnUrl"); returnURL != "" {
+		if target, err := url.Parse(returnURL); err == nil {
+			query := target.Query()
+			query.Set("code", intent.Code)
+			target.RawQuery = query.Encode()
+			c.Redirect(http.StatusFound, target.String())
+			return
+		}
+	}
+
+	config.DB.First(&intent, intent.ID)
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Thanh toán giả lập đã được xử lý", "data": intent})
+}
@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testSQLiteDriver = "sqlite3_trothalo_test"
+
+var registerTestDriver sync.Once
+
+// setupPaymentDB mở SQLite tạm cho mỗi test. Các truy vấn dùng hàm GREATEST của Postgres
+// nên driver được đăng ký thêm hàm này.
+func setupPaymentDB(t *testing.T) {
+	t.Helper()
+	registerTestDriver.Do(func() {
+		sql.Register(testSQLiteDriver, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return conn.RegisterFunc("greatest", func(a, b int64) int64 {
+					if a > b {
+						return a
+					}
+					return b
+				}, true)
+			},
+		})
+	})
+
+	db, err := gorm.Open(sqlite.Dialector{
+		DriverName: testSQLiteDriver,
+		DSN:        filepath.Join(t.TempDir(), "test.db"),
+	}, &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("không mở được SQLite: %v", err)
+	}
+	if err := db.AutoMigrate(
+		&models.User{}, &models.Accommodation{}, &models.Order{},
+		&models.RoomStatus{}, &models.AccommodationStatus{},
+		&models.Invoice{}, &models.InvoicePayment{}, &models.UserRevenue{},
+		&models.PaymentIntent{}, &models.PaymentWebhookEvent{}, &models.AuditLog{},
+	); err != nil {
+		t.Fatalf("không tạo được bảng: %v", err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	t.Cleanup(func() { config.DB = previous })
+}
+
+// seedPendingPayment tạo đơn đang giữ chỗ (hết hạn sau holdFor) cùng yêu cầu thanh toán đang chờ
+func seedPendingPayment(t *testing.T, holdFor time.Duration) (models.Order, models.PaymentIntent) {
+	t.Helper()
+	owner := models.User{Name: "Chủ nhà", Email: "owner@example.com", PhoneNumber: "0900000001", Role: 2}
+	if err := config.DB.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	accommodation := models.Accommodation{Name: "Homestay", UserID: owner.ID}
+	if err := config.DB.Omit("User").Create(&accommodation).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	holdExpiresAt := time.Now().Add(holdFor)
+	order := models.Order{
+		AccommodationID: accommodation.ID,
+		CheckInDate:     "01/12/2030",
+		CheckOutDate:    "03/12/2030",
+		TotalPrice:      500000,
+		HoldExpiresAt:   &holdExpiresAt,
+	}
+	if err := config.DB.Omit("Accommodation", "User").Create(&order).Error; err != nil {
+		t.Fatal(err)
+	}
+	hold := models.AccommodationStatus{
+		AccommodationID: accommodation.ID,
+		OrderID:         &order.ID,
+		FromDate:        time.Date(2030, 12, 1, 0, 0, 0, 0, time.Local),
+		ToDate:          time.Date(2030, 12, 3, 0, 0, 0, 0, time.Local),
+		Status:          models.StatusHold,
+		ExpiresAt:       &holdExpiresAt,
+	}
+	if err := config.DB.Create(&hold).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	intent := models.PaymentIntent{
+		Code:      "PITEST",
+		OrderID:   order.ID,
+		Provider:  "fake",
+		Amount:    order.TotalPrice,
+		Status:    models.IntentPending,
+		ExpiresAt: time.Now().Add(services.PaymentIntentDuration),
+	}
+	if err := config.DB.Create(&intent).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order, intent
+}
+
+// replay tạo lại request webhook với cùng nội dung và chữ ký, như cổng gửi lại callback
+func replay(t *testing.T, req *http.Request) (*http.Request, *http.Request) {
+	t.Helper()
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := func() *http.Request {
+		r, _ := http.NewRequest(req.Method, req.URL.String(), bytes.NewReader(body))
+		r.Header = req.Header.Clone()
+		return r
+	}
+	return clone(), clone()
+}
+
+func reloadPayment(t *testing.T, orderID, intentID uint) (models.Order, models.PaymentIntent, []models.Invoice) {
+	t.Helper()
+	var order models.Order
+	var intent models.PaymentIntent
+	var invoices []models.Invoice
+	if err := config.DB.First(&order, orderID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := config.DB.First(&intent, intentID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := config.DB.Preload("Payments").Where("order_id = ?", orderID).Find(&invoices).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order, intent, invoices
+}
+
+func TestPaymentWebhookRejectsBadSignature(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, 10*time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	req, err := fake.SignedWebhook(intent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Fake-Signature", (&services.FakePaymentProvider{Secret: "wrong-secret"}).Sign([]byte("{}")))
+
+	if status, _ := handlePaymentWebhook(fake, req); status != http.StatusUnauthorized {
+		t.Fatalf("status = %d, muốn %d", status, http.StatusUnauthorized)
+	}
+
+	order, intent, invoices := reloadPayment(t, order.ID, intent.ID)
+	if intent.Status != models.IntentPending || order.Status != 0 || len(invoices) != 0 {
+		t.Fatalf("webhook sai chữ ký vẫn được ghi nhận: intent %d, đơn %d, %d hóa đơn", intent.Status, order.Status, len(invoices))
+	}
+	var events int64
+	config.DB.Model(&models.PaymentWebhookEvent{}).Count(&events)
+	if events != 0 {
+		t.Fatalf("đã lưu %d webhook sai chữ ký", events)
+	}
+}
+
+func TestPaymentWebhookSuccessConfirmsOrder(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, 10*time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	req, err := fake.SignedWebhook(intent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := handlePaymentWebhook(fake, req); status != http.StatusOK {
+		t.Fatalf("status = %d (%v), muốn %d", status, body, http.StatusOK)
+	}
+
+	order, intent, invoices := reloadPayment(t, order.ID, intent.ID)
+	if order.Status != 1 || order.HoldExpiresAt != nil {
+		t.Fatalf("đơn chưa được xác nhận: status %d, hạn giữ chỗ %v", order.Status, order.HoldExpiresAt)
+	}
+	if intent.Status != models.IntentSucceeded || intent.PaidAt == nil || intent.ProviderTxnID == "" {
+		t.Fatalf("yêu cầu thanh toán chưa thành công: %+v", intent)
+	}
+	if len(invoices) != 1 {
+		t.Fatalf("có %d hóa đơn, muốn 1", len(invoices))
+	}
+	invoice := invoices[0]
+	if invoice.Status != 1 || invoice.PaidAmount != order.TotalPrice || invoice.RemainingAmount != 0 || len(invoice.Payments) != 1 {
+		t.Fatalf("hóa đơn chưa được thanh toán đủ: %+v", invoice)
+	}
+
+	var hold models.AccommodationStatus
+	config.DB.Where("order_id = ?", order.ID).First(&hold)
+	if hold.Status != models.StatusBooked || hold.ExpiresAt != nil {
+		t.Fatalf("giữ chỗ chưa chuyển thành đã đặt: status %d", hold.Status)
+	}
+}
+
+func TestPaymentWebhookDuplicateIsIdempotent(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, 10*time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	req, err := fake.SignedWebhook(intent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, again := replay(t, req)
+	for i, r := range []*http.Request{first, again} {
+		if status, body := handlePaymentWebhook(fake, r); status != http.StatusOK {
+			t.Fatalf("lần %d: status = %d (%v), muốn %d", i+1, status, body, http.StatusOK)
+		}
+	}
+
+	_, _, invoices := reloadPayment(t, order.ID, intent.ID)
+	if len(invoices) != 1 || len(invoices[0].Payments) != 1 {
+		t.Fatalf("callback trùng bị ghi nhận lại: %d hóa đơn", len(invoices))
+	}
+	if invoices[0].PaidAmount != order.TotalPrice {
+		t.Fatalf("đã thu %.0f, muốn %.0f", invoices[0].PaidAmount, order.TotalPrice)
+	}
+}
+
+func TestPaymentWebhookRejectsAmountMismatch(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, 10*time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	underpaid := intent
+	underpaid.Amount = intent.Amount - 100000
+	req, err := fake.SignedWebhook(underpaid, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := handlePaymentWebhook(fake, req); status != http.StatusBadRequest {
+		t.Fatalf("status = %d, muốn %d", status, http.StatusBadRequest)
+	}
+
+	order, intent, invoices := reloadPayment(t, order.ID, intent.ID)
+	if intent.Status != models.IntentPending || order.Status != 0 || len(invoices) != 0 {
+		t.Fatalf("thanh toán sai số tiền vẫn được ghi nhận: intent %d, đơn %d, %d hóa đơn", intent.Status, order.Status, len(invoices))
+	}
+}
+
+func TestPaymentWebhookAfterHoldExpiredOrphansPayment(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, -time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	req, err := fake.SignedWebhook(intent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := handlePaymentWebhook(fake, req); status != http.StatusOK {
+		t.Fatalf("status = %d (%v), muốn %d", status, body, http.StatusOK)
+	}
+
+	order, intent, invoices := reloadPayment(t, order.ID, intent.ID)
+	if intent.Status != models.IntentOrphaned {
+		t.Fatalf("intent status = %d, muốn %d (chờ hoàn tiền)", intent.Status, models.IntentOrphaned)
+	}
+	if order.Status != 0 || len(invoices) != 0 {
+		t.Fatalf("đơn hết hạn giữ chỗ vẫn được xác nhận: đơn %d, %d hóa đơn", order.Status, len(invoices))
+	}
+}
+
+func TestPaymentWebhookSecondIntentOrphansOverpayment(t *testing.T) {
+	setupPaymentDB(t)
+	order, intent := seedPendingPayment(t, 10*time.Minute)
+	fake := &services.FakePaymentProvider{Secret: "test-secret"}
+
+	// Yêu cầu thứ hai tạo trước khi yêu cầu đầu có kết quả, cả hai đều được khách thanh toán
+	second := intent
+	second.ID = 0
+	second.Code = "PITEST2"
+	if err := config.DB.Create(&second).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, pi := range []models.PaymentIntent{intent, second} {
+		req, err := fake.SignedWebhook(pi, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status, body := handlePaymentWebhook(fake, req); status != http.StatusOK {
+			t.Fatalf("%s: status = %d (%v), muốn %d", pi.Code, status, body, http.StatusOK)
+		}
+	}
+
+	_, second, invoices := reloadPayment(t, order.ID, second.ID)
+	if second.Status != models.IntentOrphaned {
+		t.Fatalf("intent status = %d, muốn %d (chờ hoàn tiền)", second.Status, models.IntentOrphaned)
+	}
+	if len(invoices) != 1 || len(invoices[0].Payments) != 1 || invoices[0].PaidAmount != order.TotalPrice {
+		t.Fatalf("hóa đơn bị thu vượt: %+v", invoices)
+	}
+}
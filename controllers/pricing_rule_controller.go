@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PricingRuleRequest struct {
+	ID              uint    `json:"id"`
+	AccommodationID *uint   `json:"accommodationId"`
+	Name            string  `json:"name" binding:"required"`
+	Type            string  `json:"type" binding:"required"`
+	Priority        int     `json:"priority"`
+	Threshold       int     `json:"threshold"`
+	Percent         float64 `json:"percent"`
+	Province        string  `json:"province"`
+	HolidayID       *uint   `json:"holidayId"`
+	Status          *int    `json:"status"`
+}
+
+// checkPricingRuleOwner: superadmin quản lý mọi quy tắc, admin chỉ quản lý quy tắc của chỗ ở mình sở hữu
+func checkPricingRuleOwner(currentUserID uint, currentUserRole int, accommodationID *uint) (int, string) {
+	if accommodationID == nil {
+		if !services.Can(currentUserID, currentUserRole, services.PermAccommodationEdit, 0) {
+			return http.StatusForbidden, "Chỉ SuperAdmin được cấu hình quy tắc giá chung"
+		}
+		return 0, ""
+	}
+
+	var accommodation models.Accommodation
+	if err := config.DB.First(&accommodation, *accommodationID).Error; err != nil {
+		return http.StatusNotFound, "Không tìm thấy chỗ ở"
+	}
+	if !services.Can(currentUserID, currentUserRole, services.PermAccommodationEdit, accommodation.ID) {
+		return http.StatusForbidden, "Bạn không có quyền chỉnh sửa chỗ ở này"
+	}
+	return 0, ""
+}
+
+func GetPricingRules(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	tx := config.DB.Model(&models.PricingRule{})
+	if accommodationIdFilter := c.Query("accommodationId"); accommodationIdFilter != "" {
+		accommodationID, err := strconv.Atoi(accommodationIdFilter)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "accommodationId không hợp lệ"})
+			return
+		}
+		tx = tx.Where("accommodation_id = ? OR accommodation_id IS NULL", accommodationID)
+	}
+	if !services.Can(currentUserID, currentUserRole, services.PermAccommodationView, 0) {
+		tx = tx.Where("accommodation_id IS NULL OR accommodation_id IN (?)",
+			services.PermittedAccommodations(currentUserID, services.PermAccommodationView))
+	}
+
+	var rules []models.PricingRule
+	if err := tx.Order("priority ASC, id ASC").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách quy tắc giá"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy danh sách quy tắc giá thành công", "data": rules})
+}
+
+func CreatePricingRule(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var request PricingRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	if status, mess := checkPricingRuleOwner(currentUserID, currentUserRole, request.AccommodationID); status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return
+	}
+
+	rule := models.PricingRule{
+		AccommodationID: request.AccommodationID,
+		Name:            request.Name,
+		Type:            request.Type,
+		Priority:        request.Priority,
+		Threshold:       request.Threshold,
+		Percent:         request.Percent,
+		Province:        request.Province,
+		HolidayID:       request.HolidayID,
+		Status:          1,
+	}
+	if request.Status != nil {
+		rule.Status = *request.Status
+	}
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := config.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo quy tắc giá"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": 1, "mess": "Tạo quy tắc giá thành công", "data": rule})
+}
+
+func UpdatePricingRule(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var request PricingRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var rule models.PricingRule
+	if err := config.DB.First(&rule, request.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy quy tắc giá"})
+		return
+	}
+
+	// Kiểm tra quyền trên cả chỗ ở hiện tại lẫn chỗ ở mới của quy tắc
+	if status, mess := checkPricingRuleOwner(currentUserID, currentUserRole, rule.AccommodationID); status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return
+	}
+	if status, mess := checkPricingRuleOwner(currentUserID, currentUserRole, request.AccommodationID); status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return
+	}
+
+	rule.AccommodationID = request.AccommodationID
+	rule.Name = request.Name
+	rule.Type = request.Type
+	rule.Priority = request.Priority
+	rule.Threshold = request.Threshold
+	rule.Percent = request.Percent
+	rule.Province = request.Province
+	rule.HolidayID = request.HolidayID
+	if request.Status != nil {
+		rule.Status = *request.Status
+	}
+
+	if err := rule.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật quy tắc giá"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật quy tắc giá thành công", "data": rule})
+}
+
+func DeletePricingRule(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var rule models.PricingRule
+	if err := config.DB.First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy quy tắc giá"})
+		return
+	}
+
+	if status, mess := checkPricingRuleOwner(currentUserID, currentUserRole, rule.AccommodationID); status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return
+	}
+
+	if err := config.DB.Delete(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể xóa quy tắc giá"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xóa quy tắc giá thành công"})
+}
@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SeasonalRateRequest struct {
+	ID              uint   `json:"id"`
+	RoomID          *uint  `json:"roomId"`
+	AccommodationID *uint  `json:"accommodationId"`
+	Name            string `json:"name"`
+	FromDate        string `json:"fromDate" binding:"required"`
+	ToDate          string `json:"toDate" binding:"required"`
+	Price           int    `json:"price"`
+	WeekendPrice    int    `json:"weekendPrice"`
+}
+
+type DailyRateRequest struct {
+	RoomID          *uint    `json:"roomId"`
+	AccommodationID *uint    `json:"accommodationId"`
+	Dates           []string `json:"dates" binding:"required"`
+	Price           int      `json:"price"`
+}
+
+// resolveRateTarget lấy phòng hoặc chỗ ở cần tính giá, kèm ID chỗ ở sở hữu để kiểm tra quyền
+func resolveRateTarget(roomID, accommodationID *uint) (services.RateTarget, uint, int, string) {
+	if (roomID == nil) == (accommodationID == nil) {
+		return services.RateTarget{}, 0, http.StatusBadRequest, "Cần chọn đúng một trong roomId hoặc accommodationId"
+	}
+
+	if roomID != nil {
+		var room models.Room
+		if err := config.DB.Where("room_id = ?", *roomID).First(&room).Error; err != nil {
+			return services.RateTarget{}, 0, http.StatusNotFound, "Phòng không tồn tại"
+		}
+		return services.RoomRateTarget(room), room.AccommodationID, 0, ""
+	}
+
+	var accommodation models.Accommodation
+	if err := config.DB.First(&accommodation, *accommodationID).Error; err != nil {
+		return services.RateTarget{}, 0, http.StatusNotFound, "Chỗ ở không tồn tại"
+	}
+	return services.AccommodationRateTarget(accommodation), accommodation.ID, 0, ""
+}
+
+// checkRateOwner: superadmin quản lý mọi lịch giá, admin chỉ quản lý lịch giá của chỗ ở mình sở hữu
+func checkRateOwner(c *gin.Context, roomID, accommodationID *uint) (services.RateTarget, bool) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return services.RateTarget{}, false
+	}
+
+	target, ownerAccID, status, mess := resolveRateTarget(roomID, accommodationID)
+	if status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return services.RateTarget{}, false
+	}
+
+	if !services.Can(currentUserID, currentUserRole, services.PermAccommodationEdit, ownerAccID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Bạn không có quyền chỉnh sửa chỗ ở này"})
+		return services.RateTarget{}, false
+	}
+
+	return target, true
+}
+
+func rateTargetQuery(c *gin.Context) (*uint, *uint, bool) {
+	var roomID, accommodationID *uint
+	if value := c.Query("roomId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, nil, false
+		}
+		uid := uint(id)
+		roomID = &uid
+	}
+	if value := c.Query("accommodationId"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, nil, false
+		}
+		uid := uint(id)
+		accommodationID = &uid
+	}
+	return roomID, accommodationID, true
+}
+
+// GetRateCalendar trả về giá từng đêm trong tháng của một phòng hoặc chỗ ở
+func GetRateCalendar(c *gin.Context) {
+	roomID, accommodationID, ok := rateTargetQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "roomId hoặc accommodationId không hợp lệ"})
+		return
+	}
+
+	parsedDate, err := time.Parse("01/2006", c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày không hợp lệ, vui lòng sử dụng định dạng mm/yyyy"})
+		return
+	}
+
+	target, _, status, mess := resolveRateTarget(roomID, accommodationID)
+	if status != 0 {
+		c.JSON(status, gin.H{"code": 0, "mess": mess})
+		return
+	}
+
+	firstDay := time.Date(parsedDate.Year(), parsedDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+	prices, err := services.NightlyPrices(config.DB, target, firstDay, firstDay.AddDate(0, 1, 0))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy lịch giá", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy lịch giá thành công", "data": prices})
+}
+
+func GetSeasonalRates(c *gin.Context) {
+	roomID, accommodationID, ok := rateTargetQuery(c)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "roomId hoặc accommodationId không hợp lệ"})
+		return
+	}
+	if _, ok := checkRateOwner(c, roomID, accommodationID); !ok {
+		return
+	}
+
+	tx := config.DB.Model(&models.SeasonalRate{})
+	if roomID != nil {
+		tx = tx.Where("room_id = ?", *roomID)
+	} else {
+		tx = tx.Where("accommodation_id = ?", *accommodationID)
+	}
+
+	var rates []models.SeasonalRate
+	if err := tx.Order("from_date ASC").Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách giá theo mùa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy danh sách giá theo mùa thành công", "data": rates})
+}
+
+func parseSeasonalRateRequest(request SeasonalRateRequest, rate *models.SeasonalRate) error {
+	fromDate, err := time.Parse("02/01/2006", request.FromDate)
+	if err != nil {
+		return err
+	}
+	toDate, err := time.Parse("02/01/2006", request.ToDate)
+	if err != nil {
+		return err
+	}
+
+	rate.RoomID = request.RoomID
+	rate.AccommodationID = request.AccommodationID
+	rate.Name = request.Name
+	rate.FromDate = fromDate
+	rate.ToDate = toDate
+	rate.Price = request.Price
+	rate.WeekendPrice = request.WeekendPrice
+	return nil
+}
+
+func CreateSeasonalRate(c *gin.Context) {
+	var request SeasonalRateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if _, ok := checkRateOwner(c, request.RoomID, request.AccommodationID); !ok {
+		return
+	}
+
+	var rate models.SeasonalRate
+	if err := parseSeasonalRateRequest(request, &rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày không hợp lệ, vui lòng sử dụng định dạng dd/mm/yyyy"})
+		return
+	}
+	if err := rate.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := config.DB.Create(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo giá theo mùa"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"code": 1, "mess": "Tạo giá theo mùa thành công", "data": rate})
+}
+
+func UpdateSeasonalRate(c *gin.Context) {
+	var request SeasonalRateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var rate models.SeasonalRate
+	if err := config.DB.First(&rate, request.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy giá theo mùa"})
+		return
+	}
+
+	// Kiểm tra quyền trên cả đối tượng hiện tại lẫn đối tượng mới
+	if _, ok := checkRateOwner(c, rate.RoomID, rate.AccommodationID); !ok {
+		return
+	}
+	if _, ok := checkRateOwner(c, request.RoomID, request.AccommodationID); !ok {
+		return
+	}
+
+	if err := parseSeasonalRateRequest(request, &rate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày không hợp lệ, vui lòng sử dụng định dạng dd/mm/yyyy"})
+		return
+	}
+	if err := rate.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := config.DB.Save(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật giá theo mùa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật giá theo mùa thành công", "data": rate})
+}
+
+func DeleteSeasonalRate(c *gin.Context) {
+	var rate models.SeasonalRate
+	if err := config.DB.First(&rate, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy giá theo mùa"})
+		return
+	}
+	if _, ok := checkRateOwner(c, rate.RoomID, rate.AccommodationID); !ok {
+		return
+	}
+
+	if err := config.DB.Delete(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể xóa giá theo mùa"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xóa giá theo mùa thành công"})
+}
+
+func parseRateDates(dates []string) ([]time.Time, bool) {
+	if len(dates) == 0 {
+		return nil, false
+	}
+	parsed := make([]time.Time, 0, len(dates))
+	for _, date := range dates {
+		day, err := time.Parse("02/01/2006", date)
+		if err != nil {
+			return nil, false
+		}
+		parsed = append(parsed, day)
+	}
+	return parsed, true
+}
+
+// UpsertDailyRates đặt giá ghi đè cho từng ngày, ngày đã có giá ghi đè thì cập nhật lại
+func UpsertDailyRates(c *gin.Context) {
+	var request DailyRateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+	if request.Price <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Giá phải lớn hơn 0"})
+		return
+	}
+	target, ok := checkRateOwner(c, request.RoomID, request.AccommodationID)
+	if !ok {
+		return
+	}
+	dates, ok := parseRateDates(request.Dates)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày không hợp lệ, vui lòng sử dụng định dạng dd/mm/yyyy"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, date := range dates {
+			var rate models.DailyRate
+			scope := tx.Where("date = ?", date)
+			if target.RoomID != 0 {
+				scope = scope.Where("room_id = ?", target.RoomID)
+			} else {
+				scope = scope.Where("accommodation_id = ?", target.AccommodationID)
+			}
+
+			err := scope.First(&rate).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return err
+			}
+			if err == gorm.ErrRecordNotFound {
+				rate = models.DailyRate{RoomID: request.RoomID, AccommodationID: request.AccommodationID, Date: date}
+			}
+			rate.Price = request.Price
+			if err := tx.Save(&rate).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật giá theo ngày", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật giá theo ngày thành công"})
+}
+
+// DeleteDailyRates bỏ giá ghi đè của các ngày, các ngày này quay về giá theo mùa/cuối tuần/giá gốc
+func DeleteDailyRates(c *gin.Context) {
+	var request DailyRateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+	target, ok := checkRateOwner(c, request.RoomID, request.AccommodationID)
+	if !ok {
+		return
+	}
+	dates, ok := parseRateDates(request.Dates)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Ngày không hợp lệ, vui lòng sử dụng định dạng dd/mm/yyyy"})
+		return
+	}
+
+	tx := config.DB.Where("date IN ?", dates)
+	if target.RoomID != 0 {
+		tx = tx.Where("room_id = ?", target.RoomID)
+	} else {
+		tx = tx.Where("accommodation_id = ?", target.AccommodationID)
+	}
+	if err := tx.Delete(&models.DailyRate{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể xóa giá theo ngày"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xóa giá theo ngày thành công"})
+}
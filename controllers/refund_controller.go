@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"new/config"
+	"new/models"
+	"new/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RefundStatusRequest struct {
+	ID     uint   `json:"id" binding:"required"`
+	Status int    `json:"status"`
+	Method *int   `json:"method"`
+	Reason string `json:"reason"`
+}
+
+// refundAccommodationID trả về chỗ ở của đơn có khoản hoàn, dùng để kiểm tra quyền theo vai trò được giao
+func refundAccommodationID(refund models.Refund) (uint, error) {
+	var accommodationID uint
+	err := config.DB.Model(&models.Order{}).Where("id = ?", refund.OrderID).Select("accommodation_id").Scan(&accommodationID).Error
+	return accommodationID, err
+}
+
+func GetRefunds(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	// Superadmin, admin và nhân viên được giao quyền ghi nhận thanh toán trên chỗ ở
+	if !services.CanAny(currentUserID, currentUserRole, services.PermInvoicePayment) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
+		return
+	}
+
+	page, limit := 0, 10
+	if parsedPage, err := strconv.Atoi(c.Query("page")); err == nil && parsedPage >= 0 {
+		page = parsedPage
+	}
+	if parsedLimit, err := strconv.Atoi(c.Query("limit")); err == nil && parsedLimit > 0 {
+		limit = parsedLimit
+	}
+
+	tx := config.DB.Model(&models.Refund{})
+	if !services.Can(currentUserID, currentUserRole, services.PermInvoicePayment, 0) {
+		tx = tx.Where("order_id IN (?)", config.DB.Table("orders").
+			Select("orders.id").
+			Where("orders.accommodation_id IN (?)", services.PermittedAccommodations(currentUserID, services.PermInvoicePayment)))
+	}
+	if statusFilter := c.Query("status"); statusFilter != "" {
+		if status, err := strconv.Atoi(statusFilter); err == nil {
+			tx = tx.Where("status = ?", status)
+		}
+	}
+	if invoiceFilter := c.Query("invoiceId"); invoiceFilter != "" {
+		tx = tx.Where("invoice_id = ?", invoiceFilter)
+	}
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đếm số khoản hoàn tiền"})
+		return
+	}
+
+	var refunds []models.Refund
+	if err := tx.Order("created_at DESC").Offset(page * limit).Limit(limit).Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách hoàn tiền"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 1,
+		"mess": "Lấy danh sách hoàn tiền thành công",
+		"data": refunds,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// UpdateRefundStatus đánh dấu khoản hoàn đã chuyển tiền (kèm phương thức) hoặc từ chối
+func UpdateRefundStatus(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var request RefundStatusRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	var refund models.Refund
+	if err := config.DB.First(&refund, request.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy khoản hoàn tiền"})
+		return
+	}
+
+	accommodationID, err := refundAccommodationID(refund)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể kiểm tra quyền với khoản hoàn tiền"})
+		return
+	}
+	if !services.Can(currentUserID, currentUserRole, services.PermInvoicePayment, accommodationID) {
+		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền với khoản hoàn tiền này"})
+		return
+	}
+
+	if refund.Status != models.RefundPending {
+		c.JSON(http.StatusConflict, gin.H{"code": 0, "mess": "Khoản hoàn tiền đã được xử lý"})
+		return
+	}
+
+	now := time.Now()
+	refund.Status = request.Status
+	refund.Method = request.Method
+	refund.ProcessedBy = &currentUserID
+	refund.ProcessedAt = &now
+	if request.Reason != "" {
+		refund.Reason = request.Reason
+	}
+
+	if refund.Status == models.RefundPending {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Trạng thái mới phải là đã hoàn hoặc từ chối"})
+		return
+	}
+	if err := refund.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	// Chỉ chuyển trạng thái khi khoản hoàn vẫn đang chờ để hai người không cùng xử lý một khoản
+	actor := services.AuditActorFromRequest(c)
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Refund{}).
+			Where("id = ? AND status = ?", refund.ID, models.RefundPending).
+			Updates(map[string]interface{}{
+				"status":       refund.Status,
+				"method":       refund.Method,
+				"reason":       refund.Reason,
+				"processed_by": refund.ProcessedBy,
+				"processed_at": refund.ProcessedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return &orderTxError{status: http.StatusConflict, mess: "Khoản hoàn tiền đã được xử lý"}
+		}
+
+		invoice, err := services.LockInvoice(tx, refund.InvoiceID)
+		if err != nil {
+			return err
+		}
+		before := services.InvoiceAuditSnapshot(invoice)
+		before["refundStatus"] = models.RefundPending
+
+		// Từ chối hoàn: hóa đơn không còn nợ khoản này và admin giữ lại số tiền đã bị trừ khỏi doanh thu
+		if refund.Status == models.RefundRejected {
+			refundAmount := invoice.RefundAmount - refund.Amount
+			if refundAmount < 0 {
+				refundAmount = 0
+			}
+			if err := tx.Model(invoice).Update("refund_amount", refundAmount).Error; err != nil {
+				return err
+			}
+			invoice.RefundAmount = refundAmount
+			if err := services.AdjustInvoiceRevenue(tx, invoice.AdminID, invoice.CreatedAt, refund.Amount, 0); err != nil {
+				return err
+			}
+		}
+
+		after := services.InvoiceAuditSnapshot(invoice)
+		after["refundStatus"] = refund.Status
+		after["refundId"] = refund.ID
+		after["amount"] = refund.Amount
+		after["method"] = refund.Method
+		after["reason"] = refund.Reason
+		return services.RecordInvoiceAudit(tx, actor, invoice, services.AuditEntry{
+			Action:     services.AuditRefundStatusUpdate,
+			EntityType: "refund",
+			EntityID:   refund.ID,
+			Before:     before,
+			After:      after,
+		})
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật khoản hoàn tiền"})
+		return
+	}
+
+	clearInvoiceCache()
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật khoản hoàn tiền thành công", "data": refund})
+}
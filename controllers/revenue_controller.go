@@ -38,37 +38,40 @@ type UserRevenueResponse struct {
 	} `json:"user"`
 }
 
+// invoiceRevenueSQL là doanh thu của một hóa đơn: tổng tiền, hoặc phần giữ lại (đã thu trừ hoàn) nếu đơn đã hủy
+const invoiceRevenueSQL = "COALESCE(SUM(CASE WHEN status = 2 THEN paid_amount - refund_amount ELSE total_amount END), 0)"
+
+// invoiceRevenue tương ứng invoiceRevenueSQL cho hóa đơn đã tải lên
+func invoiceRevenue(invoice models.Invoice) float64 {
+	if invoice.Status == 2 {
+		return invoice.PaidAmount - invoice.RefundAmount
+	}
+	return invoice.TotalAmount
+}
+
 func GetTotalRevenue(c *gin.Context) {
 	var totalRevenue, currentMonthRevenue, currentWeekRevenue float64
 	var lastMonthRevenue sql.NullFloat64
 	var monthlyRevenue []MonthRevenue
 	var vat, actualMonthlyRevenue float64 // Thêm VAT và doanh thu thực tháng này
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
-	// Chỉ xử lý cho role 1 và role 2
-	if currentUserRole != 1 && currentUserRole != 2 {
+	// Superadmin, admin và nhân viên được giao quyền xem doanh thu
+	if !services.CanAny(currentUserID, currentUserRole, services.PermRevenueView) {
 		c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
 		return
 	}
 
 	tx := config.DB.Model(&models.Invoice{})
-	if currentUserRole == 2 {
+	if !services.Can(currentUserID, currentUserRole, services.PermRevenueView, 0) {
 		tx = tx.Where("order_id IN (?)", config.DB.Table("orders").
 			Select("orders.id").
-			Joins("JOIN accommodations ON accommodations.id = orders.accommodation_id").
-			Where("accommodations.user_id = ?", currentUserID))
+			Where("orders.accommodation_id IN (?)", services.PermittedAccommodations(currentUserID, services.PermRevenueView)))
 	}
 
 	var invoices []models.Invoice
@@ -78,22 +81,23 @@ func GetTotalRevenue(c *gin.Context) {
 	}
 
 	for _, invoice := range invoices {
-		totalRevenue += invoice.TotalAmount
+		amount := invoiceRevenue(invoice)
+		totalRevenue += amount
 
 		currentMonth := time.Now().Format("2006-01")
 		if invoice.CreatedAt.Format("2006-01") == currentMonth {
-			currentMonthRevenue += invoice.TotalAmount
+			currentMonthRevenue += amount
 		}
 
 		lastMonth := time.Now().AddDate(0, -1, 0).Format("2006-01")
 		if invoice.CreatedAt.Format("2006-01") == lastMonth {
-			lastMonthRevenue.Float64 += invoice.TotalAmount
+			lastMonthRevenue.Float64 += amount
 		}
 
 		currentWeekStart := time.Now().AddDate(0, 0, -int(time.Now().Weekday()))
 		currentWeekEnd := currentWeekStart.AddDate(0, 0, 6)
 		if invoice.CreatedAt.After(currentWeekStart) && invoice.CreatedAt.Before(currentWeekEnd) {
-			currentWeekRevenue += invoice.TotalAmount
+			currentWeekRevenue += amount
 		}
 	}
 
@@ -104,8 +108,10 @@ func GetTotalRevenue(c *gin.Context) {
 
 		for _, invoice := range invoices {
 			if invoice.CreatedAt.Format("2006-01") == month {
-				revenue += invoice.TotalAmount
-				orderCount++
+				revenue += invoiceRevenue(invoice)
+				if invoice.Status != 2 {
+					orderCount++
+				}
 			}
 		}
 
@@ -125,8 +131,8 @@ func GetTotalRevenue(c *gin.Context) {
 		for i := range monthlyRevenue {
 			monthlyRevenue[i].Revenue *= 0.30
 		}
-	} else if currentUserRole == 2 {
-		// Tính doanh thu cho role 2
+	} else {
+		// Tính doanh thu phần chủ chỗ ở (admin hoặc nhân viên được xem doanh thu)
 		vat = currentMonthRevenue * 30 / 100
 		actualMonthlyRevenue = currentMonthRevenue - vat
 		totalRevenue -= (totalRevenue * 30 / 100)
@@ -146,16 +152,9 @@ func GetTotalRevenue(c *gin.Context) {
 }
 
 func GetTotal(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -185,7 +184,7 @@ func GetTotal(c *gin.Context) {
 		// Tổng doanh thu
 		if err := config.DB.Model(&models.Invoice{}).
 			Where("admin_id = ?", userID).
-			Select("COALESCE(SUM(total_amount), 0)").
+			Select(invoiceRevenueSQL).
 			Scan(&totalAmount).Error; err != nil {
 			return 0, 0, 0, 0, 0, 0, 0, nil
 		}
@@ -193,7 +192,7 @@ func GetTotal(c *gin.Context) {
 		// Doanh thu tháng hiện tại
 		if err := config.DB.Model(&models.Invoice{}).
 			Where("admin_id = ? AND EXTRACT(MONTH FROM created_at) = EXTRACT(MONTH FROM CURRENT_DATE) AND EXTRACT(YEAR FROM created_at) = EXTRACT(YEAR FROM CURRENT_DATE)", userID).
-			Select("COALESCE(SUM(total_amount), 0)").
+			Select(invoiceRevenueSQL).
 			Scan(&currentMonthRevenue).Error; err != nil {
 			return 0, 0, 0, 0, 0, 0, 0, nil
 		}
@@ -201,7 +200,7 @@ func GetTotal(c *gin.Context) {
 		// Doanh thu tháng trước
 		if err := config.DB.Model(&models.Invoice{}).
 			Where("admin_id = ? AND EXTRACT(MONTH FROM created_at) = EXTRACT(MONTH FROM CURRENT_DATE - INTERVAL '1 MONTH') AND EXTRACT(YEAR FROM created_at) = EXTRACT(YEAR FROM CURRENT_DATE)", userID).
-			Select("COALESCE(SUM(total_amount), 0)").
+			Select(invoiceRevenueSQL).
 			Scan(&lastMonthRevenue).Error; err != nil {
 			return 0, 0, 0, 0, 0, 0, 0, nil
 		}
@@ -209,7 +208,7 @@ func GetTotal(c *gin.Context) {
 		// Doanh thu tuần hiện tại
 		if err := config.DB.Model(&models.Invoice{}).
 			Where("admin_id = ? AND EXTRACT(WEEK FROM created_at) = EXTRACT(WEEK FROM CURRENT_DATE) AND EXTRACT(YEAR FROM created_at) = EXTRACT(YEAR FROM CURRENT_DATE)", userID).
-			Select("COALESCE(SUM(total_amount), 0)").
+			Select(invoiceRevenueSQL).
 			Scan(&currentWeekRevenue).Error; err != nil {
 			return 0, 0, 0, 0, 0, 0, 0, nil
 		}
@@ -257,16 +256,9 @@ func GetTotal(c *gin.Context) {
 }
 
 func GetToday(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
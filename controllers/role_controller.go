@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleInput struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name" binding:"required"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+type RoleAssignmentInput struct {
+	UserID          uint `json:"userId" binding:"required"`
+	RoleID          uint `json:"roleId" binding:"required"`
+	AccommodationID uint `json:"accommodationId" binding:"required"`
+}
+
+// rbacErrorStatus: vai trò/quyền không hợp lệ là lỗi của người dùng, còn lại là lỗi hệ thống
+func rbacErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownPermission):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrRoleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSystemRole), errors.Is(err, services.ErrAssignmentDenied):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func GetPermissions(c *gin.Context) {
+	var permissions []models.Permission
+	if err := config.DB.Order("code").Find(&permissions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách quyền"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy danh sách quyền thành công", "data": permissions})
+}
+
+// GetMyPermissions trả về quyền của người dùng hiện tại theo từng chỗ ở để giao diện ẩn/hiện chức năng
+func GetMyPermissions(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	accommodations, err := services.EffectivePermissions(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy quyền"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy quyền thành công", "data": gin.H{
+		"superAdmin":     currentUserRole == 1,
+		"owner":          currentUserRole == 2,
+		"accommodations": accommodations,
+	}})
+}
+
+func GetRoles(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	roles, err := services.ListRoles(currentUserID, currentUserRole)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách vai trò"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy danh sách vai trò thành công", "data": roles})
+}
+
+func CreateRole(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	role, err := services.SaveRole(currentUserID, currentUserRole, 0, input.Name, input.Description, input.Permissions)
+	if err != nil {
+		c.JSON(rbacErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Tạo vai trò thành công", "data": role})
+}
+
+func UpdateRole(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil || input.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Dữ liệu không hợp lệ"})
+		return
+	}
+
+	role, err := services.SaveRole(currentUserID, currentUserRole, input.ID, input.Name, input.Description, input.Permissions)
+	if err != nil {
+		c.JSON(rbacErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Cập nhật vai trò thành công", "data": role})
+}
+
+func DeleteRole(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	roleID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "ID vai trò không hợp lệ"})
+		return
+	}
+
+	if err := services.DeleteRole(currentUserID, currentUserRole, uint(roleID)); err != nil {
+		c.JSON(rbacErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Xóa vai trò thành công"})
+}
+
+// GetRoleAssignments liệt kê vai trò được giao của một nhân viên (quyền quản lý kiểm tra ở policy)
+func GetRoleAssignments(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Query("userId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "userId không hợp lệ"})
+		return
+	}
+
+	assignments, err := services.ListRoleAssignments(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy vai trò được giao"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy vai trò được giao thành công", "data": assignments})
+}
+
+func CreateRoleAssignment(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input RoleAssignmentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	assignment, err := services.AssignRole(currentUserID, currentUserRole, input.UserID, input.RoleID, input.AccommodationID)
+	if err != nil {
+		c.JSON(rbacErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Giao vai trò thành công", "data": assignment})
+}
+
+func DeleteRoleAssignment(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	assignmentID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "ID không hợp lệ"})
+		return
+	}
+
+	if err := services.UnassignRole(currentUserID, currentUserRole, uint(assignmentID)); err != nil {
+		c.JSON(rbacErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Thu hồi vai trò thành công"})
+}
@@ -27,6 +27,7 @@ type Request struct {
 	NumTolet     int             `json:"numTolet"`
 	Acreage      int             `json:"acreage"`
 	Price        int             `json:"price"`
+	WeekendPrice *int            `json:"weekendPrice"`
 	DaysPrice    json.RawMessage `json:"daysPrice"`
 	HolidayPrice json.RawMessage `json:"holidayPrice"`
 	Description  string          `json:"description"`
@@ -129,7 +130,12 @@ func getRoomStatuses(fromDate, toDate time.Time) ([]models.RoomStatus, error) {
 // Hàm phụ để lọc danh sách trạng thái theo khoảng thời gian
 func filterRoomStatusesByDate(statuses []models.RoomStatus, fromDate, toDate time.Time) []models.RoomStatus {
 	var filteredStatuses []models.RoomStatus
+	now := time.Now()
 	for _, status := range statuses {
+		// Giữ chỗ đã quá hạn nhưng cron chưa kịp nhả thì không tính là đã kín
+		if !status.IsActive(now) {
+			continue
+		}
 		if !(status.ToDate.Before(fromDate) || status.FromDate.After(toDate)) {
 			filteredStatuses = append(filteredStatuses, status)
 		}
@@ -183,7 +189,25 @@ func GetRoomBookingDates(c *gin.Context) {
 		return
 	}
 
+	// Lấy giá từng đêm trong tháng theo lịch giá
+	var room models.Room
+	if err := db.Where("room_id = ?", roomID).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Phòng không tồn tại"})
+		return
+	}
+	nightlyPrices, err := services.NightlyPrices(db, services.RoomRateTarget(room), firstDay, lastDay.AddDate(0, 0, 1))
+	if err != nil {
+		log.Printf("Error retrieving nightly prices: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi khi lấy lịch giá phòng"})
+		return
+	}
+	priceMap := make(map[string]int)
+	for _, night := range nightlyPrices {
+		priceMap[night.Date] = night.Price
+	}
+
 	dateFormat := "02/01/2006"
+	now := time.Now()
 	var roomResponses []map[string]interface{}
 
 	// Duyệt qua tất cả các ngày trong tháng
@@ -194,6 +218,9 @@ func GetRoomBookingDates(c *gin.Context) {
 
 		// Kiểm tra trạng thái của phòng
 		for _, roomStatus := range statuses {
+			if !roomStatus.IsActive(now) {
+				continue
+			}
 			if currentDate.After(roomStatus.FromDate.AddDate(0, 0, -1)) && !currentDate.After(roomStatus.ToDate) {
 				status = roomStatus.Status
 				statusFound = true
@@ -208,6 +235,7 @@ func GetRoomBookingDates(c *gin.Context) {
 		roomResponse := map[string]interface{}{
 			"date":   dateStr,
 			"status": status,
+			"price":  priceMap[dateStr],
 		}
 
 		// Nếu ngày này có khách đặt phòng, thêm thông tin khách vào response
@@ -299,16 +327,9 @@ func getGuestBookingsForRoom(roomID string) (map[string]map[string]string, error
 
 func GetAllRooms(c *gin.Context) {
 	// Xác thực token
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -361,13 +382,8 @@ func GetAllRooms(c *gin.Context) {
 			// Lấy phòng theo admin
 			tx = tx.Joins("JOIN accommodations ON accommodations.id = rooms.accommodation_id").Where("accommodations.user_id = ?", currentUserID)
 		} else if currentUserRole == 3 {
-			// Lấy phòng theo admin (vị trí receptionist)
-			var adminID int
-			if err := config.DB.Model(&models.User{}).Select("admin_id").Where("id = ?", currentUserID).Scan(&adminID).Error; err != nil || adminID == 0 {
-				c.JSON(http.StatusForbidden, gin.H{"code": 0, "mess": "Không có quyền truy cập"})
-				return
-			}
-			tx = tx.Joins("JOIN accommodations ON accommodations.id = rooms.accommodation_id").Where("accommodations.user_id = ?", adminID)
+			// Lấy phòng thuộc các chỗ ở nhân viên được giao
+			tx = tx.Where("rooms.accommodation_id IN (?)", services.PermittedAccommodations(currentUserID, services.PermAccommodationView))
 		}
 
 		if err := tx.Find(&allRooms).Error; err != nil {
@@ -778,16 +794,9 @@ func UpdateLowestPriceForAccommodation(accommodationID uint) {
 func CreateRoom(c *gin.Context) {
 	var newRoom models.Room
 	// Xác thực token
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 	if err := c.ShouldBindJSON(&newRoom); err != nil {
@@ -800,6 +809,12 @@ func CreateRoom(c *gin.Context) {
 		return
 	}
 
+	// weekendPrice được nhận ngay khi tạo, 0 = dùng Price cho cả cuối tuần
+	if newRoom.WeekendPrice < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Giá cuối tuần không hợp lệ"})
+		return
+	}
+
 	furnitureJSON, err := json.Marshal(newRoom.Furniture)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể mã hóa holidayPrice", "details": err.Error()})
@@ -913,16 +928,9 @@ func GetRoomDetail(c *gin.Context) {
 }
 
 func UpdateRoom(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -981,6 +989,14 @@ func UpdateRoom(c *gin.Context) {
 		room.Price = request.Price
 	}
 
+	if request.WeekendPrice != nil {
+		if *request.WeekendPrice < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Giá cuối tuần không hợp lệ"})
+			return
+		}
+		room.WeekendPrice = *request.WeekendPrice
+	}
+
 	if request.Description != "" {
 		room.Description = request.Description
 	}
@@ -1048,16 +1064,9 @@ func UpdateRoom(c *gin.Context) {
 }
 
 func ChangeRoomStatus(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
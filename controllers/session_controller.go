@@ -0,0 +1,107 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// GetSessions liệt kê các phiên đăng nhập còn hiệu lực của người dùng, đánh dấu phiên đang dùng
+func GetSessions(c *gin.Context) {
+	claims, err := services.AuthenticateRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	sessions, err := services.ListSessions(claims.UserInfo.UserId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy danh sách phiên đăng nhập", "detail": err.Error()})
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Session: session,
+			Current: session.ID == claims.SessionID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy danh sách phiên đăng nhập thành công", "data": response})
+}
+
+// RevokeSession đăng xuất một phiên của chính người dùng
+func RevokeSession(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := services.RevokeSession(currentUserID, c.Param("id"), "revoked_by_user", nil); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể thu hồi phiên đăng nhập", "detail": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã đăng xuất phiên đăng nhập"})
+}
+
+// RevokeSessions đăng xuất các phiên khác của người dùng; includeCurrent=true đăng xuất cả phiên hiện tại
+func RevokeSessions(c *gin.Context) {
+	claims, err := services.AuthenticateRequest(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	keepSessionID := claims.SessionID
+	if c.Query("includeCurrent") == "true" {
+		keepSessionID = ""
+	}
+
+	revoked, err := services.RevokeUserSessions(claims.UserInfo.UserId, keepSessionID, "revoked_by_user", nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể thu hồi phiên đăng nhập", "detail": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã đăng xuất các phiên đăng nhập", "data": gin.H{"revoked": revoked}})
+}
+
+// ForceLogoutUser: admin đăng xuất mọi phiên của lễ tân mình quản lý (quyền kiểm tra ở policy)
+func ForceLogoutUser(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "ID người dùng không hợp lệ"})
+		return
+	}
+
+	revoked, err := services.RevokeUserSessions(uint(userID), "", "forced_logout", &currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể đăng xuất người dùng", "detail": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã đăng xuất người dùng khỏi mọi thiết bị", "data": gin.H{"revoked": revoked}})
+}
@@ -0,0 +1,11 @@
+package controllers
+
+import "new/config"
+
+// integrationConfig giữ khóa của các dịch vụ bên ngoài (Mapbox, Google) nhận từ cấu hình khi khởi động
+var integrationConfig config.IntegrationConfig
+
+// Configure truyền cấu hình đã nạp cho các controller
+func Configure(cfg *config.AppConfig) {
+	integrationConfig = cfg.Integration
+}
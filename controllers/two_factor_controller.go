@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TwoFactorCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// twoFactorErrorStatus: lỗi do mã hoặc trạng thái 2FA là lỗi của người dùng, còn lại là lỗi hệ thống
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTwoFactorChallenge):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrTwoFactorInvalidCode),
+		errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorAlreadyEnabled),
+		errors.Is(err, services.ErrTwoFactorNotSetup),
+		errors.Is(err, services.ErrOTPTooManyAttempts):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// respondTwoFactorChallenge trả về challenge thay cho token nếu người dùng phải qua 2FA.
+// Trả về true khi đã phản hồi (challenge hoặc lỗi), handler đăng nhập dừng tại đó.
+func respondTwoFactorChallenge(c *gin.Context, user models.User) bool {
+	if !services.NeedsTwoFactor(user) {
+		return false
+	}
+
+	challenge, err := services.StartTwoFactorChallenge(user)
+	if err != nil {
+		log.Println("Error starting 2FA challenge:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể tạo phiên xác thực hai lớp"})
+		return true
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Vui lòng nhập mã xác thực hai lớp", "data": challenge})
+	return true
+}
+
+// VerifyTwoFactorLogin hoàn tất đăng nhập bằng challenge và mã TOTP (hoặc mã khôi phục)
+func VerifyTwoFactorLogin(c *gin.Context) {
+	var input struct {
+		Challenge string `json:"challenge" binding:"required"`
+		Code      string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	user, recoveryCodes, err := services.CompleteTwoFactorChallenge(input.Challenge, input.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	// Tài khoản có thể bị khóa trong lúc đang chờ nhập mã
+	if rejectBannedUser(c, user) {
+		return
+	}
+
+	userInfo := services.UserInfo{
+		UserId: user.ID,
+		Role:   user.Role,
+	}
+	tokens, err := services.IssueTokenPair(userInfo, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	data := gin.H{
+		"user_info":    newUserLoginResponse(user),
+		"accessToken":  tokens.AccessToken,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn":    tokens.ExpiresIn,
+	}
+	// Vừa đăng ký 2FA trong lần đăng nhập này: mã khôi phục chỉ hiển thị một lần
+	if len(recoveryCodes) > 0 {
+		data["recoveryCodes"] = recoveryCodes
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đăng nhập thành công", "data": data})
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	enabled, recoveryCodesLeft, err := services.TwoFactorStatus(currentUserID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Lấy trạng thái xác thực hai lớp thành công", "data": gin.H{
+		"enabled":           enabled,
+		"required":          services.TwoFactorRequired(currentUserRole),
+		"recoveryCodesLeft": recoveryCodesLeft,
+	}})
+}
+
+// SetupTwoFactor tạo mã bí mật và URI otpauth để quét QR; cần gọi EnableTwoFactor với mã đầu tiên để bật
+func SetupTwoFactor(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, currentUserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Người dùng không tồn tại"})
+		return
+	}
+
+	secret, uri, err := services.BeginTwoFactorSetup(user)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Quét mã QR bằng ứng dụng xác thực rồi nhập mã để bật", "data": gin.H{
+		"secret":     secret,
+		"otpauthUri": uri,
+	}})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := services.EnableTwoFactor(currentUserID, input.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã bật xác thực hai lớp. Hãy lưu lại mã khôi phục", "data": gin.H{
+		"recoveryCodes": recoveryCodes,
+	}})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	currentUserID, currentUserRole, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	if err := services.DisableTwoFactor(currentUserID, currentUserRole, input.Code); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã tắt xác thực hai lớp"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	currentUserID, _, err := currentUser(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	var input TwoFactorCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := services.RegenerateRecoveryCodes(currentUserID, input.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"code": 0, "mess": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 1, "mess": "Đã tạo mã khôi phục mới", "data": gin.H{
+		"recoveryCodes": recoveryCodes,
+	}})
+}
@@ -55,16 +55,9 @@ type StausUser struct {
 }
 
 func (u UserController) GetUsers(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -256,16 +249,9 @@ func (u UserController) GetUsers(c *gin.Context) {
 }
 
 func (u *UserController) CreateUser(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, err := GetIDFromToken(tokenString)
+	currentUserID, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -399,16 +385,9 @@ func (u UserController) GetUserByID(c *gin.Context) {
 }
 
 func (u UserController) UpdateUser(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -488,16 +467,9 @@ func (u UserController) UpdateUser(c *gin.Context) {
 
 func (u UserController) ChangeUserStatus(c *gin.Context) {
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -508,6 +480,7 @@ func (u UserController) ChangeUserStatus(c *gin.Context) {
 	}
 
 	var user models.User
+	var childUsers []models.User
 
 	if currentUserRole == 2 {
 
@@ -523,19 +496,10 @@ func (u UserController) ChangeUserStatus(c *gin.Context) {
 		}
 
 		if user.Role == 2 {
-			var childUsers []models.User
 			if err := u.DB.Where("admin_id = ?", user.ID).Find(&childUsers).Error; err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi tìm tài khoản con"})
 				return
 			}
-
-			for _, child := range childUsers {
-				child.Status = statusRequest.Status
-				if err := u.DB.Save(&child).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật trạng thái của tài khoản con"})
-					return
-				}
-			}
 		}
 	} else {
 
@@ -543,12 +507,51 @@ func (u UserController) ChangeUserStatus(c *gin.Context) {
 		return
 	}
 
-	user.Status = statusRequest.Status
-	if err := u.DB.Save(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": err.Error()})
+	// Trạng thái của admin, các tài khoản con và nhật ký được ghi cùng một transaction
+	actor := services.AuditActorFromRequest(c)
+	changeStatus := func(tx *gorm.DB, target *models.User) error {
+		before := map[string]interface{}{"status": target.Status}
+		target.Status = statusRequest.Status
+		if err := tx.Model(target).Update("status", target.Status).Error; err != nil {
+			return err
+		}
+		adminID := target.AdminId
+		if target.Role == 2 {
+			adminID = &target.ID
+		}
+		return services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:     services.AuditUserStatusUpdate,
+			EntityType: "user",
+			EntityID:   target.ID,
+			AdminID:    adminID,
+			Before:     before,
+			After:      map[string]interface{}{"status": target.Status},
+		})
+	}
+
+	err = u.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range childUsers {
+			if err := changeStatus(tx, &childUsers[i]); err != nil {
+				return err
+			}
+		}
+		return changeStatus(tx, &user)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Lỗi khi cập nhật trạng thái người dùng", "detail": err.Error()})
 		return
 	}
 
+	// Khóa tài khoản thì thu hồi mọi phiên đăng nhập của tài khoản đó (và các tài khoản con)
+	if user.Status == 1 {
+		for _, banned := range append(childUsers, user) {
+			if err := services.RevokeUserTokens(banned.ID, "banned"); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": err.Error()})
+				return
+			}
+		}
+	}
+
 	//Xóa redis
 	rdb, redisErr := config.ConnectRedis()
 	if redisErr == nil {
@@ -586,9 +589,11 @@ func (u UserController) GetReceptionistByID(c *gin.Context) {
 		Name string `json:"name"`
 	}
 
-	var ids []int64
-	for _, v := range user.AccommodationIDs {
-		ids = append(ids, v)
+	// Các chỗ ở lễ tân được giao vai trò
+	ids, err := services.AssignedAccommodationIDs(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy chỗ ở được giao"})
+		return
 	}
 
 	if len(ids) > 0 {
@@ -610,7 +615,7 @@ func (u UserController) GetReceptionistByID(c *gin.Context) {
 		UserStatus:       user.Status,
 		DateOfBirth:      user.DateOfBirth,
 		Amount:           user.Amount,
-		AccommodationIDs: user.AccommodationIDs,
+		AccommodationIDs: ids,
 		CreatedAt:        user.CreatedAt,
 		UpdatedAt:        user.UpdatedAt,
 	}
@@ -653,16 +658,9 @@ func (u UserController) GetBankSuperAdmin(c *gin.Context) {
 // get Profile
 func (u UserController) GetProfile(c *gin.Context) {
 	var user models.User
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Authorization header is missing"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	id, _, err := GetUserIDFromToken(tokenString)
+	id, _, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Invalid token"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -680,6 +678,12 @@ func (u UserController) GetProfile(c *gin.Context) {
 		})
 	}
 
+	accommodationIDs, err := services.AssignedAccommodationIDs(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể lấy chỗ ở được giao"})
+		return
+	}
+
 	userResponse := UserResponse{
 		UserID:           user.ID,
 		UserName:         user.Name,
@@ -692,7 +696,7 @@ func (u UserController) GetProfile(c *gin.Context) {
 		UserStatus:       user.Status,
 		DateOfBirth:      user.DateOfBirth,
 		Amount:           user.Amount,
-		AccommodationIDs: user.AccommodationIDs,
+		AccommodationIDs: accommodationIDs,
 		CreatedAt:        user.CreatedAt,
 		UpdatedAt:        user.UpdatedAt,
 	}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"sort"
 	"strconv"
@@ -10,9 +12,12 @@ import (
 
 	"new/config"
 	"new/models"
+	"new/services"
 
 	"github.com/gin-gonic/gin"
 	"golang.org/x/text/unicode/norm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type WithdrawalHistoryInput struct {
@@ -47,16 +52,9 @@ func removeDiacritics(s string) string {
 // CreateWithdrawalHistory tạo một lịch sử rút tiền mới
 func CreateWithdrawalHistory(c *gin.Context) {
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -101,17 +99,10 @@ func CreateWithdrawalHistory(c *gin.Context) {
 }
 
 func GetWithdrawalHistory(c *gin.Context) {
-	// Kiểm tra header Authorization
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	// Lấy người dùng đã xác thực
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -233,16 +224,9 @@ func GetWithdrawalHistory(c *gin.Context) {
 }
 
 func ConfirmWithdrawalHistory(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Thiếu header Authorization"})
-		return
-	}
-
-	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
-	currentUserID, currentUserRole, err := GetUserIDFromToken(tokenString)
+	currentUserID, currentUserRole, err := currentUser(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": "Token không hợp lệ"})
+		c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
 		return
 	}
 
@@ -262,42 +246,95 @@ func ConfirmWithdrawalHistory(c *gin.Context) {
 		return
 	}
 
-	var withdrawal models.WithdrawalHistory
-	if err := config.DB.First(&withdrawal, input.ID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy đơn rút tiền", "err": err.Error()})
+	if input.Status == "2" && strings.TrimSpace(input.Reason) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Phải có lý do khi hủy giao dịch (Status = 2)"})
 		return
 	}
 
-	if input.Status == "1" {
-		var user models.User
-		if err := config.DB.First(&user, withdrawal.UserID).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"code": 0, "mess": "Không tìm thấy user", "err": err.Error()})
-			return
+	// Trừ số dư, cập nhật trạng thái đơn rút và ghi nhật ký trong cùng một transaction;
+	// đơn đã xử lý thì không xử lý lại để tránh trừ tiền hai lần
+	actor := services.AuditActorFromRequest(c)
+	var notifications []models.Notification
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var withdrawal models.WithdrawalHistory
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&withdrawal, input.ID).Error; err != nil {
+			return &orderTxError{status: http.StatusNotFound, mess: "Không tìm thấy đơn rút tiền"}
+		}
+		if withdrawal.Status != "0" {
+			return &orderTxError{status: http.StatusConflict, mess: "Đơn rút tiền đã được xử lý"}
 		}
 
-		user.Amount = user.Amount - withdrawal.Amount
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, withdrawal.UserID).Error; err != nil {
+			return &orderTxError{status: http.StatusNotFound, mess: "Không tìm thấy user"}
+		}
 
-		if err := config.DB.Save(&user).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật số dư của user", "err": err.Error()})
-			return
+		if input.Status == "1" {
+			before := map[string]interface{}{"amount": user.Amount}
+			user.Amount = user.Amount - withdrawal.Amount
+			if err := tx.Model(&user).Update("amount", user.Amount).Error; err != nil {
+				return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật số dư của user"}
+			}
+			if err := services.RecordAudit(tx, actor, services.AuditEntry{
+				Action:     services.AuditUserBalanceWithdraw,
+				EntityType: "user",
+				EntityID:   user.ID,
+				AdminID:    &user.ID,
+				Before:     before,
+				After:      map[string]interface{}{"amount": user.Amount, "withdrawalId": withdrawal.ID},
+			}); err != nil {
+				return err
+			}
 		}
-	}
 
-	if input.Status == "2" && strings.TrimSpace(input.Reason) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"code": 0, "mess": "Phải có lý do khi hủy giao dịch (Status = 2)"})
-		return
-	}
+		before := map[string]interface{}{"status": withdrawal.Status, "reason": withdrawal.Reason}
+		withdrawal.Status = input.Status
+		if input.Status == "2" {
+			withdrawal.Reason = input.Reason
+		}
+		if err := tx.Model(&withdrawal).Updates(map[string]interface{}{"status": withdrawal.Status, "reason": withdrawal.Reason}).Error; err != nil {
+			return &orderTxError{status: http.StatusInternalServerError, mess: "Không thể cập nhật trạng thái"}
+		}
 
-	withdrawal.Status = input.Status
-	if input.Status == "2" {
-		withdrawal.Reason = input.Reason
-	}
+		if err := services.RecordAudit(tx, actor, services.AuditEntry{
+			Action:     services.AuditWithdrawalStatusUpdate,
+			EntityType: "withdrawal_history",
+			EntityID:   withdrawal.ID,
+			AdminID:    &user.ID,
+			Before:     before,
+			After:      map[string]interface{}{"status": withdrawal.Status, "reason": withdrawal.Reason},
+		}); err != nil {
+			return err
+		}
 
-	if err := config.DB.Save(&withdrawal).Error; err != nil {
+		notification := services.NotificationInput{
+			Type:    services.NotificationWithdrawalApproved,
+			Title:   "Yêu cầu rút tiền đã được duyệt",
+			Body:    fmt.Sprintf("Yêu cầu rút %d đã được chuyển khoản.", withdrawal.Amount),
+			Payload: map[string]interface{}{"withdrawalId": withdrawal.ID, "amount": withdrawal.Amount},
+		}
+		if withdrawal.Status == "2" {
+			notification.Type = services.NotificationWithdrawalRejected
+			notification.Title = "Yêu cầu rút tiền bị từ chối"
+			notification.Body = fmt.Sprintf("Yêu cầu rút %d bị từ chối. Lý do: %s", withdrawal.Amount, withdrawal.Reason)
+			notification.Payload["reason"] = withdrawal.Reason
+		}
+		var err error
+		notifications, err = services.CreateNotifications(tx, []uint{user.ID}, notification)
+		return err
+	})
+	if err != nil {
+		var txErr *orderTxError
+		if errors.As(err, &txErr) {
+			c.JSON(txErr.status, gin.H{"code": 0, "mess": txErr.mess})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể cập nhật trạng thái", "err": err.Error()})
 		return
 	}
 
+	services.PublishNotifications(notifications)
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 1,
 		"mess": "Cập nhật trạng thái đơn rút tiền thành công",
@@ -3,11 +3,14 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net/http"
 	"time"
 
 	"new/config"
+	"new/controllers"
 	_ "new/docs"
+	"new/models"
 	"new/routes"
 	"new/services"
 
@@ -21,22 +24,72 @@ import (
 
 func recreateUserTable() {
 	// Nếu cần, thực hiện AutoMigrate ở đây
+	if err := config.DB.AutoMigrate(
+		&models.Order{},
+		&models.RoomStatus{},
+		&models.AccommodationStatus{},
+		&models.Invoice{},
+		&models.CancellationPolicy{},
+		&models.PricingRule{},
+		&models.OrderPriceItem{},
+		&models.SeasonalRate{},
+		&models.DailyRate{},
+		&models.OrderChange{},
+		&models.InvoicePayment{},
+		&models.Refund{},
+		&models.PaymentIntent{},
+		&models.PaymentWebhookEvent{},
+		&models.RefreshToken{},
+		&models.Session{},
+		&models.OneTimeCode{},
+		&models.TwoFactor{},
+		&models.TwoFactorRecoveryCode{},
+		&models.AuditLog{},
+		&models.Permission{},
+		&models.Role{},
+		&models.RoleAssignment{},
+		&models.EmailOutbox{},
+		&models.Notification{},
+		&models.GuestReminder{},
+		&models.EmailOptOut{},
+	); err != nil {
+		panic(fmt.Sprintf("AutoMigrate error: %v", err))
+	}
+
+	// Danh mục quyền, vai trò hệ thống và chuyển accommodation_ids cũ sang bảng giao vai trò
+	if err := services.SeedRBAC(); err != nil {
+		panic(fmt.Sprintf("Seed RBAC error: %v", err))
+	}
 }
 
 func main() {
+	// Nạp cấu hình (biến môi trường, CONFIG_FILE, .env); thiếu giá trị bắt buộc thì dừng ngay
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	log.Println("Cấu hình:", cfg.Summary())
+
+	if cfg.IsProd() {
+		gin.SetMode(gin.ReleaseMode)
+	}
 	router := gin.Default()
 
-	// Load biến môi trường
-	if err := config.LoadEnv(); err != nil {
-		panic("Failed to load .env file")
+	// Chỉ tin X-Forwarded-For từ proxy đã khai báo, để c.ClientIP() (giới hạn tần suất, phiên đăng nhập)
+	// không bị client tự đặt header giả mạo
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("❌ TRUSTED_PROXIES không hợp lệ: %v", err)
 	}
 
 	// Kết nối database và Cloudinary
-	config.ConnectDB()
-	config.ConnectCloudinary()
+	config.ConnectDB(cfg.Database)
+	config.ConnectCloudinary(cfg.Cloudinary)
+	services.Configure(cfg)
+	controllers.Configure(cfg)
 
-	// Khởi tạo WebSocket (Melody)
+	// Khởi tạo WebSocket (Melody), dùng chung cho các thông báo của services
 	m := melody.New()
+	services.ConfigureRealtime(m)
 
 	loc, _ := time.LoadLocation("Asia/Ho_Chi_Minh")
 	now := time.Now().In(loc)
@@ -44,17 +97,44 @@ func main() {
 
 	// Cron job đã có (ví dụ: chạy lúc 0h mỗi ngày)
 	c := cron.New()
-	_, err := c.AddFunc("0 0 * * *", func() {
+	_, err = c.AddFunc("0 0 * * *", func() {
 		now := time.Now()
 		fmt.Println("Running UpdateUserAmounts at:", now)
-		services.UpdateUserAmounts(m)
+		services.UpdateUserAmounts()
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Cron job error: %v", err))
+	}
+
+	// Nhả các giữ chỗ và yêu cầu thanh toán quá hạn mỗi phút
+	_, err = c.AddFunc("@every 1m", func() {
+		services.ReleaseExpiredHolds()
+		services.ExpirePaymentIntents()
 	})
 	if err != nil {
 		panic(fmt.Sprintf("Cron job error: %v", err))
 	}
-	c.Start()
 
+	// Nhắc khách trước ngày nhận phòng và mời đánh giá sau khi trả phòng, mỗi giờ từ 8h đến 20h (giờ Việt Nam);
+	// mỗi đơn chỉ được nhắc một lần cho mỗi loại nên chạy lại không gửi trùng
+	_, err = c.AddFunc("CRON_TZ=Asia/Ho_Chi_Minh 0 8-20 * * *", func() {
+		services.SendGuestReminders()
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Cron job error: %v", err))
+	}
+
+	// Gửi các email trong hàng đợi (outbox), thử lại với thời gian chờ tăng dần
+	_, err = c.AddFunc("@every 15s", func() {
+		services.DeliverOutboxEmails()
+	})
+	if err != nil {
+		panic(fmt.Sprintf("Cron job error: %v", err))
+	}
+
+	// Tạo bảng và dữ liệu quyền trước khi chạy cron, để các job không truy vấn bảng chưa tồn tại trên database mới
 	recreateUserTable()
+	c.Start()
 
 	// Kết nối Redis
 	redisCli, err := config.ConnectRedis()
@@ -75,9 +155,11 @@ func main() {
 	// Setup các routes của ứng dụng
 	routes.SetupRoutes(router, config.DB, redisCli, config.Cloudinary, m)
 
-	// Endpoint WebSocket
+	// Endpoint WebSocket: cần access token (header Authorization hoặc cookie access_token)
 	router.GET("/ws", func(c *gin.Context) {
-		m.HandleRequest(c.Writer, c.Request)
+		if err := services.ServeWebSocket(c); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+		}
 	})
 
 	// Endpoint Swagger
@@ -89,7 +171,7 @@ func main() {
 
 	// Goroutine tự động gọi endpoint /ping mỗi 5 phút
 	go func() {
-		pingURL := "https://backend.trothalo.click/ping"
+		pingURL := cfg.BackendURL + "/ping"
 		for {
 			resp, err := http.Get(pingURL)
 			if err != nil {
@@ -104,5 +186,5 @@ func main() {
 	}()
 
 	// Chạy server
-	router.Run(":8083")
+	router.Run(":" + cfg.Port)
 }
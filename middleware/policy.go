@@ -0,0 +1,301 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"new/config"
+	"new/models"
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errForbidden      = errors.New("Bạn không có quyền truy cập")
+	errMissingSubject = errors.New("Thiếu mã đối tượng cần kiểm tra quyền")
+	errSubjectMissing = errors.New("Không tìm thấy đối tượng")
+)
+
+// Policy mô tả quyền của một route: các role được phép và (tùy chọn) kiểm tra quyền sở hữu đối tượng.
+// Permission là quyền cần có trên chỗ ở của đối tượng (mặc định accommodation.view), được kiểm tra
+// bởi các OwnershipCheck dẫn tới một chỗ ở.
+// Public đánh dấu route ghi dữ liệu được mở cho khách chưa đăng nhập một cách có chủ ý.
+type Policy struct {
+	Public     bool
+	Roles      []int
+	Permission string
+	Owner      OwnershipCheck
+}
+
+// PolicyTable ánh xạ "METHOD /đường/dẫn" (theo c.FullPath()) sang Policy
+type PolicyTable map[string]Policy
+
+// OwnershipCheck trả về nil nếu người dùng có quyền permission trên đối tượng của request.
+// Superadmin không qua bước này.
+type OwnershipCheck func(c *gin.Context, claims *services.Claims, permission string) error
+
+// IDSource đọc mã đối tượng từ request
+type IDSource func(c *gin.Context) (uint, error)
+
+func parseID(value string) (uint, error) {
+	if value == "" {
+		return 0, errMissingSubject
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errMissingSubject
+	}
+	return uint(id), nil
+}
+
+// Param đọc mã từ tham số đường dẫn
+func Param(name string) IDSource {
+	return func(c *gin.Context) (uint, error) {
+		return parseID(c.Param(name))
+	}
+}
+
+// Query đọc mã từ query string
+func Query(name string) IDSource {
+	return func(c *gin.Context) (uint, error) {
+		return parseID(c.Query(name))
+	}
+}
+
+// peekJSON đọc body JSON của request rồi trả lại nguyên vẹn cho handler
+func peekJSON(c *gin.Context) (map[string]json.RawMessage, error) {
+	if c.Request.Body == nil {
+		return nil, io.EOF
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// JSONField đọc mã từ một trường của body JSON
+func JSONField(name string) IDSource {
+	return func(c *gin.Context) (uint, error) {
+		fields, err := peekJSON(c)
+		if err != nil {
+			return 0, errMissingSubject
+		}
+		var id uint
+		if err := json.Unmarshal(fields[name], &id); err != nil || id == 0 {
+			return 0, errMissingSubject
+		}
+		return id, nil
+	}
+}
+
+// OwnAccommodation: chủ chỗ ở hoặc nhân viên được giao vai trò có permission trên chỗ ở
+func OwnAccommodation(source IDSource) OwnershipCheck {
+	return func(c *gin.Context, claims *services.Claims, permission string) error {
+		accommodationID, err := source(c)
+		if err != nil {
+			return err
+		}
+		if !services.Can(claims.UserInfo.UserId, claims.UserInfo.Role, permission, accommodationID) {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// OwnRoom kiểm tra quyền trên chỗ ở chứa phòng
+func OwnRoom(source IDSource) OwnershipCheck {
+	return OwnAccommodation(func(c *gin.Context) (uint, error) {
+		roomID, err := source(c)
+		if err != nil {
+			return 0, err
+		}
+		var room models.Room
+		if err := config.DB.Select("room_id", "accommodation_id").First(&room, roomID).Error; err != nil {
+			return 0, errSubjectMissing
+		}
+		return room.AccommodationID, nil
+	})
+}
+
+// OwnOrder: khách chỉ với đơn của mình, nhân viên với đơn thuộc chỗ ở mình có permission
+func OwnOrder(source IDSource) OwnershipCheck {
+	return func(c *gin.Context, claims *services.Claims, permission string) error {
+		orderID, err := source(c)
+		if err != nil {
+			return err
+		}
+		var order models.Order
+		if err := config.DB.Select("id", "user_id", "accommodation_id").First(&order, orderID).Error; err != nil {
+			return errSubjectMissing
+		}
+		if claims.UserInfo.Role == 0 {
+			if order.UserID == nil || *order.UserID != claims.UserInfo.UserId {
+				return errForbidden
+			}
+			return nil
+		}
+		if !services.Can(claims.UserInfo.UserId, claims.UserInfo.Role, permission, order.AccommodationID) {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// OwnInvoice kiểm tra quyền trên đơn hàng của hóa đơn
+func OwnInvoice(source IDSource) OwnershipCheck {
+	return OwnOrder(func(c *gin.Context) (uint, error) {
+		invoiceID, err := source(c)
+		if err != nil {
+			return 0, err
+		}
+		var invoice models.Invoice
+		if err := config.DB.Select("id", "order_id").First(&invoice, invoiceID).Error; err != nil {
+			return 0, errSubjectMissing
+		}
+		return invoice.OrderID, nil
+	})
+}
+
+// OwnRate: người dùng chỉ sửa đánh giá của chính mình
+func OwnRate(source IDSource) OwnershipCheck {
+	return func(c *gin.Context, claims *services.Claims, _ string) error {
+		rateID, err := source(c)
+		if err != nil {
+			return err
+		}
+		var rate models.Rate
+		if err := config.DB.Select("id", "user_id").First(&rate, rateID).Error; err != nil {
+			return errSubjectMissing
+		}
+		if rate.UserID != claims.UserInfo.UserId {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// Self: mã người dùng trong request phải là chính người gọi
+func Self(source IDSource) OwnershipCheck {
+	return func(c *gin.Context, claims *services.Claims, _ string) error {
+		userID, err := source(c)
+		if err != nil {
+			return err
+		}
+		if userID != claims.UserInfo.UserId {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// ManagedUser: admin chỉ thao tác trên tài khoản lễ tân do mình quản lý
+func ManagedUser(source IDSource) OwnershipCheck {
+	return func(c *gin.Context, claims *services.Claims, _ string) error {
+		userID, err := source(c)
+		if err != nil {
+			return err
+		}
+		var user models.User
+		if err := config.DB.Select("id", "admin_id").First(&user, userID).Error; err != nil {
+			return errSubjectMissing
+		}
+		if user.AdminId == nil || *user.AdminId != claims.UserInfo.UserId {
+			return errForbidden
+		}
+		return nil
+	}
+}
+
+// Authorize áp dụng một Policy: 401 khi thiếu/sai token, 403 khi sai role hoặc không sở hữu đối tượng
+func Authorize(policy Policy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if policy.Public {
+			c.Next()
+			return
+		}
+
+		claims, err := services.AuthenticateRequest(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+
+		if len(policy.Roles) > 0 {
+			hasRole := false
+			for _, role := range policy.Roles {
+				if claims.UserInfo.Role == role {
+					hasRole = true
+					break
+				}
+			}
+			if !hasRole {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 0, "mess": errForbidden.Error()})
+				return
+			}
+		}
+
+		if policy.Owner != nil && claims.UserInfo.Role != 1 {
+			permission := policy.Permission
+			if permission == "" {
+				permission = services.PermAccommodationView
+			}
+			if err := policy.Owner(c, claims, permission); err != nil {
+				switch {
+				case errors.Is(err, errMissingSubject):
+					c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"code": 0, "mess": err.Error()})
+				case errors.Is(err, errSubjectMissing):
+					c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"code": 0, "mess": err.Error()})
+				default:
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 0, "mess": errForbidden.Error()})
+				}
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// Enforce tra Policy theo route đã khớp và áp dụng; route không có trong bảng đi tiếp như cũ
+func Enforce(table PolicyTable) gin.HandlerFunc {
+	handlers := make(map[string]gin.HandlerFunc, len(table))
+	for route, policy := range table {
+		handlers[route] = Authorize(policy)
+	}
+
+	return func(c *gin.Context) {
+		if handler, exists := handlers[c.Request.Method+" "+c.FullPath()]; exists {
+			handler(c)
+			return
+		}
+		c.Next()
+	}
+}
+
+// MissingPolicies trả về các route ghi dữ liệu (không phải GET) chưa được khai báo trong bảng
+func MissingPolicies(table PolicyTable, routes gin.RoutesInfo) []string {
+	var missing []string
+	for _, route := range routes {
+		if route.Method == http.MethodGet || route.Method == http.MethodHead || route.Method == http.MethodOptions {
+			continue
+		}
+		key := fmt.Sprintf("%s %s", route.Method, route.Path)
+		if _, exists := table[key]; !exists {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"new/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitKey trả về giá trị dùng để đếm request; false thì bỏ qua giới hạn này cho request
+type RateLimitKey func(c *gin.Context) (string, bool)
+
+// RateLimit giới hạn tối đa Limit request trong cửa sổ trượt Window cho mỗi giá trị Key
+type RateLimit struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+	Key    RateLimitKey
+}
+
+// RateLimitTable ánh xạ "METHOD /đường/dẫn" sang các giới hạn áp dụng cho route
+type RateLimitTable map[string][]RateLimit
+
+// ByIP đếm theo địa chỉ IP của client
+func ByIP() RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		return "ip:" + c.ClientIP(), true
+	}
+}
+
+// ByUser đếm theo người dùng đã đăng nhập, khách chưa đăng nhập không bị áp giới hạn này
+func ByUser() RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		claims, err := services.AuthenticateRequest(c)
+		if err != nil {
+			return "", false
+		}
+		return "user:" + strconv.FormatUint(uint64(claims.UserInfo.UserId), 10), true
+	}
+}
+
+// ByJSONField đếm theo một trường chuỗi trong body (email, identifier...), không phân biệt hoa thường
+func ByJSONField(name string) RateLimitKey {
+	return func(c *gin.Context) (string, bool) {
+		fields, err := peekJSON(c)
+		if err != nil {
+			return "", false
+		}
+		var value string
+		if err := json.Unmarshal(fields[name], &value); err != nil || value == "" {
+			return "", false
+		}
+		return name + ":" + strings.ToLower(strings.TrimSpace(value)), true
+	}
+}
+
+// Limit áp dụng các giới hạn của route đã khớp, vượt giới hạn trả 429 kèm Retry-After
+func Limit(table RateLimitTable) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		for _, rule := range table[route] {
+			key, ok := rule.Key(c)
+			if !ok {
+				continue
+			}
+
+			allowed, retryAfter, _ := services.AllowRequest(c.Request.Context(), route+":"+rule.Name+":"+key, rule.Limit, rule.Window)
+			if !allowed {
+				c.Header("Retry-After", services.RetryAfterSeconds(retryAfter))
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"code": 0, "mess": "Bạn thao tác quá nhiều lần, vui lòng thử lại sau"})
+				return
+			}
+		}
+		c.Next()
+	}
+}
@@ -26,6 +26,7 @@ type Accommodation struct {
 	Furniture        json.RawMessage       `json:"furniture" gorm:"type:json"`
 	People           int                   `json:"people"`
 	Price            int                   `json:"price"`
+	WeekendPrice     int                   `json:"weekendPrice"`                                      // Giá đêm thứ 6, thứ 7, 0 = dùng Price
 	Benefits         []Benefit             `json:"benefits" gorm:"many2many:accommodation_benefits;"` // Mối quan hệ nhiều-nhiều
 	NumBed           int                   `json:"numBed"`
 	NumTolet         int                   `json:"numTolet"`
@@ -3,11 +3,18 @@ package models
 import "time"
 
 type AccommodationStatus struct {
-	ID              uint      `gorm:"primaryKey"`
-	AccommodationID uint      `gorm:"index"` // Liên kết với phòng
-	FromDate        time.Time `gorm:"index"` // Ngày bắt đầu trạng thái
-	ToDate          time.Time `gorm:"index"` // Ngày kết thúc trạng thái
-	Status          int       // 0: có sẵn, 1: đã đặt, 2: đang bảo trì, v.v.
+	ID              uint       `gorm:"primaryKey"`
+	AccommodationID uint       `gorm:"index"` // Liên kết với phòng
+	OrderID         *uint      `gorm:"index"` // Đơn hàng tạo ra trạng thái này (nếu có)
+	FromDate        time.Time  `gorm:"index"` // Ngày bắt đầu trạng thái
+	ToDate          time.Time  `gorm:"index"` // Ngày kết thúc trạng thái
+	Status          int        // 0: có sẵn, 1: đã đặt, 2: đang bảo trì, 3: đang giữ chỗ
+	ExpiresAt       *time.Time `gorm:"index"` // Hạn giữ chỗ, chỉ dùng khi Status = 3
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
+
+// IsActive cho biết trạng thái còn chiếm lịch chỗ ở hay không (giữ chỗ quá hạn coi như đã nhả)
+func (s AccommodationStatus) IsActive(now time.Time) bool {
+	return isStatusActive(s.Status, s.ExpiresAt, now)
+}
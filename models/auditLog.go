@@ -0,0 +1,36 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAuditLogAppendOnly = errors.New("nhật ký kiểm toán chỉ được ghi thêm, không được sửa hoặc xóa")
+
+// AuditLog ghi lại ai đã thay đổi gì trên dữ liệu tiền và trạng thái. Bảng chỉ ghi thêm:
+// Before/After là JSON chỉ gồm các trường đã thay đổi.
+// AdminID là admin sở hữu dữ liệu, dùng để admin xem nhật ký của mình (cùng AccommodationID).
+type AuditLog struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	ActorID         *uint     `json:"actorId" gorm:"index"`
+	ActorRole       *int      `json:"actorRole"`
+	Action          string    `json:"action" gorm:"size:64;index;not null"`
+	EntityType      string    `json:"entityType" gorm:"size:64;index:idx_audit_entity;not null"`
+	EntityID        uint      `json:"entityId" gorm:"index:idx_audit_entity"`
+	AccommodationID *uint     `json:"accommodationId" gorm:"index"`
+	AdminID         *uint     `json:"adminId" gorm:"index"`
+	Before          string    `json:"before" gorm:"type:jsonb"`
+	After           string    `json:"after" gorm:"type:jsonb"`
+	IP              string    `json:"ip" gorm:"size:64"`
+	CreatedAt       time.Time `json:"createdAt" gorm:"autoCreateTime;index"`
+}
+
+func (a *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+func (a *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
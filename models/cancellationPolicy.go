@@ -0,0 +1,97 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Các mức chính sách hủy có sẵn, "custom" cho phép chủ nhà tự khai báo Tiers
+const (
+	PolicyFlexible = "flexible"
+	PolicyModerate = "moderate"
+	PolicyStrict   = "strict"
+	PolicyCustom   = "custom"
+)
+
+// CancellationTier: hủy trước ngày nhận phòng ít nhất DaysBefore ngày thì được hoàn RefundPercent %
+type CancellationTier struct {
+	DaysBefore    int `json:"daysBefore"`
+	RefundPercent int `json:"refundPercent"`
+}
+
+type CancellationPolicy struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	AccommodationID uint            `json:"accommodationId" gorm:"uniqueIndex;not null"`
+	Type            string          `json:"type" gorm:"type:varchar(20);not null;default:flexible"`
+	Tiers           json.RawMessage `json:"tiers" gorm:"type:json"`
+	CreatedAt       time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time       `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+var presetCancellationTiers = map[string][]CancellationTier{
+	PolicyFlexible: {{DaysBefore: 1, RefundPercent: 100}},
+	PolicyModerate: {{DaysBefore: 5, RefundPercent: 100}, {DaysBefore: 1, RefundPercent: 50}},
+	PolicyStrict:   {{DaysBefore: 14, RefundPercent: 100}, {DaysBefore: 7, RefundPercent: 50}},
+}
+
+// DefaultCancellationPolicy áp dụng cho chỗ ở chưa khai báo chính sách
+func DefaultCancellationPolicy(accommodationID uint) CancellationPolicy {
+	tiers, _ := json.Marshal(presetCancellationTiers[PolicyFlexible])
+	return CancellationPolicy{AccommodationID: accommodationID, Type: PolicyFlexible, Tiers: tiers}
+}
+
+// GetTiers trả về các mức hoàn tiền, sắp xếp theo số ngày giảm dần
+func (p *CancellationPolicy) GetTiers() ([]CancellationTier, error) {
+	var tiers []CancellationTier
+	if preset, ok := presetCancellationTiers[p.Type]; ok {
+		tiers = append(tiers, preset...)
+	} else if len(p.Tiers) > 0 {
+		if err := json.Unmarshal(p.Tiers, &tiers); err != nil {
+			return nil, fmt.Errorf("định dạng mức hoàn tiền không hợp lệ: %v", err)
+		}
+	}
+
+	sort.Slice(tiers, func(i, j int) bool { return tiers[i].DaysBefore > tiers[j].DaysBefore })
+	return tiers, nil
+}
+
+func (p *CancellationPolicy) Validate() error {
+	if _, ok := presetCancellationTiers[p.Type]; ok {
+		tiers, _ := json.Marshal(presetCancellationTiers[p.Type])
+		p.Tiers = tiers
+		return nil
+	}
+	if p.Type != PolicyCustom {
+		return fmt.Errorf("invalid Type: %s, must be one of flexible, moderate, strict, custom", p.Type)
+	}
+
+	tiers, err := p.GetTiers()
+	if err != nil {
+		return err
+	}
+	if len(tiers) == 0 {
+		return fmt.Errorf("chính sách custom cần ít nhất một mức hoàn tiền")
+	}
+	for _, tier := range tiers {
+		if tier.DaysBefore < 0 || tier.RefundPercent < 0 || tier.RefundPercent > 100 {
+			return fmt.Errorf("mức hoàn tiền không hợp lệ: %d ngày - %d%%", tier.DaysBefore, tier.RefundPercent)
+		}
+	}
+	return nil
+}
+
+// RefundPercent tính % được hoàn khi hủy lúc còn daysBefore ngày trước ngày nhận phòng
+func (p *CancellationPolicy) RefundPercent(daysBefore int) int {
+	tiers, err := p.GetTiers()
+	if err != nil {
+		return 0
+	}
+	for _, tier := range tiers {
+		if daysBefore >= tier.DaysBefore {
+			return tier.RefundPercent
+		}
+	}
+	return 0
+}
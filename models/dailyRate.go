@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// DailyRate là giá ghi đè cho đúng một đêm, ưu tiên hơn giá theo mùa và giá cuối tuần
+type DailyRate struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	RoomID          *uint     `json:"roomId" gorm:"uniqueIndex:idx_daily_rate_room_date"`
+	AccommodationID *uint     `json:"accommodationId" gorm:"uniqueIndex:idx_daily_rate_acc_date"`
+	Date            time.Time `json:"date" gorm:"not null;uniqueIndex:idx_daily_rate_room_date;uniqueIndex:idx_daily_rate_acc_date"`
+	Price           int       `json:"price"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Trạng thái của một email trong hàng đợi gửi
+const (
+	EmailPending = 0 // Chờ gửi (lần đầu hoặc chờ thử lại sau NextAttemptAt)
+	EmailSending = 1 // Đang được worker gửi; quá NextAttemptAt mà chưa xong thì được gửi lại
+	EmailSent    = 2 // Đã gửi thành công
+	EmailDead    = 3 // Thất bại quá số lần thử, chờ admin kiểm tra và gửi lại
+)
+
+// EmailOutbox là email được ghi cùng transaction với dữ liệu nghiệp vụ và gửi sau bởi worker.
+// Nội dung đã render sẵn; sau khi gửi thành công nội dung bị xóa (có thể chứa mã, mật khẩu).
+type EmailOutbox struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Recipients    string     `json:"recipients" gorm:"not null"` // Các địa chỉ nhận, phân cách bằng dấu phẩy
+	Template      string     `json:"template" gorm:"size:64;index"`
+	Subject       string     `json:"subject"`
+	HTML          string     `json:"-" gorm:"type:text"`
+	Text          string     `json:"-" gorm:"type:text"`
+	Status        int        `json:"status" gorm:"index:idx_email_outbox_due"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"nextAttemptAt" gorm:"index:idx_email_outbox_due"`
+	LastError     string     `json:"lastError,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Loại email nhắc gửi cho khách theo lịch
+const (
+	ReminderCheckIn = "check_in" // Nhắc trước ngày nhận phòng
+	ReminderReview  = "review"   // Mời đánh giá sau ngày trả phòng
+)
+
+// GuestReminder ghi nhận một email nhắc đã được xếp hàng cho đơn. Khóa (OrderID, Kind) duy nhất
+// nên job chạy lại (kể cả sau khi khởi động lại) không gửi trùng. Skipped là khách đã từ chối nhận.
+type GuestReminder struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"orderId" gorm:"not null;uniqueIndex:idx_guest_reminder"`
+	Kind      string    `json:"kind" gorm:"size:20;not null;uniqueIndex:idx_guest_reminder"`
+	Email     string    `json:"email"`
+	Skipped   bool      `json:"skipped" gorm:"default:false"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// EmailOptOut là địa chỉ email (viết thường) đã từ chối nhận email nhắc lịch và mời đánh giá;
+// email giao dịch (xác nhận đơn, mã OTP...) vẫn được gửi
+type EmailOptOut struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"uniqueIndex;size:255;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
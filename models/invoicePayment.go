@@ -0,0 +1,40 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Phương thức thanh toán, trùng với giá trị PaymentType của Invoice
+const (
+	PaymentMethodCash = 0
+	PaymentMethodBank = 1
+	PaymentMethodMomo = 2
+)
+
+// InvoicePayment là một lần thu tiền của hóa đơn. Hóa đơn có thể thu nhiều lần (đặt cọc, trả nốt khi nhận phòng),
+// PaidAmount/RemainingAmount/Status của Invoice được tính lại từ các khoản chưa bị hủy.
+type InvoicePayment struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	InvoiceID  uint       `json:"invoiceId" gorm:"index;not null"`
+	Amount     float64    `json:"amount" gorm:"not null"`
+	Method     int        `json:"method"` // 0: tiền mặt, 1: ck ngân hàng, 2: momo
+	PaidAt     time.Time  `json:"paidAt"`
+	StaffID    *uint      `json:"staffId"` // Nhân viên ghi nhận, nil nếu thanh toán online
+	Note       string     `json:"note"`
+	VoidedAt   *time.Time `json:"voidedAt,omitempty"`
+	VoidedBy   *uint      `json:"voidedBy,omitempty"`
+	VoidReason string     `json:"voidReason,omitempty"`
+	CreatedAt  time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt  time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (p *InvoicePayment) Validate() error {
+	if p.Amount <= 0 {
+		return fmt.Errorf("số tiền thanh toán phải lớn hơn 0")
+	}
+	if p.Method < PaymentMethodCash || p.Method > PaymentMethodMomo {
+		return fmt.Errorf("phương thức thanh toán không hợp lệ: %d", p.Method)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Notification là một thông báo trong hộp thư của người dùng. Type là loại sự kiện (ví dụ "order.created"),
+// Payload là JSON chứa id liên quan để giao diện mở đúng màn hình; ReadAt rỗng là chưa đọc.
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"not null;index:idx_notification_user_read"`
+	Type      string     `json:"type" gorm:"size:64;not null"`
+	Title     string     `json:"title" gorm:"not null"`
+	Body      string     `json:"body"`
+	Payload   string     `json:"payload" gorm:"type:jsonb"`
+	ReadAt    *time.Time `json:"readAt" gorm:"index:idx_notification_user_read"`
+	CreatedAt time.Time  `json:"createdAt" gorm:"autoCreateTime;index"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Mục đích của mã dùng một lần, mỗi mục đích có mã và hạn dùng riêng
+const (
+	OTPPurposeVerifyEmail        = "verify_email"
+	OTPPurposeResetPassword      = "reset_password"
+	OTPPurposeResetPasswordGrant = "reset_password_grant" // Cấp sau khi xác thực mã đặt lại, dùng để đổi mật khẩu
+	OTPPurposeLogin              = "login"
+	OTPPurposeSensitiveAction    = "sensitive_action"
+)
+
+// OneTimeCode là một mã dùng một lần của người dùng. Chỉ lưu HMAC của mã, không lưu mã gốc.
+type OneTimeCode struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"userId" gorm:"index:idx_one_time_code_user_purpose;not null"`
+	Purpose     string     `json:"purpose" gorm:"index:idx_one_time_code_user_purpose;size:30;not null"`
+	CodeHash    string     `json:"-" gorm:"size:64;not null"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"maxAttempts"`
+	ConsumedAt  *time.Time `json:"consumedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -5,27 +5,30 @@ import (
 )
 
 type Order struct {
-	ID               uint          `json:"id" gorm:"primaryKey"`
-	UserID           *uint         `json:"userId"`
-	User             *User         `json:"user" gorm:"foreignKey:UserID"`
-	AccommodationID  uint          `json:"accommodationId"`
-	Accommodation    Accommodation `json:"accommodation" gorm:"foreignKey:AccommodationID;"`
-	RoomID           []uint        `json:"roomId" gorm:"-"`
-	Room             []Room        `json:"rooms" gorm:"many2many:order_rooms;"`
-	CheckInDate      string        `json:"checkInDate"`
-	CheckOutDate     string        `json:"checkOutDate"`
-	Status           int           `json:"status"`
-	CreatedAt        time.Time     `gorm:"autoCreateTime" json:"createdAt"`
-	UpdatedAt        time.Time     `gorm:"autoUpdateTime" json:"updatedAt"`
-	GuestName        string        `json:"guestName,omitempty"`
-	GuestEmail       string        `json:"guestEmail,omitempty"`
-	GuestPhone       string        `json:"guestPhone,omitempty"`
-	Price            int           `json:"price"`            // Giá cơ bản cho mỗi phòng
-	HolidayPrice     float64       `json:"holidayPrice"`     // Giá lễ 10
-	CheckInRushPrice float64       `json:"checkInRushPrice"` // Giá check-in gấp 5
-	SoldOutPrice     float64       `json:"soldOutPrice"`     // Giá sold out 5
-	DiscountPrice    float64       `json:"discountPrice"`    // Giá discount 20
-	TotalPrice       float64       `json:"totalPrice"`       // Tổng giá
+	ID               uint             `json:"id" gorm:"primaryKey"`
+	UserID           *uint            `json:"userId"`
+	User             *User            `json:"user" gorm:"foreignKey:UserID"`
+	AccommodationID  uint             `json:"accommodationId"`
+	Accommodation    Accommodation    `json:"accommodation" gorm:"foreignKey:AccommodationID;"`
+	RoomID           []uint           `json:"roomId" gorm:"-"`
+	Room             []Room           `json:"rooms" gorm:"many2many:order_rooms;"`
+	CheckInDate      string           `json:"checkInDate"`
+	CheckOutDate     string           `json:"checkOutDate"`
+	Status           int              `json:"status"`
+	CreatedAt        time.Time        `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt        time.Time        `gorm:"autoUpdateTime" json:"updatedAt"`
+	GuestName        string           `json:"guestName,omitempty"`
+	GuestEmail       string           `json:"guestEmail,omitempty"`
+	GuestPhone       string           `json:"guestPhone,omitempty"`
+	Price            int              `json:"price"`                                       // Giá cơ bản cho mỗi phòng
+	HolidayPrice     float64          `json:"holidayPrice"`                                // Giá lễ 10
+	CheckInRushPrice float64          `json:"checkInRushPrice"`                            // Giá check-in gấp 5
+	SoldOutPrice     float64          `json:"soldOutPrice"`                                // Giá sold out 5
+	DiscountPrice    float64          `json:"discountPrice"`                               // Giá discount 20
+	TotalPrice       float64          `json:"totalPrice"`                                  // Tổng giá
+	HoldExpiresAt    *time.Time       `json:"holdExpiresAt,omitempty"`                     // Hạn giữ chỗ khi đơn chưa được xác nhận
+	PriceItems       []OrderPriceItem `json:"priceItems" gorm:"foreignKey:OrderID"`        // Bảng giá chi tiết theo từng quy tắc đã áp dụng
+	Changes          []OrderChange    `json:"changes,omitempty" gorm:"foreignKey:OrderID"` // Lịch sử sửa đơn
 }
 
 type OrderRequest struct {
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// OrderChange ghi lại một lần sửa đơn: ai sửa, dữ liệu trước/sau và phần chênh lệch giá
+type OrderChange struct {
+	ID              uint            `json:"id" gorm:"primaryKey"`
+	OrderID         uint            `json:"orderId" gorm:"index;not null"`
+	ChangedBy       uint            `json:"changedBy"`
+	ChangedByRole   int             `json:"changedByRole"`
+	Before          json.RawMessage `json:"before" gorm:"type:json"`
+	After           json.RawMessage `json:"after" gorm:"type:json"`
+	PriceDifference float64         `json:"priceDifference"` // Tổng giá mới - tổng giá cũ
+	CreatedAt       time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// OrderSnapshot là các thông tin có thể sửa của đơn, lưu vào Before/After của OrderChange
+type OrderSnapshot struct {
+	CheckInDate  string  `json:"checkInDate"`
+	CheckOutDate string  `json:"checkOutDate"`
+	RoomID       []uint  `json:"roomId"`
+	GuestName    string  `json:"guestName"`
+	GuestEmail   string  `json:"guestEmail"`
+	GuestPhone   string  `json:"guestPhone"`
+	TotalPrice   float64 `json:"totalPrice"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Trạng thái của một lần thanh toán online
+const (
+	IntentPending   = 0 // Đang chờ khách thanh toán
+	IntentSucceeded = 1 // Cổng thanh toán báo thành công, đã ghi vào sổ thanh toán của hóa đơn
+	IntentFailed    = 2 // Cổng thanh toán báo thất bại hoặc khách hủy
+	IntentExpired   = 3 // Quá hạn mà không có kết quả
+	IntentOrphaned  = 4 // Đã nhận tiền nhưng đơn đã bị hủy hoặc hóa đơn đã được thu, cần hoàn tiền thủ công
+)
+
+// PaymentIntent là một yêu cầu thanh toán online cho đơn hàng qua một cổng thanh toán
+type PaymentIntent struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Code          string     `json:"code" gorm:"uniqueIndex;size:40;not null"` // Mã gửi sang cổng thanh toán (vnp_TxnRef, orderId...)
+	OrderID       uint       `json:"orderId" gorm:"index;not null"`
+	UserID        *uint      `json:"userId"`
+	Provider      string     `json:"provider" gorm:"size:20;not null"`
+	Amount        float64    `json:"amount"`
+	Status        int        `json:"status"`
+	PaymentURL    string     `json:"paymentUrl"`
+	QRCode        string     `json:"qrCode,omitempty"`
+	ProviderTxnID string     `json:"providerTxnId,omitempty"`
+	FailureReason string     `json:"failureReason,omitempty"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	PaidAt        *time.Time `json:"paidAt,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// PaymentWebhookEvent lưu mỗi callback đã nhận, khóa (Provider, EventID) duy nhất để xử lý idempotent
+type PaymentWebhookEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Provider  string    `json:"provider" gorm:"size:20;not null;uniqueIndex:idx_payment_webhook_event"`
+	EventID   string    `json:"eventId" gorm:"size:100;not null;uniqueIndex:idx_payment_webhook_event"`
+	IntentID  uint      `json:"intentId" gorm:"index"`
+	Payload   string    `json:"payload" gorm:"type:text"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
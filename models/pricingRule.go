@@ -0,0 +1,64 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Các loại quy tắc giá được hỗ trợ
+const (
+	RuleOccupancySurge = "occupancy_surge" // Tăng giá khi tỉ lệ lấp đầy >= Threshold %
+	RuleLastMinute     = "last_minute"     // Đặt sát ngày: còn <= Threshold ngày tới ngày nhận phòng
+	RuleEarlyBird      = "early_bird"      // Đặt sớm: còn >= Threshold ngày tới ngày nhận phòng
+	RuleLengthOfStay   = "length_of_stay"  // Ở dài ngày: số đêm >= Threshold
+	RuleHoliday        = "holiday"         // Phụ thu ngày lễ, có thể giới hạn theo tỉnh
+	RuleDiscount       = "discount"        // Mã giảm giá của người dùng (không cấu hình được, luôn áp dụng sau cùng)
+)
+
+// PricingRule là một quy tắc điều chỉnh giá. AccommodationID = nil là quy tắc chung do superadmin cấu hình.
+// Percent dương là phụ thu, âm là giảm giá, tính trên giá cơ bản của đơn.
+type PricingRule struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	AccommodationID *uint     `json:"accommodationId" gorm:"index"`
+	Name            string    `json:"name"`
+	Type            string    `json:"type" gorm:"type:varchar(30);not null"`
+	Priority        int       `json:"priority" gorm:"default:0"` // Thứ tự áp dụng, nhỏ chạy trước
+	Threshold       int       `json:"threshold"`                 // Ngưỡng, ý nghĩa tùy theo Type
+	Percent         float64   `json:"percent"`
+	Province        string    `json:"province"`               // Chỉ dùng cho quy tắc holiday, rỗng = mọi tỉnh
+	HolidayID       *uint     `json:"holidayId"`              // Chỉ dùng cho quy tắc holiday, nil = mọi ngày lễ
+	Status          int       `json:"status" gorm:"not null"` // 1: đang áp dụng, 0: tắt
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (r *PricingRule) Validate() error {
+	switch r.Type {
+	case RuleOccupancySurge, RuleLastMinute, RuleEarlyBird, RuleLengthOfStay, RuleHoliday:
+	default:
+		return fmt.Errorf("invalid Type: %s", r.Type)
+	}
+	if r.Threshold < 0 {
+		return fmt.Errorf("invalid Threshold: %d, must be >= 0", r.Threshold)
+	}
+	if r.Percent < -100 || r.Percent > 100 {
+		return fmt.Errorf("invalid Percent: %.2f, must be between -100 and 100", r.Percent)
+	}
+	if r.Status < 0 || r.Status > 1 {
+		return fmt.Errorf("invalid Status: %d, must be either 0 or 1", r.Status)
+	}
+	return nil
+}
+
+// OrderPriceItem là một dòng trong bảng giá chi tiết của đơn hàng
+type OrderPriceItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"orderId" gorm:"index;not null"`
+	RuleID    *uint     `json:"ruleId"`
+	Type      string    `json:"type" gorm:"type:varchar(30)"`
+	Name      string    `json:"name"`
+	Percent   float64   `json:"percent"`
+	Amount    float64   `json:"amount"` // Dương là phụ thu, âm là giảm giá
+	Sort      int       `json:"sort"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Permission là một quyền thao tác có tên, ví dụ "room.edit"
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Code        string `json:"code" gorm:"uniqueIndex;size:64;not null"`
+	Description string `json:"description"`
+}
+
+// Role là tập quyền được đặt tên. Vai trò hệ thống (System) do ứng dụng tạo và không sửa được;
+// admin có thể tự tạo vai trò riêng (OwnerID là admin tạo) để giao cho nhân viên của mình.
+type Role struct {
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"size:64;not null;uniqueIndex:idx_role_owner_name"`
+	Description string       `json:"description"`
+	System      bool         `json:"system" gorm:"default:false"`
+	OwnerID     *uint        `json:"ownerId,omitempty" gorm:"uniqueIndex:idx_role_owner_name"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions;"`
+	CreatedAt   time.Time    `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time    `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// RoleAssignment giao một vai trò cho người dùng trên một chỗ ở, thay cho User.AccommodationIDs trước đây
+type RoleAssignment struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	UserID          uint      `json:"userId" gorm:"not null;uniqueIndex:idx_role_assignment"`
+	RoleID          uint      `json:"roleId" gorm:"not null;uniqueIndex:idx_role_assignment"`
+	Role            Role      `json:"role" gorm:"foreignKey:RoleID"`
+	AccommodationID uint      `json:"accommodationId" gorm:"not null;index;uniqueIndex:idx_role_assignment"`
+	AssignedBy      *uint     `json:"assignedBy,omitempty"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
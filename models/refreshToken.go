@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshToken lưu từng refresh token đã phát hành (chỉ lưu hash của jti).
+// Các token sinh ra từ cùng một lần đăng nhập chung FamilyID; mỗi lần làm mới, token cũ
+// được đánh dấu RotatedAt và dùng lại token đã xoay sẽ thu hồi cả họ token.
+type RefreshToken struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	UserID        uint       `json:"userId" gorm:"index;not null"`
+	FamilyID      string     `json:"familyId" gorm:"index;size:64;not null"`
+	TokenHash     string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	RotatedAt     *time.Time `json:"rotatedAt,omitempty"`
+	ReplacedByID  *uint      `json:"replacedById,omitempty"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+	RevokedReason string     `json:"revokedReason,omitempty"`
+	UserAgent     string     `json:"userAgent"`
+	IP            string     `json:"ip"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Trạng thái hoàn tiền
+const (
+	RefundPending   = 0
+	RefundCompleted = 1
+	RefundRejected  = 2
+)
+
+// Refund là một khoản hoàn tiền cho hóa đơn khi đơn bị hủy
+type Refund struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	InvoiceID   uint       `json:"invoiceId" gorm:"index;not null"`
+	OrderID     uint       `json:"orderId" gorm:"index;not null"`
+	AdminID     uint       `json:"adminId" gorm:"index"` // Chủ chỗ ở chịu khoản hoàn, giống Invoice.AdminID
+	Amount      float64    `json:"amount"`
+	Percent     int        `json:"percent"` // % hoàn theo chính sách hủy tại thời điểm hủy
+	Method      *int       `json:"method"`  // 0: tiền mặt, 1: ck ngân hàng, 2: momo; nil khi chưa hoàn
+	Reason      string     `json:"reason"`
+	Status      int        `json:"status"` // 0: chờ hoàn, 1: đã hoàn, 2: từ chối
+	CreatedBy   uint       `json:"createdBy"`
+	ProcessedBy *uint      `json:"processedBy,omitempty"`
+	ProcessedAt *time.Time `json:"processedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (r *Refund) Validate() error {
+	if r.Status < RefundPending || r.Status > RefundRejected {
+		return fmt.Errorf("invalid Status: %d", r.Status)
+	}
+	if r.Method != nil && (*r.Method < PaymentMethodCash || *r.Method > PaymentMethodMomo) {
+		return fmt.Errorf("invalid Method: %d", *r.Method)
+	}
+	if r.Status == RefundCompleted && r.Method == nil {
+		return fmt.Errorf("cần chọn phương thức hoàn tiền")
+	}
+	return nil
+}
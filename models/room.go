@@ -15,6 +15,7 @@ type Room struct {
 	NumTolet        int             `json:"numTolet"`
 	Acreage         int             `json:"acreage"`
 	Price           int             `json:"price"`
+	WeekendPrice    int             `json:"weekendPrice"` // Giá đêm thứ 6, thứ 7, 0 = dùng Price
 	Description     string          `json:"description"`
 	CreatedAt       time.Time       `gorm:"autoCreateTime" json:"createdAt"`
 	UpdatedAt       time.Time       `gorm:"autoUpdateTime" json:"updatedAt"`
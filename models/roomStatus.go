@@ -2,12 +2,37 @@ package models
 
 import "time"
 
+// Giá trị Status dùng chung cho RoomStatus và AccommodationStatus
+const (
+	StatusAvailable   = 0
+	StatusBooked      = 1
+	StatusMaintenance = 2
+	StatusHold        = 3 // Giữ chỗ tạm thời khi khách đang thanh toán, tự hết hạn theo ExpiresAt
+)
+
 type RoomStatus struct {
-	ID        uint      `gorm:"primaryKey"`
-	RoomID    uint      `gorm:"index"` // Liên kết với phòng
-	FromDate  time.Time `gorm:"index"` // Ngày bắt đầu trạng thái
-	ToDate    time.Time `gorm:"index"` // Ngày kết thúc trạng thái
-	Status    int       // 0: có sẵn, 1: đã đặt, 2: đang bảo trì, v.v.
+	ID        uint       `gorm:"primaryKey"`
+	RoomID    uint       `gorm:"index"` // Liên kết với phòng
+	OrderID   *uint      `gorm:"index"` // Đơn hàng tạo ra trạng thái này (nếu có)
+	FromDate  time.Time  `gorm:"index"` // Ngày bắt đầu trạng thái
+	ToDate    time.Time  `gorm:"index"` // Ngày kết thúc trạng thái
+	Status    int        // 0: có sẵn, 1: đã đặt, 2: đang bảo trì, 3: đang giữ chỗ
+	ExpiresAt *time.Time `gorm:"index"` // Hạn giữ chỗ, chỉ dùng khi Status = 3
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
+
+// IsActive cho biết trạng thái còn chiếm lịch phòng hay không (giữ chỗ quá hạn coi như đã nhả)
+func (s RoomStatus) IsActive(now time.Time) bool {
+	return isStatusActive(s.Status, s.ExpiresAt, now)
+}
+
+func isStatusActive(status int, expiresAt *time.Time, now time.Time) bool {
+	if status == StatusAvailable {
+		return false
+	}
+	if status == StatusHold && expiresAt != nil && !expiresAt.After(now) {
+		return false
+	}
+	return true
+}
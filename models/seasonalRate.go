@@ -0,0 +1,33 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// SeasonalRate là giá theo mùa cho một phòng (RoomID) hoặc cả chỗ ở (AccommodationID) trong khoảng ngày
+type SeasonalRate struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	RoomID          *uint     `json:"roomId" gorm:"index"`
+	AccommodationID *uint     `json:"accommodationId" gorm:"index"`
+	Name            string    `json:"name"`
+	FromDate        time.Time `json:"fromDate" gorm:"index"` // Đêm đầu tiên áp dụng
+	ToDate          time.Time `json:"toDate" gorm:"index"`   // Đêm cuối cùng áp dụng (tính cả ngày này)
+	Price           int       `json:"price"`
+	WeekendPrice    int       `json:"weekendPrice"` // Giá đêm thứ 6, thứ 7 trong mùa, 0 = dùng Price
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+func (r *SeasonalRate) Validate() error {
+	if (r.RoomID == nil) == (r.AccommodationID == nil) {
+		return fmt.Errorf("cần chọn đúng một trong roomId hoặc accommodationId")
+	}
+	if r.ToDate.Before(r.FromDate) {
+		return fmt.Errorf("ngày kết thúc phải sau ngày bắt đầu")
+	}
+	if r.Price <= 0 || r.WeekendPrice < 0 {
+		return fmt.Errorf("giá theo mùa không hợp lệ")
+	}
+	return nil
+}
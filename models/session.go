@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Session là một lần đăng nhập trên một thiết bị. ID trùng FamilyID của các refresh token
+// sinh ra từ lần đăng nhập đó; access token mang mã phiên trong claim "sid".
+type Session struct {
+	ID            string     `json:"id" gorm:"primaryKey;size:64"`
+	UserID        uint       `json:"userId" gorm:"index;not null"`
+	Device        string     `json:"device"`
+	UserAgent     string     `json:"userAgent"`
+	IP            string     `json:"ip"`
+	LastSeenAt    time.Time  `json:"lastSeenAt"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	RevokedAt     *time.Time `json:"revokedAt,omitempty"`
+	RevokedReason string     `json:"revokedReason,omitempty"`
+	RevokedBy     *uint      `json:"revokedBy,omitempty"`
+	CreatedAt     time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
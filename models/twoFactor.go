@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// TwoFactor là cấu hình TOTP (RFC 6238) của một người dùng.
+// Secret được mã hóa trước khi lưu; Enabled chỉ bật sau khi người dùng nhập đúng mã đầu tiên.
+type TwoFactor struct {
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	UserID          uint       `json:"userId" gorm:"uniqueIndex;not null"`
+	SecretEncrypted string     `json:"-" gorm:"not null"`
+	Enabled         bool       `json:"enabled" gorm:"default:false"`
+	EnabledAt       *time.Time `json:"enabledAt,omitempty"`
+	LastUsedStep    int64      `json:"-"` // Bước thời gian của mã TOTP dùng gần nhất, chống dùng lại mã
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// TwoFactorRecoveryCode là mã khôi phục dùng một lần khi mất thiết bị xác thực
+type TwoFactorRecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"userId" gorm:"index;not null"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"usedAt,omitempty"`
+	CreatedAt time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
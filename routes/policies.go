@@ -0,0 +1,155 @@
+package routes
+
+import (
+	mw "new/middleware"
+	"new/services"
+)
+
+// Role: 0 người dùng, 1 superadmin, 2 admin, 3 lễ tân
+var (
+	anyUser    = []int{0, 1, 2, 3}
+	staff      = []int{1, 2, 3}
+	admins     = []int{1, 2}
+	superAdmin = []int{1}
+)
+
+// routePolicies khai báo quyền của từng route theo "METHOD /đường/dẫn".
+// Mọi route ghi dữ liệu phải có mặt ở đây (Public nếu mở cho khách), SetupRoutes sẽ cảnh báo route còn thiếu.
+// Superadmin bỏ qua kiểm tra sở hữu; admin thao tác trên chỗ ở của mình, nhân viên cần Permission
+// của vai trò được giao trên chỗ ở của đối tượng.
+var routePolicies = mw.PolicyTable{
+	// Tài khoản
+	"POST /api/v1/auth/login":     {Public: true},
+	"DELETE /api/v1/auth/logout":  {Public: true},
+	"POST /api/v1/auth/register":  {Public: true},
+	"POST /api/v1/auth/refresh":   {Public: true},
+	"POST /api/v1/auth/google":    {Public: true},
+	"POST /api/v1/resendCode":     {Public: true},
+	"POST /api/v1/forgetPassword": {Public: true},
+	"POST /api/v1/newPassword":    {Public: true},
+	"POST /api/v1/verifyCode":     {Public: true},
+
+	// Xác thực hai lớp: verify dùng challenge của bước đăng nhập thay cho token
+	"POST /api/v1/auth/2fa/verify":        {Public: true},
+	"GET /api/v1/auth/2fa":                {Roles: anyUser},
+	"POST /api/v1/auth/2fa/setup":         {Roles: anyUser},
+	"POST /api/v1/auth/2fa/enable":        {Roles: anyUser},
+	"POST /api/v1/auth/2fa/disable":       {Roles: anyUser},
+	"POST /api/v1/auth/2fa/recoveryCodes": {Roles: anyUser},
+
+	// Phiên đăng nhập: người dùng chỉ thao tác trên phiên của mình (service lọc theo user)
+	"GET /api/v1/auth/sessions":        {Roles: anyUser},
+	"DELETE /api/v1/auth/sessions":     {Roles: anyUser},
+	"DELETE /api/v1/auth/sessions/:id": {Roles: anyUser},
+	// Admin buộc lễ tân của mình đăng xuất khỏi mọi thiết bị
+	"DELETE /api/v1/receptionist/:id/sessions": {Roles: admins, Owner: mw.ManagedUser(mw.Param("id"))},
+
+	// Vai trò và quyền: giao/thu hồi vai trò cần staff.manage trên chỗ ở (kiểm tra trong service)
+	"GET /api/v1/auth/permissions":       {Roles: anyUser},
+	"GET /api/v1/permissions":            {Roles: staff},
+	"GET /api/v1/roles":                  {Roles: staff},
+	"POST /api/v1/roles":                 {Roles: admins},
+	"PUT /api/v1/rolesUpdate":            {Roles: admins},
+	"DELETE /api/v1/roles/:id":           {Roles: admins},
+	"GET /api/v1/roleAssignments":        {Roles: admins, Owner: mw.ManagedUser(mw.Query("userId"))},
+	"POST /api/v1/roleAssignments":       {Roles: staff},
+	"DELETE /api/v1/roleAssignments/:id": {Roles: staff},
+
+	// Hộp thư thông báo: người dùng chỉ thao tác trên thông báo của mình (service lọc theo user)
+	"GET /api/v1/notifications":             {Roles: anyUser},
+	"GET /api/v1/notifications/unreadCount": {Roles: anyUser},
+	"PUT /api/v1/notifications/:id/read":    {Roles: anyUser},
+	"PUT /api/v1/notifications/read":        {Roles: anyUser},
+
+	// Nhận/hủy email nhắc lịch và mời đánh giá; liên kết hủy trong email dùng token ký nên không cần đăng nhập
+	"GET /api/v1/auth/emailPreferences": {Roles: anyUser},
+	"PUT /api/v1/auth/emailPreferences": {Roles: anyUser},
+	"POST /api/v1/unsubscribe":          {Public: true},
+
+	// Người dùng, lễ tân
+	"GET /api/v1/users":             {Roles: admins},
+	"POST /api/v1/users":            {Roles: admins},
+	"PUT /api/v1/users":             {Roles: anyUser},
+	"PUT /api/v1/userStatus":        {Roles: admins},
+	"GET /api/v1/userAcc":           {Roles: []int{2}},
+	"PUT /api/v1/updateBalance":     {Roles: admins, Owner: mw.ManagedUser(mw.JSONField("userId"))},
+	"PUT /api/v1/updateUserAcc":     {Roles: []int{2}},
+	"POST /api/v1/checkin":          {Roles: []int{3}, Owner: mw.Self(mw.JSONField("userId"))},
+	"GET /api/v1/userCalendar":      {Roles: []int{2}},
+	"POST /api/v1/userSalaryInit":   {Roles: []int{2}},
+	"POST /api/v1/userSalaryCommit": {Roles: []int{2}},
+	"PUT /api/v1/userSalaryStatus":  {Roles: []int{2}},
+	"GET /api/v1/userCheckin":       {Roles: []int{2}},
+	"GET /api/v1/salaryHistory":     {Roles: []int{2}},
+
+	// Phòng, chỗ ở
+	"POST /api/v1/room":                 {Roles: staff, Permission: services.PermRoomEdit, Owner: mw.OwnAccommodation(mw.JSONField("accommodationId"))},
+	"PUT /api/v1/roomUpdate":            {Roles: staff, Permission: services.PermRoomEdit, Owner: mw.OwnRoom(mw.JSONField("id"))},
+	"PUT /api/v1/roomStatus":            {Roles: staff, Permission: services.PermRoomStatus, Owner: mw.OwnRoom(mw.JSONField("id"))},
+	"POST /api/v1/accommodation":        {Roles: admins},
+	"PUT /api/v1/accommodationUpdate":   {Roles: staff, Permission: services.PermAccommodationEdit, Owner: mw.OwnAccommodation(mw.JSONField("id"))},
+	"PUT /api/v1/accommodationStatus":   {Roles: staff, Permission: services.PermAccommodationStatus, Owner: mw.OwnAccommodation(mw.JSONField("id"))},
+	"PUT /api/v1/cancellationPolicy":    {Roles: staff, Permission: services.PermAccommodationEdit, Owner: mw.OwnAccommodation(mw.JSONField("accommodationId"))},
+	"GET /api/v1/pricingRules":          {Roles: admins},
+	"POST /api/v1/pricingRules":         {Roles: admins},
+	"PUT /api/v1/pricingRulesUpdate":    {Roles: admins},
+	"DELETE /api/v1/pricingRules/:id":   {Roles: admins},
+	"GET /api/v1/seasonalRates":         {Roles: admins},
+	"POST /api/v1/seasonalRates":        {Roles: admins},
+	"PUT /api/v1/seasonalRatesUpdate":   {Roles: admins},
+	"DELETE /api/v1/seasonalRates/:id":  {Roles: admins},
+	"PUT /api/v1/dailyRates":            {Roles: admins},
+	"DELETE /api/v1/dailyRates":         {Roles: admins},
+	"POST /api/v1/add-banks":            {Roles: superAdmin},
+	"PUT /api/v1/update-banks":          {Roles: superAdmin},
+	"DELETE /api/v1/del-banks":          {Roles: superAdmin},
+	"POST /api/v1/benefit":              {Roles: admins},
+	"PUT /api/v1/benefitUpdate":         {Roles: superAdmin},
+	"PUT /api/v1/benefitStatus":         {Roles: superAdmin},
+	"POST /api/v1/holidays":             {Roles: superAdmin},
+	"PUT /api/v1/holidaysUpdate":        {Roles: superAdmin},
+	"DELETE /api/v1/holidays":           {Roles: superAdmin},
+	"POST /api/v1/discount":             {Roles: superAdmin},
+	"PUT /api/v1/discountUpdate":        {Roles: superAdmin},
+	"DELETE /api/v1/discount/:id":       {Roles: superAdmin},
+	"PUT /api/v1/discountStatus":        {Roles: superAdmin},
+	"POST /api/v1/img/multi-upload":     {Roles: anyUser},
+	"POST /api/v1/img/upload":           {Roles: anyUser},
+	"GET /api/v1/test-broadcast":        {Roles: superAdmin},
+	"POST /api/v1/rates":                {Roles: anyUser, Owner: mw.Self(mw.JSONField("userId"))},
+	"PUT /api/v1/ratesUpdate":           {Roles: anyUser, Owner: mw.OwnRate(mw.JSONField("id"))},
+	"POST /api/v1/order":                {Public: true},
+	"POST /api/v1/order/quote":          {Public: true},
+	"PUT /api/v1/orderUpdate":           {Roles: anyUser, Permission: services.PermOrderManage, Owner: mw.OwnOrder(mw.JSONField("id"))},
+	"PUT /api/v1/orderModify":           {Roles: anyUser, Permission: services.PermOrderManage, Owner: mw.OwnOrder(mw.JSONField("id"))},
+	"PUT /api/v1/paymentStatus":         {Roles: staff, Permission: services.PermInvoicePayment, Owner: mw.OwnInvoice(mw.JSONField("id"))},
+	"POST /api/v1/sendpay":              {Roles: superAdmin},
+	"GET /api/v1/order":                 {Roles: anyUser},
+	"GET /api/v1/invoices":              {Roles: staff},
+	"GET /api/v1/invoices/:id":          {Roles: staff, Owner: mw.OwnInvoice(mw.Param("id"))},
+	"GET /api/v1/invoices/:id/payments": {Roles: staff, Owner: mw.OwnInvoice(mw.Param("id"))},
+	"POST /api/v1/invoicePayments":      {Roles: staff, Permission: services.PermInvoicePayment, Owner: mw.OwnInvoice(mw.JSONField("invoiceId"))},
+	"PUT /api/v1/invoicePayments/void":  {Roles: admins},
+	"GET /api/v1/refunds":               {Roles: staff},
+	"PUT /api/v1/refundStatus":          {Roles: admins},
+
+	// Thanh toán online: webhook xác thực bằng chữ ký của cổng thanh toán
+	"POST /api/v1/payments/intent":              {Roles: anyUser, Permission: services.PermInvoicePayment, Owner: mw.OwnOrder(mw.JSONField("orderId"))},
+	"GET /api/v1/payments/intent/:code":         {Roles: anyUser},
+	"POST /api/v1/payments/webhook/:provider":   {Public: true},
+	"POST /api/v1/payments/fake/checkout/:code": {Public: true},
+
+	// Doanh thu, rút tiền
+	"GET /api/v1/todayUser":                 {Roles: superAdmin},
+	"GET /api/v1/userRevenue":               {Roles: superAdmin},
+	"POST /api/v1/createWithdrawalHistory":  {Roles: []int{2}},
+	"POST /api/v1/confirmWithdrawalHistory": {Roles: superAdmin},
+
+	// Nhật ký kiểm toán
+	"GET /api/v1/auditLogs":      {Roles: superAdmin},
+	"GET /api/v1/adminAuditLogs": {Roles: staff},
+
+	// Hàng đợi email
+	"GET /api/v1/emailOutbox":             {Roles: superAdmin},
+	"POST /api/v1/emailOutbox/:id/resend": {Roles: superAdmin},
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"time"
+
+	mw "new/middleware"
+)
+
+// routeRateLimits khai báo giới hạn request theo route; các route không có ở đây không bị giới hạn
+var routeRateLimits = mw.RateLimitTable{
+	"POST /api/v1/auth/login": {
+		{Name: "ip", Limit: 20, Window: time.Minute, Key: mw.ByIP()},
+		{Name: "identifier", Limit: 10, Window: 15 * time.Minute, Key: mw.ByJSONField("identifier")},
+	},
+	"POST /api/v1/auth/register": {
+		{Name: "ip", Limit: 5, Window: 10 * time.Minute, Key: mw.ByIP()},
+	},
+	"POST /api/v1/auth/refresh": {
+		{Name: "ip", Limit: 30, Window: time.Minute, Key: mw.ByIP()},
+	},
+	"POST /api/v1/auth/2fa/verify": {
+		{Name: "ip", Limit: 10, Window: time.Minute, Key: mw.ByIP()},
+	},
+	"POST /api/v1/auth/2fa/disable": {
+		{Name: "user", Limit: 5, Window: 15 * time.Minute, Key: mw.ByUser()},
+	},
+	"POST /api/v1/verifyCode": {
+		{Name: "ip", Limit: 10, Window: time.Minute, Key: mw.ByIP()},
+		{Name: "email", Limit: 5, Window: 5 * time.Minute, Key: mw.ByJSONField("email")},
+	},
+	"POST /api/v1/forgetPassword": {
+		{Name: "ip", Limit: 5, Window: time.Minute, Key: mw.ByIP()},
+		{Name: "identifier", Limit: 3, Window: 15 * time.Minute, Key: mw.ByJSONField("identifier")},
+	},
+	"POST /api/v1/resendCode": {
+		{Name: "ip", Limit: 5, Window: time.Minute, Key: mw.ByIP()},
+		{Name: "identifier", Limit: 3, Window: 15 * time.Minute, Key: mw.ByJSONField("identifier")},
+	},
+	"POST /api/v1/order": {
+		{Name: "ip", Limit: 10, Window: time.Minute, Key: mw.ByIP()},
+		{Name: "user", Limit: 20, Window: time.Hour, Key: mw.ByUser()},
+	},
+	"POST /api/v1/order/quote": {
+		{Name: "ip", Limit: 60, Window: time.Minute, Key: mw.ByIP()},
+	},
+	"POST /api/v1/unsubscribe": {
+		{Name: "ip", Limit: 10, Window: time.Minute, Key: mw.ByIP()},
+	},
+}
@@ -2,11 +2,12 @@ package routes
 
 import (
 	"context"
-	"fmt"
+	"log"
 	"net/http"
 	"new/config"
 	"new/controllers"
 	middlewares "new/middleware"
+	"new/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/olahol/melody"
@@ -23,35 +24,70 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 	userController := controllers.NewUserController(db, redisCli)
 
 	v1 := router.Group("/api/v1")
-	v1.GET("/users", middlewares.AuthMiddleware(1, 2), userController.GetUsers)
-	v1.POST("/users", middlewares.AuthMiddleware(1, 2), userController.CreateUser)
+	services.InitRateLimiter(redisCli)
+	v1.Use(middlewares.Limit(routeRateLimits), middlewares.Enforce(routePolicies))
+	v1.GET("/users", userController.GetUsers)
+	v1.POST("/users", userController.CreateUser)
 	v1.GET("/users/:id", userController.GetUserByID)
-	v1.PUT("/users", middlewares.AuthMiddleware(1, 2, 3, 0), userController.UpdateUser)
-	v1.PUT("/userStatus", middlewares.AuthMiddleware(1, 2), userController.ChangeUserStatus)
+	v1.PUT("/users", userController.UpdateUser)
+	v1.PUT("/userStatus", userController.ChangeUserStatus)
 	v1.GET("/receptionist/:id", userController.GetReceptionistByID)
+	v1.DELETE("/receptionist/:id/sessions", controllers.ForceLogoutUser)
 	v1.GET("/sabank", userController.GetBankSuperAdmin)
 	v1.GET("/profile", userController.GetProfile)
 
-	v1.GET("/userAcc", middlewares.AuthMiddleware(2), controllers.GetUserAcc)
-	v1.PUT("/updateBalance", middlewares.AuthMiddleware(1, 2), userController.UpdateUserBalance)
-	v1.PUT("/updateUserAcc", middlewares.AuthMiddleware(2), userController.UpdateUserAccommodation)
+	v1.GET("/userAcc", controllers.GetUserAcc)
+	v1.PUT("/updateBalance", userController.UpdateUserBalance)
+	v1.PUT("/updateUserAcc", userController.UpdateUserAccommodation)
 	v1.POST("/checkin", userController.CheckInUser)
-	v1.GET("/userCalendar", middlewares.AuthMiddleware(2), controllers.GetUserCalendar)
-	v1.POST("/userSalaryInit", middlewares.AuthMiddleware(2), controllers.CalculateUserSalaryInit)
-	v1.POST("/userSalaryCommit", middlewares.AuthMiddleware(2), controllers.CalculateUserSalary)
-	v1.PUT("/userSalaryStatus", middlewares.AuthMiddleware(2), controllers.UpdateSalaryStatus)
-	v1.GET("/userCheckin", middlewares.AuthMiddleware(2), controllers.GetUserCheckin)
-	v1.GET("/salaryHistory", middlewares.AuthMiddleware(2), controllers.GetUserSalary)
+	v1.GET("/userCalendar", controllers.GetUserCalendar)
+	v1.POST("/userSalaryInit", controllers.CalculateUserSalaryInit)
+	v1.POST("/userSalaryCommit", controllers.CalculateUserSalary)
+	v1.PUT("/userSalaryStatus", controllers.UpdateSalaryStatus)
+	v1.GET("/userCheckin", controllers.GetUserCheckin)
+	v1.GET("/salaryHistory", controllers.GetUserSalary)
 
 	v1.GET("/verify-email", controllers.VerifyEmail)
 	v1.POST("/auth/login", controllers.Login)
 	v1.DELETE("/auth/logout", controllers.Logout)
+	v1.POST("/auth/refresh", controllers.RefreshToken)
 	v1.POST("/auth/register", controllers.RegisterUser)
 	v1.POST("/resendCode", controllers.ResendVerificationCode)
 	v1.POST("/forgetPassword", controllers.ForgetPassword)
 	v1.POST("/newPassword", controllers.ResetPassword)
 	v1.POST("/verifyCode", controllers.VerifyCode)
 	v1.POST("/auth/google", controllers.AuthGoogle)
+	v1.POST("/auth/2fa/verify", controllers.VerifyTwoFactorLogin)
+	v1.GET("/auth/2fa", controllers.GetTwoFactorStatus)
+	v1.POST("/auth/2fa/setup", controllers.SetupTwoFactor)
+	v1.POST("/auth/2fa/enable", controllers.EnableTwoFactor)
+	v1.POST("/auth/2fa/disable", controllers.DisableTwoFactor)
+	v1.POST("/auth/2fa/recoveryCodes", controllers.RegenerateRecoveryCodes)
+	v1.GET("/auth/sessions", controllers.GetSessions)
+	v1.DELETE("/auth/sessions", controllers.RevokeSessions)
+	v1.DELETE("/auth/sessions/:id", controllers.RevokeSession)
+	v1.GET("/auth/permissions", controllers.GetMyPermissions)
+
+	// Vai trò và quyền
+	v1.GET("/permissions", controllers.GetPermissions)
+	v1.GET("/roles", controllers.GetRoles)
+	v1.POST("/roles", controllers.CreateRole)
+	v1.PUT("/rolesUpdate", controllers.UpdateRole)
+	v1.DELETE("/roles/:id", controllers.DeleteRole)
+	v1.GET("/roleAssignments", controllers.GetRoleAssignments)
+	v1.POST("/roleAssignments", controllers.CreateRoleAssignment)
+	v1.DELETE("/roleAssignments/:id", controllers.DeleteRoleAssignment)
+
+	// Hộp thư thông báo
+	v1.GET("/notifications", controllers.GetNotifications)
+	v1.GET("/notifications/unreadCount", controllers.GetUnreadNotificationCount)
+	v1.PUT("/notifications/:id/read", controllers.MarkNotificationRead)
+	v1.PUT("/notifications/read", controllers.MarkAllNotificationsRead)
+
+	// Cài đặt email nhắc lịch
+	v1.GET("/auth/emailPreferences", controllers.GetEmailPreferences)
+	v1.PUT("/auth/emailPreferences", controllers.UpdateEmailPreferences)
+	v1.POST("/unsubscribe", controllers.UnsubscribeEmail)
 
 	v1.GET("/room", controllers.GetAllRooms)
 	v1.GET("/roomUser", controllers.GetAllRoomsUser)
@@ -68,6 +104,8 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 	v1.PUT("/accommodationUpdate", controllers.UpdateAccommodation)
 	v1.PUT("/accommodationStatus", controllers.ChangeAccommodationStatus)
 	v1.GET("/checkAcc", controllers.GetAccBookingDates)
+	v1.GET("/cancellationPolicy/:id", controllers.GetCancellationPolicy)
+	v1.PUT("/cancellationPolicy", controllers.UpdateCancellationPolicy)
 	v1.GET("/accommodationReceptionist", controllers.GetAccommodationReceptionist)
 
 	v1.GET("/banks", controllers.GetAllBanks)
@@ -88,10 +126,25 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 
 	v1.GET("/order", controllers.GetOrders)
 	v1.POST("/order", controllers.CreateOrder)
+	v1.POST("/order/quote", controllers.QuoteOrder)
 	v1.PUT("/orderUpdate", controllers.ChangeOrderStatus)
+	v1.PUT("/orderModify", controllers.ModifyOrder)
 	v1.GET("/order/:id", controllers.GetOrderDetail)
 	v1.GET("/orderHistory", controllers.GetOrdersByUserId)
 
+	v1.GET("/pricingRules", controllers.GetPricingRules)
+	v1.POST("/pricingRules", controllers.CreatePricingRule)
+	v1.PUT("/pricingRulesUpdate", controllers.UpdatePricingRule)
+	v1.DELETE("/pricingRules/:id", controllers.DeletePricingRule)
+
+	v1.GET("/rateCalendar", controllers.GetRateCalendar)
+	v1.GET("/seasonalRates", controllers.GetSeasonalRates)
+	v1.POST("/seasonalRates", controllers.CreateSeasonalRate)
+	v1.PUT("/seasonalRatesUpdate", controllers.UpdateSeasonalRate)
+	v1.DELETE("/seasonalRates/:id", controllers.DeleteSeasonalRate)
+	v1.PUT("/dailyRates", controllers.UpsertDailyRates)
+	v1.DELETE("/dailyRates", controllers.DeleteDailyRates)
+
 	v1.GET("/holidays", controllers.GetHolidays)
 	v1.POST("/holidays", controllers.CreateHoliday)
 	v1.PUT("/holidaysUpdate", controllers.UpdateHoliday)
@@ -107,6 +160,21 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 
 	v1.GET("/invoices", controllers.GetInvoices)
 	v1.GET("/invoices/:id", controllers.GetDetailInvoice)
+	v1.GET("/invoices/:id/payments", controllers.GetInvoicePayments)
+	v1.POST("/invoicePayments", controllers.RecordInvoicePayment)
+	v1.PUT("/invoicePayments/void", controllers.VoidInvoicePayment)
+	v1.GET("/refunds", controllers.GetRefunds)
+	v1.PUT("/refundStatus", controllers.UpdateRefundStatus)
+
+	// Thanh toán online
+	v1.POST("/payments/intent", controllers.CreatePaymentIntent)
+	v1.GET("/payments/intent/:code", controllers.GetPaymentIntent)
+	v1.POST("/payments/webhook/:provider", controllers.PaymentWebhook)
+	v1.GET("/payments/webhook/:provider", controllers.PaymentWebhook)
+	if _, exists := services.GetPaymentProvider("fake"); exists {
+		v1.GET("/payments/fake/checkout/:code", controllers.FakePaymentCheckout)
+		v1.POST("/payments/fake/checkout/:code", controllers.FakePaymentCheckout)
+	}
 
 	v1.POST("/sendpay", controllers.SendPay)
 	v1.PUT("/paymentStatus", controllers.UpdatePaymentStatus)
@@ -115,14 +183,20 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 	v1.GET("/revenue", controllers.GetTotalRevenue)
 	v1.GET("/revenue/detail", controllers.GetTotal)
 	v1.GET("/today", controllers.GetToday)
-	v1.GET("/todayUser", middlewares.AuthMiddleware(1), controllers.GetTodayUser)
-	v1.GET("/userRevenue", middlewares.AuthMiddleware(1), controllers.GetUserRevene)
+	v1.GET("/todayUser", controllers.GetTodayUser)
+	v1.GET("/userRevenue", controllers.GetUserRevene)
 
 	//Đơn rút tiền
 	v1.POST("/createWithdrawalHistory", controllers.CreateWithdrawalHistory)
 	v1.GET("/getWithdrawalHistory", controllers.GetWithdrawalHistory)
 	v1.POST("/confirmWithdrawalHistory", controllers.ConfirmWithdrawalHistory)
 
+	v1.GET("/auditLogs", controllers.GetAuditLogs)
+	v1.GET("/adminAuditLogs", controllers.GetAdminAuditLogs)
+
+	v1.GET("/emailOutbox", controllers.GetOutboxEmails)
+	v1.POST("/emailOutbox/:id/resend", controllers.ResendOutboxEmail)
+
 	v1.POST("/img/multi-upload", func(c *gin.Context) {
 		form, er := c.MultipartForm()
 		if er != nil {
@@ -185,12 +259,21 @@ func SetupRoutes(router *gin.Engine, db *gorm.DB, redisCli *redis.Client, cld *c
 		})
 	})
 
-	//ws
+	//ws: gửi tin thử tới các kết nối WebSocket của chính người gọi
 	v1.GET("/test-broadcast", func(c *gin.Context) {
-		message := []byte("Thông báo từ backend: Tin nhắn mới!")
-		fmt.Println("Broadcasting message:", string(message))
-		m.Broadcast(message)
+		claims, err := services.AuthenticateRequest(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"code": 0, "mess": err.Error()})
+			return
+		}
+		if err := services.NotifyUser(claims.UserInfo.UserId, services.EventTest, gin.H{"message": "Thông báo từ backend: Tin nhắn mới!"}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 0, "mess": "Không thể gửi tin thử"})
+			return
+		}
 		c.String(200, "Broadcast message sent!")
 	})
 
+	for _, route := range middlewares.MissingPolicies(routePolicies, router.Routes()) {
+		log.Printf("⚠️ Route %s chưa khai báo quyền trong routePolicies\n", route)
+	}
 }
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"new/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Các hành động được ghi nhật ký
+const (
+	AuditUserBalanceUpdate      = "user.balance.update"
+	AuditUserBalanceWithdraw    = "user.balance.withdraw"
+	AuditUserStatusUpdate       = "user.status.update"
+	AuditSalaryStatusUpdate     = "salary.status.update"
+	AuditWithdrawalStatusUpdate = "withdrawal.status.update"
+	AuditOrderStatusUpdate      = "order.status.update"
+	AuditInvoicePaymentUpdate   = "invoice.payment.update"
+	AuditInvoicePaymentRecord   = "invoice.payment.record"
+	AuditInvoicePaymentVoid     = "invoice.payment.void"
+	AuditRefundStatusUpdate     = "refund.status.update"
+	AuditOrderModify            = "order.modify"
+	AuditPaymentIntentOrphan    = "payment.intent.orphan"
+)
+
+// AuditActor là người thực hiện thay đổi; UserID/Role rỗng khi thay đổi đến từ hệ thống (cron, webhook)
+type AuditActor struct {
+	UserID *uint
+	Role   *int
+	IP     string
+}
+
+// AuditActorFromRequest lấy người thực hiện từ token và IP của request
+func AuditActorFromRequest(c *gin.Context) AuditActor {
+	actor := AuditActor{IP: c.ClientIP()}
+	if claims, err := AuthenticateRequest(c); err == nil {
+		userID, role := claims.UserInfo.UserId, claims.UserInfo.Role
+		actor.UserID = &userID
+		actor.Role = &role
+	}
+	return actor
+}
+
+// AuditEntry mô tả một thay đổi. Before/After là ảnh chụp các trường liên quan,
+// chỉ các trường khác nhau được lưu lại.
+type AuditEntry struct {
+	Action          string
+	EntityType      string
+	EntityID        uint
+	AccommodationID *uint
+	AdminID         *uint
+	Before          map[string]interface{}
+	After           map[string]interface{}
+}
+
+// normalizeAuditValues đưa giá trị về dạng JSON để so sánh (time, số nguyên/thực...)
+func normalizeAuditValues(values map[string]interface{}) (map[string]interface{}, error) {
+	normalized := map[string]interface{}{}
+	if values == nil {
+		return normalized, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// diffAudit trả về before/after chỉ gồm các trường đã thay đổi
+func diffAudit(before, after map[string]interface{}) (map[string]interface{}, map[string]interface{}, error) {
+	oldValues, err := normalizeAuditValues(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	newValues, err := normalizeAuditValues(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for key, newValue := range newValues {
+		oldValue, exists := oldValues[key]
+		if exists && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if exists {
+			changedBefore[key] = oldValue
+		}
+		changedAfter[key] = newValue
+	}
+	for key, oldValue := range oldValues {
+		if _, exists := newValues[key]; !exists {
+			changedBefore[key] = oldValue
+		}
+	}
+	return changedBefore, changedAfter, nil
+}
+
+// RecordAudit ghi nhật ký trong transaction tx của chính thay đổi: thay đổi rollback thì nhật ký cũng không còn
+func RecordAudit(tx *gorm.DB, actor AuditActor, entry AuditEntry) error {
+	before, after, err := diffAudit(entry.Before, entry.After)
+	if err != nil {
+		return fmt.Errorf("không thể ghi nhật ký: %w", err)
+	}
+	if len(before) == 0 && len(after) == 0 {
+		return nil
+	}
+
+	beforeJSON, _ := json.Marshal(before)
+	afterJSON, _ := json.Marshal(after)
+	log := models.AuditLog{
+		ActorID:         actor.UserID,
+		ActorRole:       actor.Role,
+		Action:          entry.Action,
+		EntityType:      entry.EntityType,
+		EntityID:        entry.EntityID,
+		AccommodationID: entry.AccommodationID,
+		AdminID:         entry.AdminID,
+		Before:          string(beforeJSON),
+		After:           string(afterJSON),
+		IP:              actor.IP,
+	}
+	if err := tx.Create(&log).Error; err != nil {
+		return fmt.Errorf("không thể ghi nhật ký: %w", err)
+	}
+	return nil
+}
+
+// InvoiceAuditSnapshot chụp các trường tiền của hóa đơn để ghi nhật ký trước/sau thay đổi
+func InvoiceAuditSnapshot(invoice *models.Invoice) map[string]interface{} {
+	return map[string]interface{}{
+		"totalAmount":     invoice.TotalAmount,
+		"paidAmount":      invoice.PaidAmount,
+		"remainingAmount": invoice.RemainingAmount,
+		"refundAmount":    invoice.RefundAmount,
+		"status":          invoice.Status,
+	}
+}
+
+// RecordInvoiceAudit ghi nhật ký cho một thay đổi tiền liên quan tới hóa đơn, gắn chỗ ở của đơn và admin của hóa đơn
+func RecordInvoiceAudit(tx *gorm.DB, actor AuditActor, invoice *models.Invoice, entry AuditEntry) error {
+	var accommodationID uint
+	if err := tx.Model(&models.Order{}).Where("id = ?", invoice.OrderID).Select("accommodation_id").Scan(&accommodationID).Error; err != nil {
+		return fmt.Errorf("không thể ghi nhật ký: %w", err)
+	}
+	entry.AccommodationID = &accommodationID
+	entry.AdminID = &invoice.AdminID
+	return RecordAudit(tx, actor, entry)
+}
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"net/smtp"
 	"new/config"
 	"new/models"
 	"time"
@@ -22,7 +21,8 @@ type UserInfo struct {
 }
 
 type Claims struct {
-	UserInfo UserInfo `json:"userinfo"`
+	UserInfo  UserInfo `json:"userinfo"`
+	SessionID string   `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
@@ -40,156 +40,6 @@ func generateVerificationCode() (string, error) {
 	return code, nil
 }
 
-func sendVerificationEmail(email string, token string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := "Subject: Mã dùng một lần của bạn\n"
-	body := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="UTF-8">
-			<title>Mã xác thực</title>
-		</head>
-		<body>
-			<p>Xin chào %s,</p>
-			<p>Chúng tôi đã nhận yêu cầu mã dùng một lần để dùng cho tài khoản của bạn.</p>
-			<p>Mã dùng một lần của bạn là: <strong>%s</strong></p>
-			<p>Nếu không yêu cầu mã này thì bạn có thể bỏ qua email này một cách an toàn. Có thể ai đó khác đã nhập địa chỉ email của bạn do nhầm lẫn.</p>
-			<p>Bạn có thể bấm vào nút sau để xác nhận tài khoản</p>
-			<p>
-				<a href="https://trothalo.click/verify-email?token=%s" style="display: inline-block; padding: 10px 20px; background-color: #1a73e8; color: white; text-decoration: none; border-radius: 5px;">
-					Xác nhận email
-				</a>
-			</p>
-			<p>Xin cám ơn,<br>Nhóm tài khoản</p>
-		</body>
-		</html>
-	`, email, token, token)
-
-	msg := []byte("MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n" + subject + "\n" + body)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
-}
-
-func sendcodeEmail(email string, token string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := "Subject: Mã đăng nhập\n"
-	body := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="UTF-8">
-			<title>Mã xác thực</title>
-		</head>
-		<body>
-			<p>Xin chào %s,</p>
-			<p>Chúng tôi đã nhận yêu cầu mã dùng một lần để dùng cho tài khoản của bạn.</p>
-			<p>Mã đăng nhập là: <strong>%s</strong></p>
-			<p>Nếu không yêu cầu mã này thì bạn có thể bỏ qua email này một cách an toàn. Có thể ai đó khác đã nhập địa chỉ email của bạn do nhầm lẫn.</p>
-			<p>Bạn có thể bấm vào nút sau để xác nhận tài khoản</p>
-			<p>Xin cám ơn,<br>Nhóm tài khoản</p>
-		</body>
-		</html>
-	`, email, token)
-
-	msg := []byte("MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n" + subject + "\n" + body)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
-}
-
-func sendUserEmail(email string, phone string, pass string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := "Subject: Bạn đã tạo tài khoản mới\n"
-	body := fmt.Sprintf(`<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>Tạo tài khoản thành công</title>
-	</head>
-	<body>
-		<p>Xin chào,</p>
-		<p>Chúc mừng! Bạn đã tạo tài khoản thành công.</p>
-		<p>Thông tin tài khoản của bạn như sau:</p>
-		<ul>
-			<li>Email: <strong>%s</strong></li>
-			<li>Số điện thoại: <strong>%s</strong></li>
-			<li>Mật khẩu: <strong>%s</strong></li>
-		</ul>
-		<p>Nếu không yêu cầu tạo tài khoản này thì bạn có thể bỏ qua email này một cách an toàn. Có thể ai đó khác đã nhập địa chỉ email của bạn do nhầm lẫn.</p>
-		<p>Xin cảm ơn,<br>Nhóm tài khoản</p>
-	</body>
-	</html>`, email, phone, pass)
-
-	msg := []byte("MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n" + subject + "\n" + body)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
-}
-
-func SendOrderEmail(email string, orderId uint, totalPrice float64, checkInDate string, checkOutDate string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := "Subject: Đặt đơn hàng thành công\n"
-
-	priceFormatted := formatCurrency(totalPrice)
-
-	body := fmt.Sprintf(`<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>Đặt đơn hàng thành công</title>
-	</head>
-	<body>
-		<p>Xin chào,</p>
-		<p>Chúc mừng! Bạn đã đặt đơn hàng thành công.</p>
-		<p>Thông tin đơn hàng của bạn như sau:</p>
-		<ul>
-			<li>Mã đơn hàng: <strong>%d</strong></li>
-			<li>Ngày nhận phòng: <strong>%s</strong></li>
-			<li>Ngày trả phòng: <strong>%s</strong></li>
-			<li>Tổng giá trị đơn hàng: <strong>%s VND</strong></li>
-		</ul>
-		<p>Chúng tôi sẽ gửi cho bạn thông tin chi tiết về đơn hàng khi có sự thay đổi.</p>
-		<p>Cảm ơn bạn đã sử dụng dịch vụ của chúng tôi!</p>
-		<p>Xin cảm ơn,<br>Nhóm hỗ trợ</p>
-	</body>
-	</html>`, orderId, checkInDate, checkOutDate, priceFormatted)
-
-	msg := []byte("MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n" + subject + "\n" + body)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
-}
-
 func formatCurrency(amount float64) string {
 	return fmt.Sprintf("%0.2f", amount)
 }
@@ -232,28 +82,6 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
-var secretKey = []byte(config.GetEnv("SECRET_KEY_ACCESS_TOKEN"))
-var refreshSecretKey = []byte(config.GetEnv("SECRET_KEY_REFRESH_TOKEN"))
-
-func GenerateToken(userInfo UserInfo, expiryMinutes int, isAccessToken bool) (string, error) {
-	claims := &Claims{
-		UserInfo: userInfo,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Minute * time.Duration(expiryMinutes)).Unix(),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	var secretKeyToUse []byte
-	if isAccessToken {
-		secretKeyToUse = secretKey
-	} else {
-		secretKeyToUse = refreshSecretKey
-	}
-
-	return token.SignedString(secretKeyToUse)
-}
-
 func SetTokenCookies(c *gin.Context, accessToken string) {
 	c.SetCookie(
 		"access_token",
@@ -287,38 +115,35 @@ func CreateUser(input models.User) (models.User, error) {
 		return models.User{}, err
 	}
 
-	token, err := generateVerificationCode()
-	if err != nil {
-		return models.User{}, err
-	}
-
 	user := models.User{
-		Email:         input.Email,
-		Password:      hashedPassword,
-		PhoneNumber:   input.PhoneNumber,
-		IsVerified:    false,
-		Code:          token,
-		CodeCreatedAt: time.Now(),
-		Role:          input.Role,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
-		Name:          input.Name,
-		Amount:        input.Amount,
-	}
-
-	result := config.DB.Create(&user)
-	if result.Error != nil {
-		return user, result.Error
-	}
-
-	if user.Role != 0 {
-		err = sendVerificationEmail(input.Email, token)
-	} else {
-		err = sendUserEmail(input.Email, input.PhoneNumber, input.Password)
-	}
+		Email:       input.Email,
+		Password:    hashedPassword,
+		PhoneNumber: input.PhoneNumber,
+		IsVerified:  false,
+		Role:        input.Role,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+		Name:        input.Name,
+		Amount:      input.Amount,
+	}
+
+	// Tài khoản, mã xác minh và email được ghi cùng một transaction; email gửi nền sau khi commit
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
 
+		if user.Role != 0 {
+			token, err := issueOTP(tx, user.ID, models.OTPPurposeVerifyEmail)
+			if err != nil {
+				return err
+			}
+			return sendVerificationEmail(tx, input.Email, token)
+		}
+		return sendUserEmail(tx, input.Email, input.PhoneNumber, input.Password)
+	})
 	if err != nil {
-		return user, err
+		return models.User{}, err
 	}
 
 	return user, nil
@@ -337,76 +162,33 @@ func RegenerateVerificationCode(userID uint) error {
 		return result.Error
 	}
 
-	newCode, err := generateVerificationCode()
-	if err != nil {
-		return fmt.Errorf("không thể tạo mã xác minh mới: %v", err)
-	}
-
-	user.Code = newCode
-	user.CodeCreatedAt = time.Now()
-
-	if err := config.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("không thể cập nhật mã xác minh: %v", err)
-	}
-	err = sendVerificationEmail(user.Email, newCode)
-	if err != nil {
-		return fmt.Errorf("không thể gửi email xác minh: %v", err)
-	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		newCode, err := issueOTP(tx, user.ID, models.OTPPurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
 
-	return nil
+		if err := sendVerificationEmail(tx, user.Email, newCode); err != nil {
+			return fmt.Errorf("không thể gửi email xác minh: %v", err)
+		}
+		return nil
+	})
 }
 
+// ResetPass gửi mã đặt lại mật khẩu; mã này tách biệt với mã xác minh email đang chờ
 func ResetPass(user models.User) error {
 
-	newCode, err := generateVerificationCode()
-	if err != nil {
-		return fmt.Errorf("không thể tạo mã xác minh mới: %v", err)
-	}
-
-	user.Code = newCode
-	user.CodeCreatedAt = time.Now()
-
-	if err := config.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("không thể cập nhật mã xác minh: %v", err)
-	}
-
-	err = sendVerificationEmail(user.Email, newCode)
-	if err != nil {
-		return fmt.Errorf("không thể gửi email xác minh: %v", err)
-	}
-
-	return nil
-}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		newCode, err := issueOTP(tx, user.ID, models.OTPPurposeResetPassword)
+		if err != nil {
+			return err
+		}
 
-func sendNews(email string, title string, mess string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := fmt.Sprintf("Subject: %s\n", title)
-	body := fmt.Sprintf(`
-		<!DOCTYPE html>
-		<html>
-		<head>
-			<meta charset="UTF-8">
-			<title>%s</title>
-		</head>
-		<body>
-			<p>Xin chào %s,</p>
-			<p>%s</p>
-			<p>Xin cám ơn,<br>Nhóm tài khoản</p>
-		</body>
-		</html>
-	`, title, email, mess)
-
-	msg := []byte("MIME-Version: 1.0\r\nContent-Type: text/html; charset=UTF-8\r\n" + subject + "\n" + body)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
+		if err := sendcodeEmail(tx, user.Email, newCode); err != nil {
+			return fmt.Errorf("không thể gửi email xác minh: %v", err)
+		}
+		return nil
+	})
 }
 
 func NewPass(user models.User, newPassword string) error {
@@ -418,16 +200,22 @@ func NewPass(user models.User, newPassword string) error {
 
 	user.Password = hashedPassword
 
-	if err := config.DB.Save(&user).Error; err != nil {
-		return fmt.Errorf("không thể cập nhật mật khẩu mới: %v", err)
-	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return fmt.Errorf("không thể cập nhật mật khẩu mới: %v", err)
+		}
 
-	err = sendNews(user.Email, "Đổi mật khẩu", "Mật khẩu của bạn đã được cập nhật thành công.")
+		if err := sendNews(tx, user.Email, "Đổi mật khẩu", "Mật khẩu của bạn đã được cập nhật thành công."); err != nil {
+			return fmt.Errorf("không thể gửi email xác nhận: %v", err)
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("không thể gửi email xác nhận: %v", err)
+		return err
 	}
 
-	return nil
+	// Đổi mật khẩu thì đăng xuất mọi phiên đang đăng nhập
+	return RevokeUserTokens(user.ID, "password_changed")
 }
 
 func UpdateAccommodationRating(accommodationId uint) error {
@@ -483,16 +271,17 @@ func CreateGoogleUser(name, email, avatar string) (models.User, error) {
 	return user, nil
 }
 
-func ApplyDiscountForUser(user models.User) (float64, error) {
+// FindDiscountForUser chọn mã giảm giá phù hợp cho người dùng mà không ghi nhận lượt sử dụng
+func FindDiscountForUser(tx *gorm.DB, user models.User) (models.Discount, error) {
 	var discounts []models.Discount
 	var userDiscounts []models.UserDiscount
 
-	if err := config.DB.Where("status = ? AND quantity > 0 ", 1).Order("discount DESC").Find(&discounts).Error; err != nil {
-		return 0, fmt.Errorf("Không thể lấy danh sách mã giảm giá: %v", err)
+	if err := tx.Where("status = ? AND quantity > 0 ", 1).Order("discount DESC").Find(&discounts).Error; err != nil {
+		return models.Discount{}, fmt.Errorf("Không thể lấy danh sách mã giảm giá: %v", err)
 	}
 
-	if err := config.DB.Where("user_id = ?", user.ID).Find(&userDiscounts).Error; err != nil {
-		return 0, fmt.Errorf("Lỗi khi kiểm tra lịch sử sử dụng mã giảm giá: %v", err)
+	if err := tx.Where("user_id = ?", user.ID).Find(&userDiscounts).Error; err != nil {
+		return models.Discount{}, fmt.Errorf("Lỗi khi kiểm tra lịch sử sử dụng mã giảm giá: %v", err)
 	}
 
 	userDiscountUsage := make(map[uint]int)
@@ -500,25 +289,31 @@ func ApplyDiscountForUser(user models.User) (float64, error) {
 		userDiscountUsage[userDiscount.DiscountID] = userDiscount.UsageCount
 	}
 
-	var applicableDiscount models.Discount
-
 	for _, discount := range discounts {
 		if discount.ID == 1 {
-			applicableDiscount = discount
-			break
+			return discount, nil
 		}
 		if usageCount, used := userDiscountUsage[discount.ID]; !used || usageCount < discount.Quantity {
-			applicableDiscount = discount
-			break
+			return discount, nil
 		}
 	}
 
+	return models.Discount{}, nil
+}
+
+// ApplyDiscountForUser chọn mã giảm giá phù hợp và ghi nhận lượt sử dụng trong tx được truyền vào
+func ApplyDiscountForUser(tx *gorm.DB, user models.User) (float64, error) {
+	applicableDiscount, err := FindDiscountForUser(tx, user)
+	if err != nil {
+		return 0, err
+	}
+
 	if applicableDiscount.ID == 0 {
 		return 0, nil
 	}
 
 	var userDiscount models.UserDiscount
-	if err := config.DB.Where("user_id = ? AND discount_id = ?", user.ID, applicableDiscount.ID).First(&userDiscount).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+	if err := tx.Where("user_id = ? AND discount_id = ?", user.ID, applicableDiscount.ID).First(&userDiscount).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return 0, fmt.Errorf("Lỗi khi kiểm tra lịch sử sử dụng mã giảm giá: %v", err)
 	}
 
@@ -530,7 +325,7 @@ func ApplyDiscountForUser(user models.User) (float64, error) {
 		userDiscount.UsageCount += 1
 	}
 
-	if err := config.DB.Save(&userDiscount).Error; err != nil {
+	if err := tx.Save(&userDiscount).Error; err != nil {
 		return 0, fmt.Errorf("Không thể cập nhật thông tin sử dụng mã giảm giá: %v", err)
 	}
 
@@ -549,52 +344,3 @@ func CheckUserEligibilityForDiscount(userID uint) bool {
 
 	return true
 }
-
-func SendPayEmail(email string, vat, vatLastMonth, totalVat int, qrCodeURL string) error {
-	from := "takieulong@gmail.com"
-	password := "audj brda qhbq lpxu"
-
-	host := "smtp.gmail.com"
-	port := "587"
-	to := []string{email}
-	subject := "Subject: Thông báo phí thường niên\r\n"
-
-	emailContent := fmt.Sprintf(`
-	<!DOCTYPE html>
-	<html>
-	<head>
-		<meta charset="UTF-8">
-		<title>Thông báo nhắc đóng phí</title>
-	</head>
-	<body>
-		<p>Xin chào bạn,</p>
-		<p>Đây là thông báo nhắc nhở bạn hoàn thành việc đóng phí đúng hẹn.</p>
-		<p><strong>Thông tin doanh thu của bạn:</strong></p>
-		<ul>
-			<li>VAT hiện tại: <strong>%d</strong></li>
-			<li>VAT tháng trước: <strong>%d</strong></li>
-			<li><strong>Tổng số thanh toán:</strong> <span style="color: red; font-size: 20px; font-weight: bold;">%d</span></li>
-		</ul>
-		<p>Bạn vui lòng quét mã QR bên dưới để hoàn tất thanh toán:</p>
-		<p>
-			<img alt="QR Code for Payment" src="%s" width="400">
-		</p>
-		<p><strong>Thông tin tài khoản ngân hàng:</strong></p>
-		<p>Số tài khoản: SACOMBANK - 060915374450</p>
-		<p><strong>Vui lòng kiểm tra và hoàn tất thanh toán theo số tài khoản trên.</strong></p>
-		<p>Chúng tôi rất cảm ơn bạn đã sử dụng dịch vụ của chúng tôi.</p>
-		<p>Trân trọng,<br>Nhóm hỗ trợ</p>
-	</body>
-	</html>
-	`, vat, vatLastMonth, totalVat, qrCodeURL)
-
-	msg := []byte("MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=UTF-8\r\n" +
-		subject + "\r\n" +
-		emailContent)
-
-	auth := smtp.PlainAuth("", from, password, host)
-
-	err := smtp.SendMail(host+":"+port, auth, from, to, msg)
-	return err
-}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrHoldExpired: giữ chỗ của đơn đã hết hạn (hoặc đã được nhả), lịch có thể đã được khách khác đặt
+var ErrHoldExpired = errors.New("Giữ chỗ của đơn đã hết hạn, vui lòng đặt lại")
+
+// bookingHoldDuration mặc định 15 phút, ghi đè bằng BOOKING_HOLD_MINUTES qua cấu hình
+var bookingHoldDuration = 15 * time.Minute
+
+func configureBooking(cfg config.BookingConfig) {
+	if cfg.HoldMinutes > 0 {
+		bookingHoldDuration = time.Duration(cfg.HoldMinutes) * time.Minute
+	}
+}
+
+// BookingHoldDuration trả về thời gian giữ chỗ cho một đơn đang chờ xác nhận
+func BookingHoldDuration() time.Duration {
+	return bookingHoldDuration
+}
+
+// BlockingStatusScope lọc các trạng thái đang chiếm lịch: đã đặt hoặc đang giữ chỗ chưa hết hạn
+func BlockingStatusScope(now time.Time) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(status = ? OR (status = ? AND expires_at > ?))",
+			models.StatusBooked, models.StatusHold, now)
+	}
+}
+
+// ConfirmOrderHold chuyển các trạng thái giữ chỗ còn hạn của đơn thành đã đặt.
+// Giữ chỗ đã hết hạn được BlockingStatusScope coi là trống nên có thể đã bị đơn khác đặt:
+// khi không còn giữ chỗ nào còn hạn thì trả về ErrHoldExpired thay vì xác nhận.
+// Đơn tạo trước khi có giữ chỗ (không có HoldExpiresAt) đã chiếm lịch bằng dòng đã đặt không có order_id,
+// các dòng này được gắn vào đơn để lần nhả sau khớp theo order_id.
+func ConfirmOrderHold(tx *gorm.DB, order models.Order) error {
+	now := time.Now()
+	updates := map[string]interface{}{"status": models.StatusBooked, "expires_at": nil}
+
+	roomResult := tx.Model(&models.RoomStatus{}).
+		Where("order_id = ? AND status = ? AND expires_at > ?", order.ID, models.StatusHold, now).
+		Updates(updates)
+	if roomResult.Error != nil {
+		return fmt.Errorf("không thể xác nhận giữ phòng: %w", roomResult.Error)
+	}
+
+	accResult := tx.Model(&models.AccommodationStatus{}).
+		Where("order_id = ? AND status = ? AND expires_at > ?", order.ID, models.StatusHold, now).
+		Updates(updates)
+	if accResult.Error != nil {
+		return fmt.Errorf("không thể xác nhận giữ chỗ ở: %w", accResult.Error)
+	}
+
+	if roomResult.RowsAffected+accResult.RowsAffected == 0 {
+		if order.HoldExpiresAt != nil {
+			return ErrHoldExpired
+		}
+		legacy, err := legacyOrderStatuses(tx, order)
+		if err != nil {
+			return err
+		}
+		result := legacy.Update("order_id", order.ID)
+		if result.Error != nil {
+			return fmt.Errorf("không thể xác nhận lịch của đơn: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrHoldExpired
+		}
+	}
+
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).
+		Update("hold_expires_at", nil).Error; err != nil {
+		return fmt.Errorf("không thể cập nhật hạn giữ chỗ của đơn: %w", err)
+	}
+
+	return nil
+}
+
+// legacyOrderStatuses lọc các dòng đã đặt của đơn tạo trước khi có cột order_id:
+// khớp theo phòng (hoặc chỗ ở nếu đơn không có phòng) và đúng khoảng ngày của đơn
+func legacyOrderStatuses(tx *gorm.DB, order models.Order) (*gorm.DB, error) {
+	checkInDate, err := time.Parse("02/01/2006", order.CheckInDate)
+	if err != nil {
+		return nil, fmt.Errorf("ngày nhận phòng không hợp lệ: %w", err)
+	}
+	checkOutDate, err := time.Parse("02/01/2006", order.CheckOutDate)
+	if err != nil {
+		return nil, fmt.Errorf("ngày trả phòng không hợp lệ: %w", err)
+	}
+
+	if len(order.Room) > 0 {
+		var roomIDs []uint
+		for _, room := range order.Room {
+			roomIDs = append(roomIDs, room.RoomId)
+		}
+		return tx.Model(&models.RoomStatus{}).
+			Where("order_id IS NULL AND room_id IN ? AND status = ? AND from_date = ? AND to_date = ?",
+				roomIDs, models.StatusBooked, checkInDate, checkOutDate), nil
+	}
+
+	return tx.Model(&models.AccommodationStatus{}).
+		Where("order_id IS NULL AND accommodation_id = ? AND status = ? AND from_date = ? AND to_date = ?",
+			order.AccommodationID, models.StatusBooked, checkInDate, checkOutDate), nil
+}
+
+// ReleaseOrderStatuses nhả đúng các dòng trạng thái (đã đặt hoặc giữ chỗ) thuộc về đơn hàng.
+// Đơn tạo trước khi có cột order_id thì khớp theo phòng/chỗ ở và đúng khoảng ngày của đơn.
+func ReleaseOrderStatuses(tx *gorm.DB, order models.Order) error {
+	release := map[string]interface{}{"status": models.StatusAvailable, "expires_at": nil}
+	activeStatuses := []int{models.StatusBooked, models.StatusHold}
+
+	roomResult := tx.Model(&models.RoomStatus{}).
+		Where("order_id = ? AND status IN ?", order.ID, activeStatuses).
+		Updates(release)
+	if roomResult.Error != nil {
+		return fmt.Errorf("không thể cập nhật trạng thái phòng: %w", roomResult.Error)
+	}
+
+	accResult := tx.Model(&models.AccommodationStatus{}).
+		Where("order_id = ? AND status IN ?", order.ID, activeStatuses).
+		Updates(release)
+	if accResult.Error != nil {
+		return fmt.Errorf("không thể cập nhật trạng thái chỗ ở: %w", accResult.Error)
+	}
+
+	if roomResult.RowsAffected+accResult.RowsAffected > 0 {
+		return nil
+	}
+
+	legacy, err := legacyOrderStatuses(tx, order)
+	if err != nil {
+		return err
+	}
+	if err := legacy.Updates(release).Error; err != nil {
+		return fmt.Errorf("không thể cập nhật trạng thái của đơn: %w", err)
+	}
+	return nil
+}
+
+// ReleaseExpiredHolds nhả các giữ chỗ đã quá hạn và hủy những đơn còn đang chờ xác nhận
+func ReleaseExpiredHolds() error {
+	now := time.Now()
+	var orderIDs []uint
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var roomOrderIDs, accOrderIDs []uint
+
+		if err := tx.Model(&models.RoomStatus{}).
+			Where("status = ? AND expires_at <= ? AND order_id IS NOT NULL", models.StatusHold, now).
+			Distinct().Pluck("order_id", &roomOrderIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AccommodationStatus{}).
+			Where("status = ? AND expires_at <= ? AND order_id IS NOT NULL", models.StatusHold, now).
+			Distinct().Pluck("order_id", &accOrderIDs).Error; err != nil {
+			return err
+		}
+		orderIDs = append(roomOrderIDs, accOrderIDs...)
+
+		release := map[string]interface{}{"status": models.StatusAvailable, "expires_at": nil}
+		if err := tx.Model(&models.RoomStatus{}).
+			Where("status = ? AND expires_at <= ?", models.StatusHold, now).
+			Updates(release).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AccommodationStatus{}).
+			Where("status = ? AND expires_at <= ?", models.StatusHold, now).
+			Updates(release).Error; err != nil {
+			return err
+		}
+
+		if len(orderIDs) == 0 {
+			return nil
+		}
+
+		return tx.Model(&models.Order{}).
+			Where("id IN ? AND status = ?", orderIDs, 0).
+			Updates(map[string]interface{}{"status": 2, "hold_expires_at": nil, "updated_at": now}).Error
+	})
+	if err != nil {
+		log.Println("❌ Lỗi khi nhả giữ chỗ quá hạn:", err)
+		return err
+	}
+
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	log.Printf("✅ Đã nhả giữ chỗ quá hạn cho %d đơn hàng\n", len(orderIDs))
+
+	ClearBookingCaches()
+	return nil
+}
+
+// ClearBookingCaches xóa cache lịch phòng, đơn hàng và hóa đơn sau khi trạng thái đặt phòng thay đổi ngoài request
+func ClearBookingCaches() {
+	rdb, err := config.ConnectRedis()
+	if err != nil {
+		return
+	}
+	_ = DeleteFromRedis(config.Ctx, rdb, "rooms:statuses")
+	_ = DeleteFromRedis(config.Ctx, rdb, "accommodations:statuses")
+	_ = DeleteFromRedis(config.Ctx, rdb, "orders:all")
+	for _, pattern := range []string{"orders:all:user:*", "invoices:*"} {
+		iter := rdb.Scan(config.Ctx, 0, pattern, 0).Iterator()
+		for iter.Next(config.Ctx) {
+			_ = DeleteFromRedis(config.Ctx, rdb, iter.Val())
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOutboxEmailNotFound   = errors.New("không tìm thấy email trong hàng đợi")
+	ErrOutboxEmailNotFailing = errors.New("chỉ gửi lại được email đang lỗi")
+)
+
+const (
+	// outboxBatchSize là số email tối đa mỗi lượt worker nhận gửi
+	outboxBatchSize = 20
+	// outboxSendingLease là thời gian một email được giữ ở trạng thái đang gửi; worker chết giữa chừng
+	// thì hết thời gian này email được lượt sau nhận lại
+	outboxSendingLease = 5 * time.Minute
+	outboxMaxBackoff   = 6 * time.Hour
+)
+
+var (
+	outboxMaxAttempts = 8
+	outboxRetryBase   = 30 * time.Second
+)
+
+func configureOutbox(cfg config.MailConfig) {
+	if cfg.MaxAttempts > 0 {
+		outboxMaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.RetryBaseSeconds > 0 {
+		outboxRetryBase = time.Duration(cfg.RetryBaseSeconds) * time.Second
+	}
+}
+
+// enqueueEmail ghi email vào hàng đợi trong transaction tx: email chỉ được gửi khi dữ liệu nghiệp vụ đã commit
+func enqueueEmail(tx *gorm.DB, template string, email Email) error {
+	return tx.Create(&models.EmailOutbox{
+		Recipients:    strings.Join(email.To, ","),
+		Template:      template,
+		Subject:       email.Subject,
+		HTML:          email.HTML,
+		Text:          email.Text,
+		Status:        models.EmailPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// outboxBackoff là thời gian chờ trước lần thử tiếp theo sau attempts lần thất bại
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxRetryBase
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > outboxMaxBackoff {
+		backoff = outboxMaxBackoff
+	}
+	return backoff
+}
+
+// claimOutboxEmails nhận một lô email đến hạn và chuyển sang trạng thái đang gửi.
+// SKIP LOCKED để nhiều lượt worker (hoặc nhiều instance) chạy song song không nhận trùng email.
+func claimOutboxEmails(now time.Time) ([]models.EmailOutbox, error) {
+	var emails []models.EmailOutbox
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status IN ? AND next_attempt_at <= ?", []int{models.EmailPending, models.EmailSending}, now).
+			Order("next_attempt_at").
+			Limit(outboxBatchSize).
+			Find(&emails).Error; err != nil {
+			return err
+		}
+		if len(emails) == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(emails))
+		for _, email := range emails {
+			ids = append(ids, email.ID)
+		}
+		return tx.Model(&models.EmailOutbox{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":          models.EmailSending,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(outboxSendingLease),
+		}).Error
+	})
+	return emails, err
+}
+
+// deliverOutboxEmail gửi một email đã nhận và ghi kết quả: thành công thì xóa nội dung,
+// thất bại thì hẹn lần thử sau hoặc chuyển sang trạng thái chết khi hết số lần thử
+func deliverOutboxEmail(email models.EmailOutbox) error {
+	attempts := email.Attempts + 1
+	sendErr := sendEmail(Email{
+		To:      strings.Split(email.Recipients, ","),
+		Subject: email.Subject,
+		HTML:    email.HTML,
+		Text:    email.Text,
+	})
+
+	now := time.Now()
+	updates := map[string]interface{}{}
+	if sendErr == nil {
+		updates["status"] = models.EmailSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+		updates["html"] = ""
+		updates["text"] = ""
+	} else if attempts >= outboxMaxAttempts {
+		updates["status"] = models.EmailDead
+		updates["last_error"] = sendErr.Error()
+		log.Printf("❌ Email #%d (%s) bị bỏ sau %d lần gửi lỗi: %v", email.ID, email.Template, attempts, sendErr)
+	} else {
+		updates["status"] = models.EmailPending
+		updates["last_error"] = sendErr.Error()
+		updates["next_attempt_at"] = now.Add(outboxBackoff(attempts))
+	}
+
+	return config.DB.Model(&models.EmailOutbox{}).
+		Where("id = ? AND status = ?", email.ID, models.EmailSending).
+		Updates(updates).Error
+}
+
+// DeliverOutboxEmails gửi các email đến hạn trong hàng đợi, được gọi định kỳ bởi cron
+func DeliverOutboxEmails() {
+	emails, err := claimOutboxEmails(time.Now())
+	if err != nil {
+		log.Println("❌ Lỗi khi lấy email trong hàng đợi:", err)
+		return
+	}
+
+	for _, email := range emails {
+		if err := deliverOutboxEmail(email); err != nil {
+			log.Printf("❌ Lỗi khi cập nhật email #%d trong hàng đợi: %v", email.ID, err)
+		}
+	}
+}
+
+// ListOutboxEmails liệt kê email trong hàng đợi, lọc theo trạng thái nếu status khác nil
+func ListOutboxEmails(status *int, page, limit int) ([]models.EmailOutbox, int64, error) {
+	query := config.DB.Model(&models.EmailOutbox{})
+	if status != nil {
+		query = query.Where("status = ?", *status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var emails []models.EmailOutbox
+	err := query.Order("id DESC").Offset(page * limit).Limit(limit).Find(&emails).Error
+	return emails, total, err
+}
+
+// ResendOutboxEmail đưa một email lỗi (chết hoặc đang chờ thử lại) về hàng đợi để gửi ngay với số lần thử mới
+func ResendOutboxEmail(id uint) (models.EmailOutbox, error) {
+	var email models.EmailOutbox
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&email, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrOutboxEmailNotFound
+			}
+			return err
+		}
+		if email.Status == models.EmailSent || email.Status == models.EmailSending {
+			return ErrOutboxEmailNotFailing
+		}
+
+		email.Status = models.EmailPending
+		email.Attempts = 0
+		email.NextAttemptAt = time.Now()
+		return tx.Model(&email).Updates(map[string]interface{}{
+			"status":          email.Status,
+			"attempts":        email.Attempts,
+			"next_attempt_at": email.NextAttemptAt,
+		}).Error
+	})
+	return email, err
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"net/url"
+	"strings"
+	texttemplate "text/template"
+
+	"gorm.io/gorm"
+)
+
+// Mỗi email gồm <tên>.html (định nghĩa "content", được lồng vào layout.html) và
+// <tên>.txt (định nghĩa "subject" và "body" cho bản văn bản thuần)
+//
+//go:embed templates/email/*.html templates/email/*.txt
+var emailTemplateFS embed.FS
+
+type emailTemplate struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+var emailTemplates = mustLoadEmailTemplates(
+	"verify_email", "login_code", "account_created", "order_created", "notice", "annual_fee",
+	"checkin_reminder", "review_request",
+)
+
+func mustLoadEmailTemplates(names ...string) map[string]emailTemplate {
+	layout := htmltemplate.Must(htmltemplate.ParseFS(emailTemplateFS, "templates/email/layout.html"))
+
+	templates := make(map[string]emailTemplate, len(names))
+	for _, name := range names {
+		html := htmltemplate.Must(htmltemplate.Must(layout.Clone()).ParseFS(emailTemplateFS, "templates/email/"+name+".html"))
+		text := texttemplate.Must(texttemplate.New(name).ParseFS(emailTemplateFS, "templates/email/"+name+".txt"))
+		templates[name] = emailTemplate{html: html, text: text}
+	}
+	return templates
+}
+
+// renderEmail dựng tiêu đề, bản văn bản thuần và bản HTML (dữ liệu được escape tự động) của email name
+func renderEmail(name string, to []string, data map[string]interface{}) (Email, error) {
+	tmpl, ok := emailTemplates[name]
+	if !ok {
+		return Email{}, fmt.Errorf("không có mẫu email %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Email{}, err
+	}
+	data["Subject"] = strings.TrimSpace(subject.String())
+
+	if err := tmpl.text.ExecuteTemplate(&text, "body", data); err != nil {
+		return Email{}, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout", data); err != nil {
+		return Email{}, err
+	}
+
+	return Email{To: to, Subject: data["Subject"].(string), HTML: html.String(), Text: text.String()}, nil
+}
+
+// queueTemplatedEmail render email name và xếp vào hàng đợi trong transaction tx, worker sẽ gửi sau khi commit
+func queueTemplatedEmail(tx *gorm.DB, to string, name string, data map[string]interface{}) error {
+	email, err := renderEmail(name, []string{to}, data)
+	if err != nil {
+		return err
+	}
+	return enqueueEmail(tx, name, email)
+}
+
+func sendVerificationEmail(tx *gorm.DB, email string, token string) error {
+	verifyURL := fmt.Sprintf("%s/verify-email?email=%s&token=%s", frontendURL, url.QueryEscape(email), url.QueryEscape(token))
+	return queueTemplatedEmail(tx, email, "verify_email", map[string]interface{}{
+		"Email":     email,
+		"Code":      token,
+		"VerifyURL": verifyURL,
+	})
+}
+
+func sendcodeEmail(tx *gorm.DB, email string, token string) error {
+	return queueTemplatedEmail(tx, email, "login_code", map[string]interface{}{
+		"Email": email,
+		"Code":  token,
+	})
+}
+
+func sendUserEmail(tx *gorm.DB, email string, phone string, pass string) error {
+	return queueTemplatedEmail(tx, email, "account_created", map[string]interface{}{
+		"Email":    email,
+		"Phone":    phone,
+		"Password": pass,
+	})
+}
+
+func SendOrderEmail(tx *gorm.DB, email string, orderId uint, totalPrice float64, checkInDate string, checkOutDate string) error {
+	return queueTemplatedEmail(tx, email, "order_created", map[string]interface{}{
+		"OrderID":      orderId,
+		"CheckInDate":  checkInDate,
+		"CheckOutDate": checkOutDate,
+		"TotalPrice":   formatCurrency(totalPrice),
+	})
+}
+
+func sendNews(tx *gorm.DB, email string, title string, mess string) error {
+	return queueTemplatedEmail(tx, email, "notice", map[string]interface{}{
+		"Email":   email,
+		"Title":   title,
+		"Message": mess,
+	})
+}
+
+func SendPayEmail(tx *gorm.DB, email string, vat, vatLastMonth, totalVat int, qrCodeURL string) error {
+	return queueTemplatedEmail(tx, email, "annual_fee", map[string]interface{}{
+		"Vat":           vat,
+		"VatLastMonth":  vatLastMonth,
+		"TotalVat":      totalVat,
+		"QRCodeURL":     qrCodeURL,
+		"BankCode":      payoutConfig.BankCode,
+		"AccountNumber": payoutConfig.AccountNumber,
+	})
+}
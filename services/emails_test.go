@@ -0,0 +1,188 @@
+package services
+
+import (
+	"bytes"
+	"mime"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// injected là dữ liệu người dùng nhập có ký tự HTML, phải được escape trong bản HTML
+// nhưng giữ nguyên trong bản văn bản thuần
+const injected = `<script>alert("x")</script> & Co`
+
+const injectedHTML = `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; Co`
+
+func TestEmailTemplatesRenderThroughMemoryMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		subject string
+		html    []string // Đoạn phải có trong bản HTML
+		text    []string // Đoạn phải có trong bản văn bản thuần
+	}{
+		{
+			name: "verify_email",
+			data: map[string]interface{}{
+				"Email":     "khach@example.com",
+				"Code":      injected,
+				"VerifyURL": "https://trothalo.click/verify-email?email=khach%40example.com&token=123456",
+			},
+			subject: "Mã dùng một lần của bạn",
+			html:    []string{injectedHTML, "verify-email?email=khach%40example.com&amp;token=123456"},
+			text:    []string{injected, "verify-email?email=khach%40example.com&token=123456"},
+		},
+		{
+			name:    "login_code",
+			data:    map[string]interface{}{"Email": "khach@example.com", "Code": injected},
+			subject: "Mã đăng nhập",
+			html:    []string{injectedHTML, "khach@example.com"},
+			text:    []string{"Mã đăng nhập là: " + injected},
+		},
+		{
+			name:    "account_created",
+			data:    map[string]interface{}{"Email": "khach@example.com", "Phone": "0900000001", "Password": injected},
+			subject: "Bạn đã tạo tài khoản mới",
+			html:    []string{injectedHTML, "0900000001"},
+			text:    []string{"- Mật khẩu: " + injected, "- Số điện thoại: 0900000001"},
+		},
+		{
+			name: "order_created",
+			data: map[string]interface{}{
+				"OrderID":      42,
+				"CheckInDate":  injected,
+				"CheckOutDate": "03/12/2030",
+				"TotalPrice":   formatCurrency(1500000),
+			},
+			subject: "Đặt đơn hàng thành công",
+			html:    []string{injectedHTML, "<strong>42</strong>", formatCurrency(1500000) + " VND"},
+			text:    []string{"- Mã đơn hàng: 42", "- Ngày nhận phòng: " + injected},
+		},
+		{
+			name:    "notice",
+			data:    map[string]interface{}{"Email": "khach@example.com", "Title": "Bảo trì <hệ thống>", "Message": injected},
+			subject: "Bảo trì <hệ thống>",
+			html:    []string{injectedHTML, "<title>Bảo trì &lt;hệ thống&gt;</title>"},
+			text:    []string{injected},
+		},
+		{
+			name: "annual_fee",
+			data: map[string]interface{}{
+				"Vat":           100000,
+				"VatLastMonth":  90000,
+				"TotalVat":      190000,
+				"QRCodeURL":     "https://img.vietqr.io/image/MB-123-compact.png",
+				"BankCode":      "MB",
+				"AccountNumber": injected,
+			},
+			subject: "Thông báo phí thường niên",
+			html:    []string{injectedHTML, "190000"},
+			text:    []string{"Số tài khoản: MB - " + injected, "- Tổng số thanh toán: 190000"},
+		},
+		{
+			name: "checkin_reminder",
+			data: map[string]interface{}{
+				"Name":              "An",
+				"OrderID":           42,
+				"AccommodationName": injected,
+				"Address":           "1 Lê Lợi",
+				"TimeCheckIn":       "14:00",
+				"CheckInDate":       "01/12/2030",
+				"CheckOutDate":      "03/12/2030",
+				"UnsubscribeURL":    "https://trothalo.click/unsubscribe?email=an%40example.com&token=abc",
+			},
+			subject: "Nhắc lịch nhận phòng ngày mai - " + injected,
+			html:    []string{injectedHTML, "unsubscribe?email=an%40example.com&amp;token=abc"},
+			text:    []string{"tại " + injected, "- Ngày nhận phòng: 01/12/2030, từ 14:00"},
+		},
+		{
+			name: "review_request",
+			data: map[string]interface{}{
+				"Name":              injected,
+				"AccommodationName": "Homestay",
+				"CheckInDate":       "01/12/2030",
+				"CheckOutDate":      "03/12/2030",
+				"RateURL":           "https://trothalo.click/rates?accommodationId=1&orderId=42",
+				"UnsubscribeURL":    "https://trothalo.click/unsubscribe?email=an%40example.com&token=abc",
+			},
+			subject: "Bạn thấy kỳ nghỉ tại Homestay thế nào?",
+			html:    []string{injectedHTML, "rates?accommodationId=1&amp;orderId=42"},
+			text:    []string{"Xin chào " + injected + ",", "rates?accommodationId=1&orderId=42"},
+		},
+	}
+
+	if len(tests) != len(emailTemplates) {
+		t.Fatalf("có %d mẫu email nhưng chỉ kiểm thử %d", len(emailTemplates), len(tests))
+	}
+
+	memory := &MemoryMailer{From: "Trothalo <no-reply@trothalo.click>"}
+	previous := SetMailer(memory)
+	t.Cleanup(func() { SetMailer(previous) })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory.Reset()
+			to := []string{"khach@example.com", "chu-nha@example.com"}
+
+			email, err := renderEmail(tt.name, to, tt.data)
+			if err != nil {
+				t.Fatalf("renderEmail: %v", err)
+			}
+			if err := sendEmail(email); err != nil {
+				t.Fatalf("sendEmail: %v", err)
+			}
+
+			sent := memory.Messages()
+			if len(sent) != 1 {
+				t.Fatalf("MemoryMailer nhận %d email, muốn 1", len(sent))
+			}
+			got := sent[0]
+
+			if got.Subject != tt.subject {
+				t.Errorf("Subject = %q, muốn %q", got.Subject, tt.subject)
+			}
+			if strings.Join(got.To, ",") != strings.Join(to, ",") {
+				t.Errorf("To = %v, muốn %v", got.To, to)
+			}
+			if strings.Contains(got.HTML, "<script>") {
+				t.Errorf("bản HTML chưa escape dữ liệu:\n%s", got.HTML)
+			}
+			for _, want := range tt.html {
+				if !strings.Contains(got.HTML, want) {
+					t.Errorf("bản HTML thiếu %q:\n%s", want, got.HTML)
+				}
+			}
+			for _, want := range tt.text {
+				if !strings.Contains(got.Text, want) {
+					t.Errorf("bản văn bản thiếu %q:\n%s", want, got.Text)
+				}
+			}
+
+			// Header của email MIME: tiêu đề mã hóa RFC 2047 phải giải mã về đúng tiêu đề, đủ người nhận
+			message, err := mail.ReadMessage(bytes.NewReader(got.Raw))
+			if err != nil {
+				t.Fatalf("email MIME không đọc được: %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+			if err != nil || subject != tt.subject {
+				t.Errorf("header Subject = %q (%v), muốn %q", subject, err, tt.subject)
+			}
+			recipients, err := message.Header.AddressList("To")
+			if err != nil || len(recipients) != len(to) {
+				t.Fatalf("header To = %v (%v), muốn %v", recipients, err, to)
+			}
+			for i, recipient := range recipients {
+				if recipient.Address != to[i] {
+					t.Errorf("header To[%d] = %q, muốn %q", i, recipient.Address, to[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenderEmailUnknownTemplate(t *testing.T) {
+	if _, err := renderEmail("khong_co", []string{"khach@example.com"}, map[string]interface{}{}); err == nil {
+		t.Fatal("renderEmail với mẫu không tồn tại phải trả về lỗi")
+	}
+}
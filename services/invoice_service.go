@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrPaymentExceedsRemaining: khoản thu lớn hơn số tiền hóa đơn còn phải trả
+var ErrPaymentExceedsRemaining = errors.New("Số tiền vượt quá số còn phải trả")
+
+// LockInvoice khóa hóa đơn FOR UPDATE để ghi sổ thanh toán. Hóa đơn cũ đã có PaidAmount nhưng chưa có
+// dòng nào trong sổ sẽ được bổ sung một khoản đầu kỳ, để tính lại từ sổ không làm mất số tiền đã thu.
+func LockInvoice(tx *gorm.DB, invoiceID uint) (*models.Invoice, error) {
+	var invoice models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, invoiceID).Error; err != nil {
+		return nil, err
+	}
+
+	if invoice.PaidAmount <= 0 {
+		return &invoice, nil
+	}
+
+	var count int64
+	if err := tx.Model(&models.InvoicePayment{}).Where("invoice_id = ?", invoice.ID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("không thể kiểm tra sổ thanh toán: %w", err)
+	}
+	if count > 0 {
+		return &invoice, nil
+	}
+
+	paidAt := invoice.CreatedAt
+	if invoice.PaymentDate != nil {
+		paidAt = *invoice.PaymentDate
+	}
+	method := models.PaymentMethodCash
+	if invoice.PaymentType != nil {
+		method = *invoice.PaymentType
+	}
+	opening := models.InvoicePayment{
+		InvoiceID: invoice.ID,
+		Amount:    invoice.PaidAmount,
+		Method:    method,
+		PaidAt:    paidAt,
+		Note:      "Số tiền đã thu trước khi có sổ thanh toán",
+	}
+	if err := tx.Create(&opening).Error; err != nil {
+		return nil, fmt.Errorf("không thể bổ sung khoản thanh toán đầu kỳ: %w", err)
+	}
+
+	return &invoice, nil
+}
+
+// RecalculateInvoice tính lại số đã trả, số còn lại và trạng thái của hóa đơn từ các khoản thanh toán chưa bị hủy
+func RecalculateInvoice(tx *gorm.DB, invoice *models.Invoice) error {
+	var payments []models.InvoicePayment
+	if err := tx.Where("invoice_id = ? AND voided_at IS NULL", invoice.ID).
+		Order("paid_at ASC, id ASC").
+		Find(&payments).Error; err != nil {
+		return fmt.Errorf("không thể lấy sổ thanh toán: %w", err)
+	}
+
+	paid := 0.0
+	for _, payment := range payments {
+		paid += payment.Amount
+	}
+
+	invoice.PaidAmount = paid
+	invoice.RemainingAmount = invoice.TotalAmount - paid
+	if invoice.RemainingAmount < 0 {
+		invoice.RemainingAmount = 0
+	}
+
+	invoice.PaymentDate = nil
+	invoice.PaymentType = nil
+	if len(payments) > 0 {
+		last := payments[len(payments)-1]
+		method := last.Method
+		invoice.PaymentType = &method
+		if invoice.RemainingAmount == 0 {
+			paidAt := last.PaidAt
+			invoice.PaymentDate = &paidAt
+		}
+	}
+
+	// Hóa đơn đã hủy giữ nguyên trạng thái, còn lại suy ra từ số tiền còn phải trả
+	if invoice.Status != 2 {
+		if invoice.RemainingAmount == 0 && invoice.TotalAmount > 0 {
+			invoice.Status = 1
+		} else {
+			invoice.Status = 0
+		}
+	}
+
+	if err := tx.Model(invoice).Omit(clause.Associations).Updates(map[string]interface{}{
+		"paid_amount":      invoice.PaidAmount,
+		"remaining_amount": invoice.RemainingAmount,
+		"payment_date":     invoice.PaymentDate,
+		"payment_type":     invoice.PaymentType,
+		"status":           invoice.Status,
+		"updated_at":       time.Now(),
+	}).Error; err != nil {
+		return fmt.Errorf("không thể cập nhật hóa đơn: %w", err)
+	}
+	return nil
+}
+
+// ConfirmOrder xác nhận đơn đang chờ: chuyển giữ chỗ thành đã đặt, lập hóa đơn
+// và ghi doanh thu vào ngày lập hóa đơn. adminID là chủ chỗ ở của đơn.
+func ConfirmOrder(tx *gorm.DB, order *models.Order, adminID uint) (*models.Invoice, error) {
+	if err := ConfirmOrderHold(tx, *order); err != nil {
+		return nil, err
+	}
+
+	invoice := models.Invoice{
+		OrderID:         order.ID,
+		TotalAmount:     order.TotalPrice,
+		RemainingAmount: order.TotalPrice,
+		AdminID:         adminID,
+	}
+	if err := tx.Create(&invoice).Error; err != nil {
+		return nil, fmt.Errorf("không thể tạo hóa đơn: %w", err)
+	}
+	if err := AddUserRevenue(tx, invoice.AdminID, invoice.CreatedAt, invoice.TotalAmount, 1); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if err := tx.Model(order).Omit(clause.Associations).Updates(map[string]interface{}{
+		"status":          1,
+		"hold_expires_at": nil,
+		"updated_at":      now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("không thể xác nhận đơn hàng: %w", err)
+	}
+	order.Status = 1
+	order.HoldExpiresAt = nil
+
+	return &invoice, nil
+}
+
+// RecordInvoicePayment ghi một khoản thu vào sổ của hóa đơn (đã khóa bằng LockInvoice) rồi tính lại hóa đơn.
+// Khoản thu không được vượt quá số còn phải trả để hóa đơn không bị thu dư.
+func RecordInvoicePayment(tx *gorm.DB, invoice *models.Invoice, payment *models.InvoicePayment) error {
+	payment.InvoiceID = invoice.ID
+	if err := payment.Validate(); err != nil {
+		return err
+	}
+	if payment.Amount > invoice.RemainingAmount {
+		return fmt.Errorf("%w (%.0f)", ErrPaymentExceedsRemaining, invoice.RemainingAmount)
+	}
+	if err := tx.Create(payment).Error; err != nil {
+		return fmt.Errorf("không thể ghi nhận thanh toán: %w", err)
+	}
+	return RecalculateInvoice(tx, invoice)
+}
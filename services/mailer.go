@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email là một email đã render: bản HTML kèm bản văn bản thuần cho trình đọc không hiển thị HTML
+type Email struct {
+	To      []string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer gửi email. Có ba bản: SMTPMailer gửi thật, FileMailer ghi vào file mbox để xem lại
+// và MemoryMailer giữ trong bộ nhớ để kiểm tra các luồng gửi mail mà không cần máy chủ SMTP.
+type Mailer interface {
+	Send(email Email) error
+}
+
+var mailer Mailer
+
+// SetMailer thay Mailer đang dùng (ví dụ MemoryMailer khi kiểm thử), trả về Mailer cũ
+func SetMailer(m Mailer) Mailer {
+	previous := mailer
+	mailer = m
+	return previous
+}
+
+func sendEmail(email Email) error {
+	if mailer == nil {
+		return errors.New("chưa cấu hình Mailer, không thể gửi email")
+	}
+	return mailer.Send(email)
+}
+
+// buildMessage dựng email MIME multipart/alternative (text + HTML, quoted-printable)
+// với các header From, To, Subject (mã hóa theo RFC 2047), Date và Message-ID
+func buildMessage(from string, email Email, now time.Time) ([]byte, error) {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("địa chỉ gửi không hợp lệ: %w", err)
+	}
+	if len(email.To) == 0 {
+		return nil, errors.New("email không có người nhận")
+	}
+	recipients := make([]string, 0, len(email.To))
+	for _, to := range email.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return nil, fmt.Errorf("địa chỉ nhận không hợp lệ %q: %w", to, err)
+		}
+		recipients = append(recipients, address.String())
+	}
+
+	messageID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(sender.Address, "@"); at >= 0 {
+		domain = sender.Address[at+1:]
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", email.Text},
+		{"text/html; charset=UTF-8", email.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(partWriter)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	headers := [][2]string{
+		{"From", sender.String()},
+		{"To", strings.Join(recipients, ", ")},
+		{"Subject", mime.QEncoding.Encode("UTF-8", email.Subject)},
+		{"Date", now.Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", messageID, domain)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", writer.Boundary())},
+	}
+	for _, header := range headers {
+		message.WriteString(header[0] + ": " + header[1] + "\r\n")
+	}
+	message.WriteString("\r\n")
+	message.Write(body.Bytes())
+	return message.Bytes(), nil
+}
+
+// envelopeAddress lấy phần địa chỉ (bỏ tên hiển thị) cho lệnh MAIL FROM / dòng "From " của mbox
+func envelopeAddress(from string) string {
+	if address, err := mail.ParseAddress(from); err == nil {
+		return address.Address
+	}
+	return from
+}
+
+// FileMailer ghi email vào file mbox thay vì gửi đi, dùng ở dev/qc để xem lại nội dung mail
+type FileMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *FileMailer) Send(email Email) error {
+	now := time.Now()
+	message, err := buildMessage(m.From, email, now)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("không thể mở file mbox: %w", err)
+	}
+	defer file.Close()
+
+	// mboxrd: dòng bắt đầu bằng "From " (kể cả đã có ">") được thêm ">" để không bị hiểu là email mới
+	var entry bytes.Buffer
+	entry.WriteString("From " + envelopeAddress(m.From) + " " + now.UTC().Format(time.ANSIC) + "\n")
+	for _, line := range strings.Split(strings.ReplaceAll(string(message), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			entry.WriteString(">")
+		}
+		entry.WriteString(line + "\n")
+	}
+	entry.WriteString("\n")
+
+	_, err = file.Write(entry.Bytes())
+	return err
+}
+
+// SentEmail là email MemoryMailer đã nhận, kèm nội dung MIME đã dựng
+type SentEmail struct {
+	Email
+	Raw []byte
+}
+
+// MemoryMailer giữ email trong bộ nhớ để kiểm tra nội dung đã gửi
+type MemoryMailer struct {
+	From     string
+	mu       sync.Mutex
+	messages []SentEmail
+}
+
+func (m *MemoryMailer) Send(email Email) error {
+	from := m.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	message, err := buildMessage(from, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, SentEmail{Email: email, Raw: message})
+	return nil
+}
+
+// Messages trả về bản sao các email đã gửi
+func (m *MemoryMailer) Messages() []SentEmail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SentEmail(nil), m.messages...)
+}
+
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+)
+
+// Các loại thông báo trong hộp thư
+const (
+	NotificationOrderCreated       = "order.created"
+	NotificationOrderCancelled     = "order.cancelled"
+	NotificationWithdrawalApproved = "withdrawal.approved"
+	NotificationWithdrawalRejected = "withdrawal.rejected"
+	NotificationSalaryPaid         = "salary.paid"
+	NotificationBalanceCredited    = "balance.credited"
+)
+
+var ErrNotificationNotFound = errors.New("không tìm thấy thông báo")
+
+// NotificationInput là nội dung một thông báo, gửi giống nhau cho mọi người nhận
+type NotificationInput struct {
+	Type    string
+	Title   string
+	Body    string
+	Payload map[string]interface{}
+}
+
+// CreateNotifications ghi thông báo cho từng người nhận trong transaction tx (bỏ id 0 và id trùng).
+// Sau khi commit, gọi PublishNotifications để đẩy các thông báo trả về qua WebSocket.
+func CreateNotifications(tx *gorm.DB, recipients []uint, input NotificationInput) ([]models.Notification, error) {
+	payload := "{}"
+	if input.Payload != nil {
+		data, err := json.Marshal(input.Payload)
+		if err != nil {
+			return nil, err
+		}
+		payload = string(data)
+	}
+
+	seen := map[uint]bool{}
+	var notifications []models.Notification
+	for _, userID := range recipients {
+		if userID == 0 || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		notifications = append(notifications, models.Notification{
+			UserID:  userID,
+			Type:    input.Type,
+			Title:   input.Title,
+			Body:    input.Body,
+			Payload: payload,
+		})
+	}
+	if len(notifications) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Create(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+// PublishNotifications đẩy thông báo đã lưu tới các kết nối WebSocket của người nhận;
+// người đang offline sẽ thấy thông báo trong hộp thư khi quay lại
+func PublishNotifications(notifications []models.Notification) {
+	for _, notification := range notifications {
+		NotifyUser(notification.UserID, EventNotification, notification)
+	}
+}
+
+// OrderRecipients là những người nhận thông báo về một đơn: chủ chỗ ở, nhân viên quản lý đơn của chỗ ở
+// và khách đặt (guestID, có thể rỗng); bỏ qua người thực hiện thao tác (exclude)
+func OrderRecipients(tx *gorm.DB, accommodationID, ownerID uint, guestID *uint, exclude uint) ([]uint, error) {
+	staff, err := UsersWithPermission(tx, accommodationID, PermOrderManage)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := append([]uint{ownerID}, staff...)
+	if guestID != nil {
+		recipients = append(recipients, *guestID)
+	}
+
+	filtered := recipients[:0]
+	for _, userID := range recipients {
+		if userID != exclude {
+			filtered = append(filtered, userID)
+		}
+	}
+	return filtered, nil
+}
+
+// ListNotifications liệt kê thông báo của người dùng, mới nhất trước
+func ListNotifications(userID uint, unreadOnly bool, page, limit int) ([]models.Notification, int64, error) {
+	query := config.DB.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	notifications := []models.Notification{}
+	err := query.Order("id DESC").Offset(page * limit).Limit(limit).Find(&notifications).Error
+	return notifications, total, err
+}
+
+func UnreadNotificationCount(userID uint) (int64, error) {
+	var count int64
+	err := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).Error
+	return count, err
+}
+
+// MarkNotificationRead đánh dấu đã đọc một thông báo của chính người dùng; đã đọc rồi thì giữ nguyên thời điểm cũ
+func MarkNotificationRead(userID, notificationID uint) error {
+	result := config.DB.Model(&models.Notification{}).
+		Where("id = ? AND user_id = ?", notificationID, userID).
+		Update("read_at", gorm.Expr("COALESCE(read_at, ?)", time.Now()))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotificationNotFound
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead đánh dấu đã đọc mọi thông báo chưa đọc, trả về số thông báo được cập nhật
+func MarkAllNotificationsRead(userID uint) (int64, error) {
+	result := config.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOTPInvalid         = errors.New("Mã xác thực không hợp lệ")
+	ErrOTPExpired         = errors.New("Mã xác thực đã hết hạn. Vui lòng yêu cầu mã mới.")
+	ErrOTPTooManyAttempts = errors.New("Nhập sai mã quá nhiều lần. Vui lòng yêu cầu mã mới.")
+)
+
+// OTPMaxAttempts là số lần nhập sai tối đa của một mã
+const OTPMaxAttempts = 5
+
+// otpTTL là hạn dùng của mã theo mục đích
+var otpTTL = map[string]time.Duration{
+	models.OTPPurposeVerifyEmail:        15 * time.Minute,
+	models.OTPPurposeResetPassword:      10 * time.Minute,
+	models.OTPPurposeResetPasswordGrant: 10 * time.Minute,
+	models.OTPPurposeLogin:              5 * time.Minute,
+	models.OTPPurposeSensitiveAction:    5 * time.Minute,
+}
+
+// otpSecret là khóa HMAC băm mã, nhận từ cấu hình khi khởi động
+var otpSecret []byte
+
+func configureOTP(cfg config.SecurityConfig) {
+	otpSecret = []byte(cfg.OTPSecret.Value())
+}
+
+// hashOTP băm mã kèm user và mục đích bằng HMAC-SHA256, để mã 6 số không thể dò ngược từ DB
+func hashOTP(userID uint, purpose, code string) string {
+	mac := hmac.New(sha256.New, otpSecret)
+	mac.Write([]byte(fmt.Sprintf("%d:%s:%s", userID, purpose, code)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// storeOTP lưu mã mới cho (user, mục đích); các mã cũ chưa dùng của cùng mục đích bị vô hiệu
+func storeOTP(db *gorm.DB, userID uint, purpose, code string) error {
+	ttl, exists := otpTTL[purpose]
+	if !exists {
+		return fmt.Errorf("mục đích mã không hợp lệ: %s", purpose)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.OneTimeCode{}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+			Update("consumed_at", now).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.OneTimeCode{
+			UserID:      userID,
+			Purpose:     purpose,
+			CodeHash:    hashOTP(userID, purpose, code),
+			ExpiresAt:   now.Add(ttl),
+			MaxAttempts: OTPMaxAttempts,
+		}).Error
+	})
+}
+
+// IssueOTP tạo mã 6 số cho mục đích purpose và trả về mã gốc để gửi cho người dùng
+func IssueOTP(userID uint, purpose string) (string, error) {
+	return issueOTP(config.DB, userID, purpose)
+}
+
+// issueOTP giống IssueOTP nhưng ghi trong transaction db, để mã và email chứa mã được commit cùng nhau
+func issueOTP(db *gorm.DB, userID uint, purpose string) (string, error) {
+	code, err := generateVerificationCode()
+	if err != nil {
+		return "", fmt.Errorf("không thể tạo mã xác minh: %v", err)
+	}
+	if err := storeOTP(db, userID, purpose, code); err != nil {
+		return "", fmt.Errorf("không thể lưu mã xác minh: %v", err)
+	}
+	return code, nil
+}
+
+// IssueOTPToken giống IssueOTP nhưng dùng chuỗi ngẫu nhiên dài, cho mã không cần người dùng gõ tay
+func IssueOTPToken(userID uint, purpose string) (string, error) {
+	token, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	if err := storeOTP(config.DB, userID, purpose, token); err != nil {
+		return "", fmt.Errorf("không thể lưu mã xác minh: %v", err)
+	}
+	return token, nil
+}
+
+// ConsumeOTP kiểm tra mã mới nhất của (user, mục đích). Nhập sai sẽ tăng số lần thử;
+// đúng thì mã bị đánh dấu đã dùng và không thể dùng lại.
+func ConsumeOTP(userID uint, purpose, code string) error {
+	return ConsumeOTPWithFactor(userID, purpose, code, nil)
+}
+
+// ConsumeOTPWithFactor giống ConsumeOTP nhưng mã chỉ được dùng khi factor (bước xác thực thứ hai) cũng thành công.
+// factor lỗi được tính là một lần thử sai của mã.
+func ConsumeOTPWithFactor(userID uint, purpose, code string, factor func() error) error {
+	var result error
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var otp models.OneTimeCode
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND purpose = ? AND consumed_at IS NULL", userID, purpose).
+			Order("id DESC").
+			First(&otp).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				result = ErrOTPInvalid
+				return nil
+			}
+			return err
+		}
+
+		now := time.Now()
+		switch {
+		case now.After(otp.ExpiresAt):
+			result = ErrOTPExpired
+			return nil
+		case otp.Attempts >= otp.MaxAttempts:
+			result = ErrOTPTooManyAttempts
+			return nil
+		}
+
+		if !hmac.Equal([]byte(otp.CodeHash), []byte(hashOTP(userID, purpose, code))) {
+			result = ErrOTPInvalid
+			otp.Attempts++
+			if otp.Attempts >= otp.MaxAttempts {
+				result = ErrOTPTooManyAttempts
+			}
+			return tx.Model(&otp).Update("attempts", otp.Attempts).Error
+		}
+
+		if factor != nil {
+			if err := factor(); err != nil {
+				result = err
+				otp.Attempts++
+				return tx.Model(&otp).Update("attempts", otp.Attempts).Error
+			}
+		}
+
+		return tx.Model(&otp).Update("consumed_at", now).Error
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"new/config"
+	"new/models"
+)
+
+var (
+	ErrInvalidSignature      = errors.New("chữ ký webhook không hợp lệ")
+	ErrPaymentIntentNotFound = errors.New("không tìm thấy yêu cầu thanh toán")
+	ErrPaymentAmountMismatch = errors.New("số tiền thanh toán không khớp")
+	ErrPaymentEventDuplicate = errors.New("webhook đã được xử lý trước đó")
+)
+
+// PaymentCheckout là thông tin để đưa khách tới cổng thanh toán: đường dẫn chuyển hướng hoặc mã QR
+type PaymentCheckout struct {
+	URL    string `json:"url"`
+	QRCode string `json:"qrCode,omitempty"`
+}
+
+// PaymentEvent là kết quả thanh toán cổng gửi về qua webhook, đã được xác thực chữ ký
+type PaymentEvent struct {
+	EventID       string
+	IntentCode    string
+	ProviderTxnID string
+	Amount        float64
+	Success       bool
+	Reason        string
+	Payload       string
+}
+
+// PaymentProvider là một cổng thanh toán online (VNPay, MoMo...)
+type PaymentProvider interface {
+	Name() string
+	// Method là phương thức ghi vào sổ thanh toán của hóa đơn (models.PaymentMethodBank/Momo)
+	Method() int
+	CreateCheckout(intent models.PaymentIntent, returnURL, clientIP string) (PaymentCheckout, error)
+	// ParseWebhook đọc và xác thực chữ ký HMAC của callback, trả về ErrInvalidSignature nếu sai
+	ParseWebhook(r *http.Request) (PaymentEvent, error)
+	// Acknowledge trả về mã HTTP và nội dung phản hồi webhook theo định dạng cổng yêu cầu
+	Acknowledge(err error) (int, interface{})
+}
+
+var paymentProviders = map[string]PaymentProvider{}
+
+// RegisterPaymentProvider đăng ký (hoặc thay thế) một cổng thanh toán theo Name()
+func RegisterPaymentProvider(provider PaymentProvider) {
+	paymentProviders[provider.Name()] = provider
+}
+
+func GetPaymentProvider(name string) (PaymentProvider, bool) {
+	provider, exists := paymentProviders[name]
+	return provider, exists
+}
+
+// InitPaymentProviders đăng ký các cổng thanh toán có trong cấu hình.
+// Cổng giả lập (fake) chỉ được đăng ký khi đặt PAYMENT_FAKE_SECRET, dùng để chạy thử toàn bộ luồng mà không cần mạng.
+func InitPaymentProviders(cfg config.PaymentConfig) {
+	if cfg.VNPayTmnCode != "" && cfg.VNPayHashSecret != "" {
+		RegisterPaymentProvider(&VNPayProvider{TmnCode: cfg.VNPayTmnCode, HashSecret: cfg.VNPayHashSecret.Value(), PayURL: cfg.VNPayPayURL})
+	}
+
+	if cfg.FakeSecret != "" {
+		RegisterPaymentProvider(&FakePaymentProvider{Secret: cfg.FakeSecret.Value()})
+	}
+
+	names := make([]string, 0, len(paymentProviders))
+	for name := range paymentProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	log.Printf("Cổng thanh toán đã đăng ký: %s\n", strings.Join(names, ", "))
+}
+
+func hmacHex(hashFunc func() hash.Hash, secret string, data []byte) string {
+	mac := hmac.New(hashFunc, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// FakePaymentProvider là cổng thanh toán giả lập: webhook là JSON ký HMAC-SHA256 trong header X-Fake-Signature
+type FakePaymentProvider struct {
+	Secret string
+}
+
+type fakeWebhookBody struct {
+	EventID    string  `json:"eventId"`
+	IntentCode string  `json:"intentCode"`
+	TxnID      string  `json:"txnId"`
+	Amount     float64 `json:"amount"`
+	Status     string  `json:"status"` // success | failed
+}
+
+func (p *FakePaymentProvider) Name() string { return "fake" }
+
+func (p *FakePaymentProvider) Method() int { return models.PaymentMethodBank }
+
+func (p *FakePaymentProvider) CreateCheckout(intent models.PaymentIntent, returnURL, clientIP string) (PaymentCheckout, error) {
+	checkoutURL := fmt.Sprintf("/api/v1/payments/fake/checkout/%s", intent.Code)
+	if returnURL != "" {
+		checkoutURL += "?returnUrl=" + url.QueryEscape(returnURL)
+	}
+	return PaymentCheckout{URL: checkoutURL, QRCode: "FAKEPAY|" + intent.Code + "|" + strconv.FormatFloat(intent.Amount, 'f', 0, 64)}, nil
+}
+
+// Sign ký nội dung webhook giả lập, dùng cho trang thanh toán giả và khi chạy thử
+func (p *FakePaymentProvider) Sign(body []byte) string {
+	return hmacHex(sha256.New, p.Secret, body)
+}
+
+// SignedWebhook tạo request webhook đã ký cho một kết quả thanh toán giả lập
+func (p *FakePaymentProvider) SignedWebhook(intent models.PaymentIntent, success bool) (*http.Request, error) {
+	status := "failed"
+	if success {
+		status = "success"
+	}
+	txnID := fmt.Sprintf("FAKE%d", time.Now().UnixNano())
+	body, err := json.Marshal(fakeWebhookBody{
+		EventID:    txnID,
+		IntentCode: intent.Code,
+		TxnID:      txnID,
+		Amount:     intent.Amount,
+		Status:     status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/api/v1/payments/webhook/fake", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Fake-Signature", p.Sign(body))
+	return req, nil
+}
+
+func (p *FakePaymentProvider) ParseWebhook(r *http.Request) (PaymentEvent, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return PaymentEvent{}, err
+	}
+
+	expected := p.Sign(body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get("X-Fake-Signature"))) {
+		return PaymentEvent{}, ErrInvalidSignature
+	}
+
+	var payload fakeWebhookBody
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return PaymentEvent{}, fmt.Errorf("nội dung webhook không hợp lệ: %w", err)
+	}
+
+	return PaymentEvent{
+		EventID:       payload.EventID,
+		IntentCode:    payload.IntentCode,
+		ProviderTxnID: payload.TxnID,
+		Amount:        payload.Amount,
+		Success:       payload.Status == "success",
+		Reason:        payload.Status,
+		Payload:       string(body),
+	}, nil
+}
+
+func (p *FakePaymentProvider) Acknowledge(err error) (int, interface{}) {
+	switch {
+	case err == nil, errors.Is(err, ErrPaymentEventDuplicate):
+		return http.StatusOK, map[string]interface{}{"code": 1, "mess": "ok"}
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusUnauthorized, map[string]interface{}{"code": 0, "mess": err.Error()}
+	case errors.Is(err, ErrPaymentIntentNotFound), errors.Is(err, ErrPaymentAmountMismatch):
+		return http.StatusBadRequest, map[string]interface{}{"code": 0, "mess": err.Error()}
+	default:
+		return http.StatusInternalServerError, map[string]interface{}{"code": 0, "mess": err.Error()}
+	}
+}
+
+// VNPayProvider tạo link thanh toán VNPay và nhận IPN, chữ ký HMAC-SHA512 trên các tham số vnp_ đã sắp xếp
+type VNPayProvider struct {
+	TmnCode    string
+	HashSecret string
+	PayURL     string
+}
+
+func (p *VNPayProvider) Name() string { return "vnpay" }
+
+func (p *VNPayProvider) Method() int { return models.PaymentMethodBank }
+
+// vnpayQuery nối các tham số theo thứ tự khóa tăng dần, đúng chuỗi VNPay dùng để ký
+func vnpayQuery(params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(params.Get(key)))
+	}
+	return strings.Join(parts, "&")
+}
+
+func (p *VNPayProvider) CreateCheckout(intent models.PaymentIntent, returnURL, clientIP string) (PaymentCheckout, error) {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		loc = time.FixedZone("ICT", 7*60*60)
+	}
+
+	params := url.Values{}
+	params.Set("vnp_Version", "2.1.0")
+	params.Set("vnp_Command", "pay")
+	params.Set("vnp_TmnCode", p.TmnCode)
+	params.Set("vnp_Amount", strconv.FormatInt(int64(intent.Amount*100), 10))
+	params.Set("vnp_CurrCode", "VND")
+	params.Set("vnp_TxnRef", intent.Code)
+	params.Set("vnp_OrderInfo", fmt.Sprintf("Thanh toan don hang %d", intent.OrderID))
+	params.Set("vnp_OrderType", "other")
+	params.Set("vnp_Locale", "vn")
+	params.Set("vnp_ReturnUrl", returnURL)
+	params.Set("vnp_IpAddr", clientIP)
+	params.Set("vnp_CreateDate", time.Now().In(loc).Format("20060102150405"))
+	params.Set("vnp_ExpireDate", intent.ExpiresAt.In(loc).Format("20060102150405"))
+
+	query := vnpayQuery(params)
+	signature := hmacHex(sha512.New, p.HashSecret, []byte(query))
+	return PaymentCheckout{URL: p.PayURL + "?" + query + "&vnp_SecureHash=" + signature}, nil
+}
+
+func (p *VNPayProvider) ParseWebhook(r *http.Request) (PaymentEvent, error) {
+	query := r.URL.Query()
+	signature := query.Get("vnp_SecureHash")
+
+	params := url.Values{}
+	for key, values := range query {
+		if strings.HasPrefix(key, "vnp_") && key != "vnp_SecureHash" && key != "vnp_SecureHashType" && len(values) > 0 {
+			params.Set(key, values[0])
+		}
+	}
+
+	expected := hmacHex(sha512.New, p.HashSecret, []byte(vnpayQuery(params)))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(signature))) {
+		return PaymentEvent{}, ErrInvalidSignature
+	}
+
+	amount, _ := strconv.ParseFloat(params.Get("vnp_Amount"), 64)
+	responseCode := params.Get("vnp_ResponseCode")
+	return PaymentEvent{
+		EventID:       params.Get("vnp_TxnRef") + ":" + params.Get("vnp_TransactionNo"),
+		IntentCode:    params.Get("vnp_TxnRef"),
+		ProviderTxnID: params.Get("vnp_TransactionNo"),
+		Amount:        amount / 100,
+		Success:       responseCode == "00" && params.Get("vnp_TransactionStatus") == "00",
+		Reason:        responseCode,
+		Payload:       r.URL.RawQuery,
+	}, nil
+}
+
+func (p *VNPayProvider) Acknowledge(err error) (int, interface{}) {
+	switch {
+	case err == nil:
+		return http.StatusOK, map[string]string{"RspCode": "00", "Message": "Confirm Success"}
+	case errors.Is(err, ErrPaymentEventDuplicate):
+		return http.StatusOK, map[string]string{"RspCode": "02", "Message": "Order already confirmed"}
+	case errors.Is(err, ErrInvalidSignature):
+		return http.StatusOK, map[string]string{"RspCode": "97", "Message": "Invalid Checksum"}
+	case errors.Is(err, ErrPaymentIntentNotFound):
+		return http.StatusOK, map[string]string{"RspCode": "01", "Message": "Order not found"}
+	case errors.Is(err, ErrPaymentAmountMismatch):
+		return http.StatusOK, map[string]string{"RspCode": "04", "Message": "Invalid amount"}
+	default:
+		return http.StatusOK, map[string]string{"RspCode": "99", "Message": "Unknown error"}
+	}
+}
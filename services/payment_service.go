@@ -0,0 +1,257 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PaymentIntentDuration là thời gian khách có để hoàn tất thanh toán online
+const PaymentIntentDuration = 15 * time.Minute
+
+// PaymentAmountDue trả về số tiền còn phải thanh toán của đơn: phần còn lại của hóa đơn nếu đã có, ngược lại là tổng tiền đơn
+func PaymentAmountDue(tx *gorm.DB, order models.Order) (float64, error) {
+	var invoice models.Invoice
+	err := tx.Where("order_id = ?", order.ID).First(&invoice).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return order.TotalPrice, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if invoice.Status == 2 {
+		return 0, nil
+	}
+	return invoice.RemainingAmount, nil
+}
+
+// CreatePaymentIntent tạo yêu cầu thanh toán online cho đơn và lấy link/QR từ cổng thanh toán
+func CreatePaymentIntent(order models.Order, provider PaymentProvider, userID *uint, returnURL, clientIP string) (*models.PaymentIntent, error) {
+	if order.Status == 2 {
+		return nil, errors.New("đơn hàng đã bị hủy")
+	}
+
+	amount, err := PaymentAmountDue(config.DB, order)
+	if err != nil {
+		return nil, fmt.Errorf("không thể tính số tiền cần thanh toán: %w", err)
+	}
+	if amount <= 0 {
+		return nil, errors.New("đơn hàng đã được thanh toán đủ")
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(PaymentIntentDuration)
+	// Đơn đang giữ chỗ thì không cho thanh toán sau khi hết hạn giữ chỗ
+	if order.Status == 0 && order.HoldExpiresAt != nil && order.HoldExpiresAt.Before(expiresAt) {
+		expiresAt = *order.HoldExpiresAt
+	}
+	if !expiresAt.After(now) {
+		return nil, errors.New("đơn hàng đã hết hạn giữ chỗ")
+	}
+
+	intent := models.PaymentIntent{
+		Code:      fmt.Sprintf("PI%dT%d", order.ID, now.UnixNano()),
+		OrderID:   order.ID,
+		UserID:    userID,
+		Provider:  provider.Name(),
+		Amount:    math.Round(amount),
+		Status:    models.IntentPending,
+		ExpiresAt: expiresAt,
+	}
+
+	checkout, err := provider.CreateCheckout(intent, returnURL, clientIP)
+	if err != nil {
+		return nil, fmt.Errorf("không thể tạo thanh toán với cổng %s: %w", provider.Name(), err)
+	}
+	intent.PaymentURL = checkout.URL
+	intent.QRCode = checkout.QRCode
+
+	// Mỗi đơn chỉ có một yêu cầu đang chờ: các yêu cầu cũ hết hiệu lực để khách không thanh toán hai lần
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PaymentIntent{}).
+			Where("order_id = ? AND status = ?", order.ID, models.IntentPending).
+			Update("status", models.IntentExpired).Error; err != nil {
+			return err
+		}
+		return tx.Create(&intent).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("không thể lưu yêu cầu thanh toán: %w", err)
+	}
+	return &intent, nil
+}
+
+// HandlePaymentEvent xử lý kết quả thanh toán từ webhook đã xác thực chữ ký.
+// Mỗi (cổng, EventID) chỉ được xử lý một lần; thanh toán thành công sẽ xác nhận đơn đang chờ
+// và ghi khoản thu vào sổ thanh toán của hóa đơn trong cùng transaction.
+func HandlePaymentEvent(provider PaymentProvider, event PaymentEvent) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		record := models.PaymentWebhookEvent{
+			Provider: provider.Name(),
+			EventID:  event.EventID,
+			Payload:  event.Payload,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrPaymentEventDuplicate
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code = ? AND provider = ?", event.IntentCode, provider.Name()).
+			First(&intent).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPaymentIntentNotFound
+			}
+			return err
+		}
+		if err := tx.Model(&record).Update("intent_id", intent.ID).Error; err != nil {
+			return err
+		}
+
+		// Yêu cầu đã có kết quả cuối từ một callback khác; vẫn nhận tiền nếu cổng báo thành công sau khi hết hạn
+		if intent.Status != models.IntentPending && !(intent.Status == models.IntentExpired && event.Success) {
+			return nil
+		}
+
+		if !event.Success {
+			return tx.Model(&intent).Updates(map[string]interface{}{
+				"status":         models.IntentFailed,
+				"failure_reason": event.Reason,
+			}).Error
+		}
+
+		if math.Abs(event.Amount-intent.Amount) >= 1 {
+			return ErrPaymentAmountMismatch
+		}
+
+		now := time.Now()
+		previousStatus := intent.Status
+		intent.Status = models.IntentSucceeded
+		intent.ProviderTxnID = event.ProviderTxnID
+		intent.PaidAt = &now
+
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Room").First(&order, intent.OrderID).Error; err != nil {
+			return err
+		}
+
+		// Tiền đã về nhưng không ghi nhận được vào đơn, để lại cho quản trị hoàn tiền
+		orphan := func(reason string) error {
+			intent.Status = models.IntentOrphaned
+			intent.FailureReason = reason
+			log.Printf("⚠️ Thanh toán %s cho đơn %d không xác nhận được (%s), cần hoàn tiền thủ công\n", intent.Code, order.ID, reason)
+			if err := tx.Save(&intent).Error; err != nil {
+				return err
+			}
+			return RecordAudit(tx, AuditActor{}, AuditEntry{
+				Action:          AuditPaymentIntentOrphan,
+				EntityType:      "payment_intent",
+				EntityID:        intent.ID,
+				AccommodationID: &order.AccommodationID,
+				Before:          map[string]interface{}{"status": previousStatus},
+				After: map[string]interface{}{
+					"status":        intent.Status,
+					"amount":        intent.Amount,
+					"provider":      intent.Provider,
+					"providerTxnId": intent.ProviderTxnID,
+					"reason":        reason,
+				},
+			})
+		}
+
+		if order.Status == 2 {
+			return orphan("Đơn hàng đã bị hủy trước khi nhận được thanh toán")
+		}
+
+		var invoice *models.Invoice
+		if order.Status == 0 {
+			var accommodation models.Accommodation
+			if err := tx.First(&accommodation, order.AccommodationID).Error; err != nil {
+				return err
+			}
+			// Giữ chỗ hết hạn thì lịch có thể đã thuộc đơn khác: ConfirmOrder trả về ErrHoldExpired
+			// trước khi ghi gì nên vẫn ghi nhận tiền về được trong cùng transaction
+			created, err := ConfirmOrder(tx, &order, accommodation.UserID)
+			if errors.Is(err, ErrHoldExpired) {
+				return orphan("Giữ chỗ đã hết hạn trước khi nhận được thanh toán")
+			}
+			if err != nil {
+				return err
+			}
+			invoice = created
+		} else {
+			var invoiceID uint
+			if err := tx.Model(&models.Invoice{}).Where("order_id = ?", order.ID).Pluck("id", &invoiceID).Error; err != nil {
+				return err
+			}
+			locked, err := LockInvoice(tx, invoiceID)
+			if err != nil {
+				return err
+			}
+			invoice = locked
+		}
+
+		// Hóa đơn đã được thu (yêu cầu khác hoặc nhân viên ghi nhận tay) thì không ghi thêm để tránh thu vượt
+		if intent.Amount-invoice.RemainingAmount >= 1 {
+			return orphan("Số tiền vượt quá phần còn lại của hóa đơn")
+		}
+
+		// Số tiền của yêu cầu được làm tròn nên có thể lệch dưới 1 đồng so với phần còn lại
+		payment := models.InvoicePayment{
+			Amount: math.Min(intent.Amount, invoice.RemainingAmount),
+			Method: provider.Method(),
+			PaidAt: now,
+			Note:   fmt.Sprintf("Thanh toán online %s, mã giao dịch %s", provider.Name(), event.ProviderTxnID),
+		}
+		before := InvoiceAuditSnapshot(invoice)
+		if err := RecordInvoicePayment(tx, invoice, &payment); err != nil {
+			return err
+		}
+		after := InvoiceAuditSnapshot(invoice)
+		after["paymentId"] = payment.ID
+		after["amount"] = payment.Amount
+		after["intentCode"] = intent.Code
+		after["providerTxnId"] = intent.ProviderTxnID
+		if err := RecordInvoiceAudit(tx, AuditActor{}, invoice, AuditEntry{
+			Action:     AuditInvoicePaymentRecord,
+			EntityType: "invoice",
+			EntityID:   invoice.ID,
+			Before:     before,
+			After:      after,
+		}); err != nil {
+			return err
+		}
+
+		return tx.Save(&intent).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ClearBookingCaches()
+	return &intent, nil
+}
+
+// ExpirePaymentIntents đánh dấu hết hạn các yêu cầu thanh toán chưa có kết quả
+func ExpirePaymentIntents() error {
+	result := config.DB.Model(&models.PaymentIntent{}).
+		Where("status = ? AND expires_at < ?", models.IntentPending, time.Now()).
+		Update("status", models.IntentExpired)
+	if result.Error != nil {
+		log.Println("❌ Lỗi khi đánh dấu thanh toán hết hạn:", result.Error)
+		return result.Error
+	}
+	return nil
+}
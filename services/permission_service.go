@@ -0,0 +1,521 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quyền thao tác trên một chỗ ở. Chủ chỗ ở và superadmin có mọi quyền,
+// nhân viên có các quyền của vai trò được giao trên từng chỗ ở.
+const (
+	PermAccommodationView   = "accommodation.view"   // Xem chỗ ở, phòng, đơn, hóa đơn
+	PermAccommodationEdit   = "accommodation.edit"   // Sửa thông tin, chính sách hủy của chỗ ở
+	PermAccommodationStatus = "accommodation.status" // Đổi trạng thái chỗ ở
+	PermRoomEdit            = "room.edit"            // Thêm, sửa phòng
+	PermRoomStatus          = "room.status"          // Đổi trạng thái phòng
+	PermOrderManage         = "order.manage"         // Xác nhận, hủy, sửa đơn
+	PermInvoicePayment      = "invoice.payment"      // Ghi nhận thanh toán hóa đơn
+	PermRevenueView         = "revenue.view"         // Xem doanh thu
+	PermAuditView           = "audit.view"           // Xem nhật ký kiểm toán
+	PermStaffManage         = "staff.manage"         // Giao, thu hồi vai trò của nhân viên
+)
+
+// Vai trò hệ thống
+const (
+	RoleReceptionist = "receptionist"
+	RoleManager      = "manager"
+)
+
+var (
+	ErrUnknownPermission = errors.New("Quyền không hợp lệ")
+	ErrRoleNotFound      = errors.New("Vai trò không tồn tại")
+	ErrSystemRole        = errors.New("Không thể sửa hoặc xóa vai trò hệ thống")
+	ErrAssignmentDenied  = errors.New("Không thể giao vai trò cho người dùng này trên chỗ ở này")
+)
+
+var permissionCatalog = []models.Permission{
+	{Code: PermAccommodationView, Description: "Xem chỗ ở, phòng, đơn đặt và hóa đơn"},
+	{Code: PermAccommodationEdit, Description: "Sửa thông tin và chính sách hủy của chỗ ở"},
+	{Code: PermAccommodationStatus, Description: "Đổi trạng thái chỗ ở"},
+	{Code: PermRoomEdit, Description: "Thêm và sửa phòng"},
+	{Code: PermRoomStatus, Description: "Đổi trạng thái phòng"},
+	{Code: PermOrderManage, Description: "Xác nhận, hủy và sửa đơn đặt"},
+	{Code: PermInvoicePayment, Description: "Ghi nhận thanh toán hóa đơn"},
+	{Code: PermRevenueView, Description: "Xem doanh thu"},
+	{Code: PermAuditView, Description: "Xem nhật ký kiểm toán"},
+	{Code: PermStaffManage, Description: "Giao và thu hồi vai trò của nhân viên"},
+}
+
+// systemRoles: lễ tân giữ đúng các quyền trước đây của role 3, quản lý có thêm quyền sửa phòng và xem doanh thu
+var systemRoles = []struct {
+	Name        string
+	Description string
+	Permissions []string
+}{
+	{
+		Name:        RoleReceptionist,
+		Description: "Lễ tân",
+		Permissions: []string{PermAccommodationView, PermAccommodationStatus, PermRoomStatus, PermOrderManage, PermInvoicePayment},
+	},
+	{
+		Name:        RoleManager,
+		Description: "Quản lý",
+		Permissions: []string{PermAccommodationView, PermAccommodationEdit, PermAccommodationStatus, PermRoomEdit, PermRoomStatus,
+			PermOrderManage, PermInvoicePayment, PermRevenueView, PermAuditView},
+	},
+}
+
+func IsPermission(code string) bool {
+	for _, permission := range permissionCatalog {
+		if permission.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// SeedRBAC tạo danh mục quyền, vai trò hệ thống và chuyển User.AccommodationIDs cũ sang bảng giao vai trò.
+// Chạy mỗi lần khởi động, không làm gì nếu dữ liệu đã đúng.
+func SeedRBAC() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for _, item := range permissionCatalog {
+			permission := item
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "code"}},
+				DoUpdates: clause.AssignmentColumns([]string{"description"}),
+			}).Create(&permission).Error; err != nil {
+				return fmt.Errorf("không thể tạo quyền %s: %w", item.Code, err)
+			}
+		}
+
+		for _, definition := range systemRoles {
+			var role models.Role
+			if err := tx.Where(models.Role{Name: definition.Name, System: true}).
+				Attrs(models.Role{Description: definition.Description}).
+				FirstOrCreate(&role).Error; err != nil {
+				return fmt.Errorf("không thể tạo vai trò %s: %w", definition.Name, err)
+			}
+
+			var permissions []models.Permission
+			if err := tx.Where("code IN ?", definition.Permissions).Find(&permissions).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&role).Association("Permissions").Replace(permissions); err != nil {
+				return fmt.Errorf("không thể gán quyền cho vai trò %s: %w", definition.Name, err)
+			}
+		}
+
+		return migrateLegacyAccommodationIDs(tx)
+	})
+}
+
+// migrateLegacyAccommodationIDs giao vai trò lễ tân trên từng chỗ ở trong cột accommodation_ids cũ của role 3.
+// Cột cũ được giữ nguyên (không còn được đọc hay ghi) để có thể quay lại phiên bản trước;
+// việc xóa cột để cho một migration riêng, chạy chủ động sau khi đã kiểm tra dữ liệu.
+// Chỉ chạy khi chưa có lần giao vai trò lễ tân nào, để lần khởi động sau không giao lại chỗ ở đã bị thu hồi.
+func migrateLegacyAccommodationIDs(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&models.User{}, "accommodation_ids") {
+		return nil
+	}
+
+	var receptionist models.Role
+	if err := tx.Where("name = ? AND system = ?", RoleReceptionist, true).First(&receptionist).Error; err != nil {
+		return err
+	}
+
+	var migrated int64
+	if err := tx.Model(&models.RoleAssignment{}).Where("role_id = ?", receptionist.ID).Count(&migrated).Error; err != nil {
+		return err
+	}
+	if migrated > 0 {
+		return nil
+	}
+
+	result := tx.Exec(`
+		INSERT INTO role_assignments (user_id, role_id, accommodation_id, created_at)
+		SELECT DISTINCT u.id, ?, a.id, NOW()
+		FROM users u
+		CROSS JOIN LATERAL unnest(u.accommodation_ids) AS legacy(accommodation_id)
+		JOIN accommodations a ON a.id = legacy.accommodation_id
+		WHERE u.role = 3
+		ON CONFLICT DO NOTHING`, receptionist.ID)
+	if result.Error != nil {
+		return fmt.Errorf("không thể chuyển accommodation_ids sang role_assignments: %w", result.Error)
+	}
+	log.Printf("Đã chuyển %d chỗ ở được giao của lễ tân sang bảng giao vai trò\n", result.RowsAffected)
+	return nil
+}
+
+// assignmentsWithPermission là truy vấn các lần giao vai trò của userID có quyền permission
+func assignmentsWithPermission(userID uint, permission string) *gorm.DB {
+	return config.DB.Table("role_assignments").
+		Joins("JOIN role_permissions ON role_permissions.role_id = role_assignments.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("role_assignments.user_id = ? AND permissions.code = ?", userID, permission)
+}
+
+// Can là điểm kiểm tra quyền duy nhất cho middleware và handler:
+// superadmin có mọi quyền, chủ chỗ ở có mọi quyền trên chỗ ở của mình,
+// người khác cần được giao vai trò có permission trên đúng chỗ ở đó.
+// accommodationID 0 là phạm vi toàn hệ thống (dữ liệu chung, không lọc theo chỗ ở), chỉ superadmin có.
+func Can(userID uint, role int, permission string, accommodationID uint) bool {
+	if role == 1 {
+		return true
+	}
+	if accommodationID == 0 {
+		return false
+	}
+
+	var count int64
+	if err := config.DB.Model(&models.Accommodation{}).
+		Where("id = ? AND user_id = ?", accommodationID, userID).
+		Count(&count).Error; err == nil && count > 0 {
+		return true
+	}
+
+	if err := assignmentsWithPermission(userID, permission).
+		Where("role_assignments.accommodation_id = ?", accommodationID).
+		Count(&count).Error; err != nil {
+		log.Println("Error checking permission:", err)
+		return false
+	}
+	return count > 0
+}
+
+// CanAny cho biết người dùng có permission trên ít nhất một chỗ ở (admin luôn có trên chỗ ở của mình)
+func CanAny(userID uint, role int, permission string) bool {
+	if role == 1 || role == 2 {
+		return true
+	}
+	var count int64
+	if err := assignmentsWithPermission(userID, permission).Count(&count).Error; err != nil {
+		log.Println("Error checking permission:", err)
+		return false
+	}
+	return count > 0
+}
+
+// PermittedAccommodations là subquery id các chỗ ở mà người dùng có permission (sở hữu hoặc được giao),
+// dùng để lọc danh sách; superadmin không cần lọc
+func PermittedAccommodations(userID uint, permission string) *gorm.DB {
+	assigned := assignmentsWithPermission(userID, permission).Select("role_assignments.accommodation_id")
+	return config.DB.Model(&models.Accommodation{}).
+		Select("id").
+		Where("user_id = ? OR id IN (?)", userID, assigned)
+}
+
+// UsersWithPermission trả về các nhân viên được giao vai trò có permission trên một chỗ ở (không gồm chủ)
+func UsersWithPermission(db *gorm.DB, accommodationID uint, permission string) ([]uint, error) {
+	var userIDs []uint
+	err := db.Table("role_assignments").
+		Joins("JOIN role_permissions ON role_permissions.role_id = role_assignments.role_id").
+		Joins("JOIN permissions ON permissions.id = role_permissions.permission_id").
+		Where("role_assignments.accommodation_id = ? AND permissions.code = ?", accommodationID, permission).
+		Distinct().
+		Pluck("role_assignments.user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// AssignedAccommodationIDs trả về các chỗ ở người dùng được giao vai trò (thay cho User.AccommodationIDs)
+func AssignedAccommodationIDs(userID uint) ([]int64, error) {
+	ids := []int64{}
+	err := config.DB.Model(&models.RoleAssignment{}).
+		Distinct("accommodation_id").
+		Where("user_id = ?", userID).
+		Order("accommodation_id").
+		Pluck("accommodation_id", &ids).Error
+	return ids, err
+}
+
+// AccommodationPermissions là các quyền người dùng có trên một chỗ ở
+type AccommodationPermissions struct {
+	AccommodationID uint     `json:"accommodationId"`
+	Roles           []string `json:"roles"`
+	Permissions     []string `json:"permissions"`
+}
+
+// EffectivePermissions gom vai trò và quyền được giao theo từng chỗ ở
+func EffectivePermissions(userID uint) ([]AccommodationPermissions, error) {
+	var assignments []models.RoleAssignment
+	if err := config.DB.Preload("Role.Permissions").
+		Where("user_id = ?", userID).
+		Order("accommodation_id").
+		Find(&assignments).Error; err != nil {
+		return nil, err
+	}
+
+	result := []AccommodationPermissions{}
+	index := map[uint]int{}
+	for _, assignment := range assignments {
+		position, exists := index[assignment.AccommodationID]
+		if !exists {
+			position = len(result)
+			index[assignment.AccommodationID] = position
+			result = append(result, AccommodationPermissions{AccommodationID: assignment.AccommodationID, Roles: []string{}, Permissions: []string{}})
+		}
+		entry := &result[position]
+		entry.Roles = append(entry.Roles, assignment.Role.Name)
+		for _, permission := range assignment.Role.Permissions {
+			if !containsString(entry.Permissions, permission.Code) {
+				entry.Permissions = append(entry.Permissions, permission.Code)
+			}
+		}
+	}
+	return result, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// ListRoles trả về vai trò hệ thống và vai trò tự tạo của admin (superadmin thấy tất cả)
+func ListRoles(userID uint, role int) ([]models.Role, error) {
+	var roles []models.Role
+	query := config.DB.Preload("Permissions").Order("system DESC, id")
+	if role != 1 {
+		query = query.Where("system = ? OR owner_id = ?", true, userID)
+	}
+	err := query.Find(&roles).Error
+	return roles, err
+}
+
+func loadPermissions(tx *gorm.DB, codes []string) ([]models.Permission, error) {
+	for _, code := range codes {
+		if !IsPermission(code) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownPermission, code)
+		}
+	}
+	var permissions []models.Permission
+	if err := tx.Where("code IN ?", codes).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// loadManagedRole lấy vai trò tự tạo mà người dùng được sửa (superadmin sửa mọi vai trò không phải hệ thống)
+func loadManagedRole(tx *gorm.DB, userID uint, role int, roleID uint) (models.Role, error) {
+	var target models.Role
+	if err := tx.First(&target, roleID).Error; err != nil {
+		return target, ErrRoleNotFound
+	}
+	if target.System {
+		return target, ErrSystemRole
+	}
+	if role != 1 && (target.OwnerID == nil || *target.OwnerID != userID) {
+		return target, ErrRoleNotFound
+	}
+	return target, nil
+}
+
+// SaveRole tạo (roleID = 0) hoặc cập nhật vai trò tự tạo với danh sách quyền
+func SaveRole(userID uint, role int, roleID uint, name, description string, permissionCodes []string) (models.Role, error) {
+	var saved models.Role
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		permissions, err := loadPermissions(tx, permissionCodes)
+		if err != nil {
+			return err
+		}
+
+		if roleID == 0 {
+			ownerID := userID
+			saved = models.Role{Name: name, Description: description, OwnerID: &ownerID}
+			if err := tx.Create(&saved).Error; err != nil {
+				return err
+			}
+		} else {
+			saved, err = loadManagedRole(tx, userID, role, roleID)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&saved).Updates(map[string]interface{}{"name": name, "description": description}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&saved).Association("Permissions").Replace(permissions); err != nil {
+			return err
+		}
+		return tx.Preload("Permissions").First(&saved, saved.ID).Error
+	})
+	if err == nil && roleID != 0 {
+		clearAssignedStaffCache(config.DB.Model(&models.RoleAssignment{}).Where("role_id = ?", roleID))
+	}
+	return saved, err
+}
+
+// DeleteRole xóa vai trò tự tạo cùng các lần giao vai trò đó
+func DeleteRole(userID uint, role int, roleID uint) error {
+	var affected []uint
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		target, err := loadManagedRole(tx, userID, role, roleID)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RoleAssignment{}).Where("role_id = ?", target.ID).Distinct("user_id").Pluck("user_id", &affected).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("role_id = ?", target.ID).Delete(&models.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&target).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&target).Error
+	})
+	if err == nil {
+		clearStaffCache(affected...)
+	}
+	return err
+}
+
+// AssignRole giao vai trò cho nhân viên trên một chỗ ở. Người giao cần quyền staff.manage trên chỗ ở,
+// nhân viên phải là lễ tân thuộc chủ của chỗ ở, vai trò là vai trò hệ thống hoặc do chủ chỗ ở tạo.
+func AssignRole(actorID uint, actorRole int, userID, roleID, accommodationID uint) (models.RoleAssignment, error) {
+	var assignment models.RoleAssignment
+	if !Can(actorID, actorRole, PermStaffManage, accommodationID) {
+		return assignment, ErrAssignmentDenied
+	}
+
+	var accommodation models.Accommodation
+	if err := config.DB.Select("id", "user_id").First(&accommodation, accommodationID).Error; err != nil {
+		return assignment, ErrAssignmentDenied
+	}
+
+	var user models.User
+	if err := config.DB.Select("id", "role", "admin_id").First(&user, userID).Error; err != nil {
+		return assignment, ErrAssignmentDenied
+	}
+	if user.Role != 3 || user.AdminId == nil || *user.AdminId != accommodation.UserID {
+		return assignment, ErrAssignmentDenied
+	}
+
+	var target models.Role
+	if err := config.DB.First(&target, roleID).Error; err != nil {
+		return assignment, ErrRoleNotFound
+	}
+	if !target.System && (target.OwnerID == nil || *target.OwnerID != accommodation.UserID) {
+		return assignment, ErrRoleNotFound
+	}
+
+	assignment = models.RoleAssignment{
+		UserID:          userID,
+		RoleID:          roleID,
+		AccommodationID: accommodationID,
+		AssignedBy:      &actorID,
+	}
+	if err := config.DB.Where(models.RoleAssignment{UserID: userID, RoleID: roleID, AccommodationID: accommodationID}).
+		Attrs(models.RoleAssignment{AssignedBy: &actorID}).
+		FirstOrCreate(&assignment).Error; err != nil {
+		return assignment, err
+	}
+	assignment.Role = target
+
+	clearStaffCache(userID)
+	return assignment, nil
+}
+
+// UnassignRole thu hồi một lần giao vai trò, người thu hồi cần quyền staff.manage trên chỗ ở đó
+func UnassignRole(actorID uint, actorRole int, assignmentID uint) error {
+	var assignment models.RoleAssignment
+	if err := config.DB.First(&assignment, assignmentID).Error; err != nil {
+		return ErrRoleNotFound
+	}
+	if !Can(actorID, actorRole, PermStaffManage, assignment.AccommodationID) {
+		return ErrAssignmentDenied
+	}
+	if err := config.DB.Delete(&assignment).Error; err != nil {
+		return err
+	}
+
+	clearStaffCache(assignment.UserID)
+	return nil
+}
+
+// ReplaceAccommodationAssignments giao vai trò roleName cho nhân viên trên đúng danh sách chỗ ở,
+// thu hồi vai trò đó ở các chỗ ở khác (thay cho việc ghi đè User.AccommodationIDs)
+func ReplaceAccommodationAssignments(actorID, userID uint, roleName string, accommodationIDs []int64) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var target models.Role
+		if err := tx.Where("name = ? AND system = ?", roleName, true).First(&target).Error; err != nil {
+			return ErrRoleNotFound
+		}
+
+		if err := tx.Where("user_id = ? AND role_id = ?", userID, target.ID).Delete(&models.RoleAssignment{}).Error; err != nil {
+			return err
+		}
+		seen := map[int64]bool{}
+		for _, accommodationID := range accommodationIDs {
+			if seen[accommodationID] {
+				continue
+			}
+			seen[accommodationID] = true
+			if err := tx.Create(&models.RoleAssignment{
+				UserID:          userID,
+				RoleID:          target.ID,
+				AccommodationID: uint(accommodationID),
+				AssignedBy:      &actorID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		clearStaffCache(userID)
+	}
+	return err
+}
+
+// ListRoleAssignments trả về các vai trò được giao của người dùng
+func ListRoleAssignments(userID uint) ([]models.RoleAssignment, error) {
+	var assignments []models.RoleAssignment
+	err := config.DB.Preload("Role.Permissions").
+		Where("user_id = ?", userID).
+		Order("accommodation_id, role_id").
+		Find(&assignments).Error
+	return assignments, err
+}
+
+func clearAssignedStaffCache(query *gorm.DB) {
+	var userIDs []uint
+	if err := query.Distinct("user_id").Pluck("user_id", &userIDs).Error; err != nil {
+		log.Println("Error loading assigned staff:", err)
+		return
+	}
+	clearStaffCache(userIDs...)
+}
+
+// clearStaffCache xóa cache danh sách theo phạm vi chỗ ở của nhân viên sau khi quyền thay đổi
+func clearStaffCache(userIDs ...uint) {
+	if len(userIDs) == 0 {
+		return
+	}
+	rdb, err := config.ConnectRedis()
+	if err != nil {
+		return
+	}
+	for _, userID := range userIDs {
+		for _, pattern := range []string{
+			"accommodations:receptionist:%d",
+			"rooms:receptionist:%d",
+			"invoices:receptionist:%d",
+			"orders:all:user:%d",
+			"accom_role_3:%d",
+		} {
+			_ = DeleteFromRedis(config.Ctx, rdb, fmt.Sprintf(pattern, userID))
+		}
+	}
+	_ = DeleteFromRedis(config.Ctx, rdb, "user:all")
+}
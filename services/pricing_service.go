@@ -0,0 +1,283 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"new/models"
+
+	"gorm.io/gorm"
+)
+
+// PricingContext chứa thông tin của một lần đặt để các quy tắc giá đánh giá
+type PricingContext struct {
+	Accommodation   models.Accommodation
+	RoomIDs         []uint
+	BasePrice       int
+	CheckInDate     time.Time
+	CheckOutDate    time.Time
+	Nights          int
+	BookedAt        time.Time
+	DiscountPercent float64 // % giảm giá của người dùng, 0 nếu không có
+
+	db        *gorm.DB
+	holidays  []models.Holiday
+	occupancy *float64
+}
+
+// PriceLine là kết quả áp dụng một quy tắc, sẽ được lưu thành OrderPriceItem
+type PriceLine struct {
+	RuleID  *uint   `json:"ruleId,omitempty"`
+	Type    string  `json:"type"`
+	Name    string  `json:"name"`
+	Percent float64 `json:"percent"`
+	Amount  float64 `json:"amount"`
+}
+
+// PricingRuleFunc trả về % cần áp dụng của quy tắc, ok = false nếu quy tắc không khớp với đơn
+type PricingRuleFunc func(rule models.PricingRule, ctx *PricingContext) (percent float64, ok bool, err error)
+
+var pricingRuleFuncs = map[string]PricingRuleFunc{
+	models.RuleOccupancySurge: occupancySurgeRule,
+	models.RuleLastMinute:     lastMinuteRule,
+	models.RuleEarlyBird:      earlyBirdRule,
+	models.RuleLengthOfStay:   lengthOfStayRule,
+	models.RuleHoliday:        holidayRule,
+}
+
+// RegisterPricingRule đăng ký (hoặc thay thế) cách đánh giá cho một loại quy tắc giá
+func RegisterPricingRule(ruleType string, fn PricingRuleFunc) {
+	pricingRuleFuncs[ruleType] = fn
+}
+
+// defaultPricingRules giữ nguyên cách tính cũ cho những loại superadmin chưa cấu hình quy tắc chung:
+// cộng % của các ngày lễ trùng lịch và phụ thu 5% khi nhận phòng trong vòng 3 ngày
+func defaultPricingRules() []models.PricingRule {
+	return []models.PricingRule{
+		{Name: "Phụ thu ngày lễ", Type: models.RuleHoliday, Priority: 10, Status: 1},
+		{Name: "Phụ thu nhận phòng gấp", Type: models.RuleLastMinute, Priority: 20, Threshold: 3, Percent: 5, Status: 1},
+	}
+}
+
+// LoadPricingRules lấy các quy tắc chung và quy tắc riêng của chỗ ở, sắp theo thứ tự áp dụng.
+// Quy tắc mặc định chỉ bị thay khi đã có quy tắc chung cùng loại; tạo quy tắc cùng loại với Status 0 để tắt hẳn.
+func LoadPricingRules(db *gorm.DB, accommodationID uint) ([]models.PricingRule, error) {
+	var configuredRules []models.PricingRule
+	if err := db.Where("accommodation_id IS NULL").Find(&configuredRules).Error; err != nil {
+		return nil, fmt.Errorf("không thể lấy quy tắc giá chung: %w", err)
+	}
+
+	configuredTypes := make(map[string]bool)
+	var globalRules []models.PricingRule
+	for _, rule := range configuredRules {
+		configuredTypes[rule.Type] = true
+		if rule.Status == 1 {
+			globalRules = append(globalRules, rule)
+		}
+	}
+	for _, rule := range defaultPricingRules() {
+		if !configuredTypes[rule.Type] {
+			globalRules = append(globalRules, rule)
+		}
+	}
+
+	var ownRules []models.PricingRule
+	if err := db.Where("accommodation_id = ? AND status = 1", accommodationID).Find(&ownRules).Error; err != nil {
+		return nil, fmt.Errorf("không thể lấy quy tắc giá của chỗ ở: %w", err)
+	}
+
+	rules := append(globalRules, ownRules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority < rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// CalculatePrice áp dụng lần lượt các quy tắc giá rồi tới mã giảm giá, trả về các dòng giá đã áp dụng
+func CalculatePrice(db *gorm.DB, ctx *PricingContext) ([]PriceLine, error) {
+	ctx.db = db
+
+	rules, err := LoadPricingRules(db, ctx.Accommodation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []PriceLine
+	for _, rule := range rules {
+		fn, exists := pricingRuleFuncs[rule.Type]
+		if !exists {
+			continue
+		}
+
+		percent, ok, err := fn(rule, ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok || percent == 0 {
+			continue
+		}
+
+		var ruleID *uint
+		if rule.ID != 0 {
+			id := rule.ID
+			ruleID = &id
+		}
+		lines = append(lines, PriceLine{
+			RuleID:  ruleID,
+			Type:    rule.Type,
+			Name:    rule.Name,
+			Percent: percent,
+			Amount:  float64(ctx.BasePrice) * percent / 100,
+		})
+	}
+
+	if ctx.DiscountPercent > 0 {
+		lines = append(lines, PriceLine{
+			Type:    models.RuleDiscount,
+			Name:    "Mã giảm giá",
+			Percent: -ctx.DiscountPercent,
+			Amount:  -float64(ctx.BasePrice) * ctx.DiscountPercent / 100,
+		})
+	}
+
+	return lines, nil
+}
+
+// SummarizePriceLines gom các dòng giá vào các cột tổng cũ của Order để tương thích với client hiện tại
+func SummarizePriceLines(order *models.Order, lines []PriceLine) {
+	order.HolidayPrice, order.CheckInRushPrice, order.SoldOutPrice, order.DiscountPrice = 0, 0, 0, 0
+	order.PriceItems = nil
+
+	for i, line := range lines {
+		switch line.Type {
+		case models.RuleHoliday:
+			order.HolidayPrice += line.Amount
+		case models.RuleLastMinute:
+			order.CheckInRushPrice += line.Amount
+		case models.RuleOccupancySurge:
+			order.SoldOutPrice += line.Amount
+		default:
+			order.DiscountPrice -= line.Amount
+		}
+
+		order.PriceItems = append(order.PriceItems, models.OrderPriceItem{
+			RuleID:  line.RuleID,
+			Type:    line.Type,
+			Name:    line.Name,
+			Percent: line.Percent,
+			Amount:  line.Amount,
+			Sort:    i,
+		})
+	}
+
+	order.TotalPrice = float64(order.Price) + order.HolidayPrice + order.CheckInRushPrice + order.SoldOutPrice - order.DiscountPrice
+}
+
+func daysToCheckIn(ctx *PricingContext) int {
+	return int(ctx.CheckInDate.Sub(ctx.BookedAt).Hours() / 24)
+}
+
+func lastMinuteRule(rule models.PricingRule, ctx *PricingContext) (float64, bool, error) {
+	return rule.Percent, daysToCheckIn(ctx) <= rule.Threshold, nil
+}
+
+func earlyBirdRule(rule models.PricingRule, ctx *PricingContext) (float64, bool, error) {
+	return rule.Percent, daysToCheckIn(ctx) >= rule.Threshold, nil
+}
+
+func lengthOfStayRule(rule models.PricingRule, ctx *PricingContext) (float64, bool, error) {
+	return rule.Percent, ctx.Nights >= rule.Threshold, nil
+}
+
+func occupancySurgeRule(rule models.PricingRule, ctx *PricingContext) (float64, bool, error) {
+	occupancy, err := ctx.getOccupancy()
+	if err != nil {
+		return 0, false, err
+	}
+	return rule.Percent, occupancy >= float64(rule.Threshold), nil
+}
+
+func holidayRule(rule models.PricingRule, ctx *PricingContext) (float64, bool, error) {
+	if rule.Province != "" && rule.Province != ctx.Accommodation.Province {
+		return 0, false, nil
+	}
+
+	holidays, err := ctx.getHolidays()
+	if err != nil {
+		return 0, false, err
+	}
+
+	total := 0.0
+	matched := false
+	for _, holiday := range holidays {
+		if rule.HolidayID != nil && *rule.HolidayID != holiday.ID {
+			continue
+		}
+
+		fromDate, err := time.Parse("02/01/2006", holiday.FromDate)
+		if err != nil {
+			return 0, false, fmt.Errorf("ngày bắt đầu kỳ nghỉ không hợp lệ: %w", err)
+		}
+		toDate, err := time.Parse("02/01/2006", holiday.ToDate)
+		if err != nil {
+			return 0, false, fmt.Errorf("ngày kết thúc kỳ nghỉ không hợp lệ: %w", err)
+		}
+
+		if (ctx.CheckInDate.Before(toDate) && ctx.CheckOutDate.After(fromDate)) ||
+			ctx.CheckInDate.Equal(fromDate) ||
+			ctx.CheckOutDate.Equal(toDate) {
+			matched = true
+			total += float64(holiday.Price)
+		}
+	}
+
+	// Quy tắc có Percent riêng thì dùng Percent, không thì lấy % cấu hình trên từng ngày lễ
+	if matched && rule.Percent != 0 {
+		return rule.Percent, true, nil
+	}
+	return total, matched, nil
+}
+
+func (ctx *PricingContext) getHolidays() ([]models.Holiday, error) {
+	if ctx.holidays != nil {
+		return ctx.holidays, nil
+	}
+	var holidays []models.Holiday
+	if err := ctx.db.Find(&holidays).Error; err != nil {
+		return nil, fmt.Errorf("không thể lấy thông tin ngày lễ: %w", err)
+	}
+	ctx.holidays = holidays
+	return holidays, nil
+}
+
+// getOccupancy tính % số phòng của chỗ ở đã bị chiếm trong khoảng ngày đặt (chỉ áp dụng cho loại có phòng)
+func (ctx *PricingContext) getOccupancy() (float64, error) {
+	if ctx.occupancy != nil {
+		return *ctx.occupancy, nil
+	}
+
+	occupancy := 0.0
+	var totalRooms int64
+	if err := ctx.db.Model(&models.Room{}).Where("accommodation_id = ?", ctx.Accommodation.ID).Count(&totalRooms).Error; err != nil {
+		return 0, fmt.Errorf("không thể đếm số phòng: %w", err)
+	}
+
+	if totalRooms > 0 {
+		var busyRooms int64
+		if err := ctx.db.Model(&models.RoomStatus{}).
+			Scopes(BlockingStatusScope(ctx.BookedAt)).
+			Where("from_date < ? AND to_date > ?", ctx.CheckOutDate, ctx.CheckInDate).
+			Where("room_id IN (?)", ctx.db.Model(&models.Room{}).Select("room_id").Where("accommodation_id = ?", ctx.Accommodation.ID)).
+			Distinct("room_id").Count(&busyRooms).Error; err != nil {
+			return 0, fmt.Errorf("không thể tính tỉ lệ lấp đầy: %w", err)
+		}
+		occupancy = float64(busyRooms) * 100 / float64(totalRooms)
+	}
+
+	ctx.occupancy = &occupancy
+	return occupancy, nil
+}
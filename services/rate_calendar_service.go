@@ -0,0 +1,122 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"new/models"
+
+	"gorm.io/gorm"
+)
+
+// Nguồn của giá một đêm, theo thứ tự ưu tiên tăng dần
+const (
+	RateSourceBase     = "base"
+	RateSourceWeekend  = "weekend"
+	RateSourceSeason   = "season"
+	RateSourceOverride = "override"
+)
+
+// RateTarget là đối tượng cần tính giá: một phòng hoặc cả chỗ ở
+type RateTarget struct {
+	RoomID          uint
+	AccommodationID uint
+	Price           int
+	WeekendPrice    int
+}
+
+// NightPrice là giá của một đêm trên lịch giá
+type NightPrice struct {
+	Date   string `json:"date"`
+	Price  int    `json:"price"`
+	Source string `json:"source"`
+}
+
+func RoomRateTarget(room models.Room) RateTarget {
+	return RateTarget{RoomID: room.RoomId, Price: room.Price, WeekendPrice: room.WeekendPrice}
+}
+
+func AccommodationRateTarget(accommodation models.Accommodation) RateTarget {
+	return RateTarget{AccommodationID: accommodation.ID, Price: accommodation.Price, WeekendPrice: accommodation.WeekendPrice}
+}
+
+func (t RateTarget) scope(db *gorm.DB) *gorm.DB {
+	if t.RoomID != 0 {
+		return db.Where("room_id = ?", t.RoomID)
+	}
+	return db.Where("accommodation_id = ?", t.AccommodationID)
+}
+
+// calendarDay chuẩn hóa về 0h UTC theo ngày/tháng/năm để so sánh ngày không lệch múi giờ
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func isWeekendNight(day time.Time) bool {
+	return day.Weekday() == time.Friday || day.Weekday() == time.Saturday
+}
+
+// NightlyPrices trả về giá từng đêm trong khoảng [from, to): ghi đè theo ngày > giá theo mùa > giá cuối tuần > giá gốc
+func NightlyPrices(db *gorm.DB, target RateTarget, from, to time.Time) ([]NightPrice, error) {
+	from, to = calendarDay(from), calendarDay(to)
+	if !to.After(from) {
+		return []NightPrice{}, nil
+	}
+
+	var overrides []models.DailyRate
+	if err := target.scope(db.Model(&models.DailyRate{})).
+		Where("date >= ? AND date < ?", from, to).
+		Find(&overrides).Error; err != nil {
+		return nil, fmt.Errorf("không thể lấy giá theo ngày: %w", err)
+	}
+
+	var seasons []models.SeasonalRate
+	if err := target.scope(db.Model(&models.SeasonalRate{})).
+		Where("from_date < ? AND to_date >= ?", to, from).
+		Order("id DESC").
+		Find(&seasons).Error; err != nil {
+		return nil, fmt.Errorf("không thể lấy giá theo mùa: %w", err)
+	}
+
+	overrideMap := make(map[time.Time]int)
+	for _, override := range overrides {
+		overrideMap[calendarDay(override.Date.UTC())] = override.Price
+	}
+
+	prices := make([]NightPrice, 0)
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		night := NightPrice{Date: day.Format("02/01/2006"), Price: target.Price, Source: RateSourceBase}
+		if isWeekendNight(day) && target.WeekendPrice > 0 {
+			night.Price, night.Source = target.WeekendPrice, RateSourceWeekend
+		}
+
+		// Mùa tạo sau được ưu tiên khi các mùa chồng lên nhau
+		for _, season := range seasons {
+			if day.Before(calendarDay(season.FromDate.UTC())) || day.After(calendarDay(season.ToDate.UTC())) {
+				continue
+			}
+			night.Price, night.Source = season.Price, RateSourceSeason
+			if isWeekendNight(day) && season.WeekendPrice > 0 {
+				night.Price = season.WeekendPrice
+			}
+			break
+		}
+
+		if price, exists := overrideMap[day]; exists {
+			night.Price, night.Source = price, RateSourceOverride
+		}
+
+		prices = append(prices, night)
+	}
+
+	return prices, nil
+}
+
+// SumNightlyPrices cộng giá tất cả các đêm
+func SumNightlyPrices(prices []NightPrice) int {
+	total := 0
+	for _, night := range prices {
+		total += night.Price
+	}
+	return total
+}
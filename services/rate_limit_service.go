@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Số lần đăng nhập sai liên tiếp trước khi tạm khóa tài khoản
+	LoginMaxFailures = 5
+	LoginFailWindow  = 15 * time.Minute
+	LoginLockout     = 15 * time.Minute
+)
+
+var rateLimitRedis *redis.Client
+
+// InitRateLimiter dùng Redis client chung của ứng dụng cho giới hạn request và khóa đăng nhập.
+// Chưa khởi tạo (hoặc Redis lỗi) thì mọi request đều được cho qua.
+func InitRateLimiter(rdb *redis.Client) {
+	rateLimitRedis = rdb
+}
+
+// slidingWindowScript đếm request trong cửa sổ trượt bằng sorted set (score = thời điểm, ms).
+// Trả về {được phép (1/0), số request trong cửa sổ, số ms phải chờ}.
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, 0, now - window)
+local count = redis.call('ZCARD', key)
+if count >= limit then
+	local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+	local retry = window
+	if oldest[2] then
+		retry = tonumber(oldest[2]) + window - now
+	end
+	return {0, count, retry}
+end
+
+redis.call('ZADD', key, now, member)
+redis.call('PEXPIRE', key, window)
+return {1, count + 1, 0}
+`)
+
+// AllowRequest ghi nhận một request vào key và cho biết còn trong giới hạn limit/window không.
+// retryAfter là thời gian cần chờ khi bị chặn.
+func AllowRequest(ctx context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	if rateLimitRedis == nil {
+		return true, 0, nil
+	}
+
+	now := time.Now()
+	member := strconv.FormatInt(now.UnixNano(), 10)
+	result, err := slidingWindowScript.Run(ctx, rateLimitRedis, []string{"ratelimit:" + key},
+		now.UnixMilli(), window.Milliseconds(), limit, member).Int64Slice()
+	if err != nil {
+		log.Println("❌ Lỗi giới hạn request, bỏ qua:", err)
+		return true, 0, err
+	}
+
+	if result[0] == 1 {
+		return true, 0, nil
+	}
+	return false, time.Duration(result[2]) * time.Millisecond, nil
+}
+
+func loginKey(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// LoginLockedFor trả về thời gian còn bị khóa đăng nhập của identifier (0 nếu không bị khóa)
+func LoginLockedFor(ctx context.Context, identifier string) time.Duration {
+	if rateLimitRedis == nil {
+		return 0
+	}
+	ttl, err := rateLimitRedis.TTL(ctx, "login:lock:"+loginKey(identifier)).Result()
+	if err != nil || ttl <= 0 {
+		return 0
+	}
+	return ttl
+}
+
+// RecordLoginFailure đếm lần đăng nhập sai; đủ LoginMaxFailures lần trong LoginFailWindow thì khóa LoginLockout.
+// Trả về thời gian khóa nếu vừa bị khóa.
+func RecordLoginFailure(ctx context.Context, identifier string) time.Duration {
+	if rateLimitRedis == nil {
+		return 0
+	}
+	key := loginKey(identifier)
+
+	failures, err := rateLimitRedis.Incr(ctx, "login:fail:"+key).Result()
+	if err != nil {
+		return 0
+	}
+	if failures == 1 {
+		rateLimitRedis.Expire(ctx, "login:fail:"+key, LoginFailWindow)
+	}
+	if failures < LoginMaxFailures {
+		return 0
+	}
+
+	rateLimitRedis.Set(ctx, "login:lock:"+key, failures, LoginLockout)
+	rateLimitRedis.Del(ctx, "login:fail:"+key)
+	log.Printf("⚠️ Tạm khóa đăng nhập %s sau %d lần sai\n", key, failures)
+	return LoginLockout
+}
+
+// ResetLoginFailures xóa bộ đếm đăng nhập sai sau khi đăng nhập thành công
+func ResetLoginFailures(ctx context.Context, identifier string) {
+	if rateLimitRedis == nil {
+		return
+	}
+	rateLimitRedis.Del(ctx, "login:fail:"+loginKey(identifier))
+}
+
+// RetryAfterSeconds làm tròn lên số giây cho header Retry-After
+func RetryAfterSeconds(d time.Duration) string {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return fmt.Sprintf("%d", seconds)
+}
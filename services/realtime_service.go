@@ -0,0 +1,207 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"new/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/olahol/melody"
+)
+
+// Các loại sự kiện gửi qua WebSocket
+const (
+	EventNotification = "notification.created" // Thông báo mới trong hộp thư, Data là models.Notification
+	EventTest         = "system.test"          // Tin thử từ superadmin
+)
+
+// Khóa lưu thông tin người dùng trên mỗi phiên WebSocket
+const (
+	wsKeyUserID         = "userID"
+	wsKeyRole           = "role"
+	wsKeySessionID      = "sessionID"
+	wsKeyAccommodations = "accommodationIDs"
+)
+
+// Event là phong bì JSON của mọi tin gửi qua WebSocket: client dựa vào Type để xử lý Data
+type Event struct {
+	Type   string      `json:"type"`
+	Data   interface{} `json:"data,omitempty"`
+	SentAt time.Time   `json:"sentAt"`
+}
+
+var realtime *melody.Melody
+
+// websocketOrigins là các Origin trình duyệt được phép mở /ws
+var websocketOrigins []string
+
+func configureRealtime(cfg *config.AppConfig) {
+	websocketOrigins = nil
+	for _, origin := range cfg.WebSocketOrigins {
+		websocketOrigins = append(websocketOrigins, strings.TrimRight(origin, "/"))
+	}
+}
+
+// checkWebSocketOrigin chặn trang web lạ mở /ws bằng cookie access_token của người dùng.
+// Client không phải trình duyệt không gửi Origin (và cũng không tự gửi cookie) nên vẫn được kết nối.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range websocketOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// ConfigureRealtime gắn Melody dùng cho /ws để các service gửi thông báo
+func ConfigureRealtime(m *melody.Melody) {
+	m.Upgrader.CheckOrigin = checkWebSocketOrigin
+	realtime = m
+}
+
+// websocketToken lấy access token khi mở WebSocket: trình duyệt không đặt được header cho WebSocket
+// nên nhận thêm từ cookie access_token. Không nhận từ query vì access log ghi lại cả query string.
+func websocketToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	if cookie, err := c.Cookie("access_token"); err == nil {
+		return cookie
+	}
+	return ""
+}
+
+// ServeWebSocket xác thực JWT và phiên đăng nhập rồi mở WebSocket, gắn user, role và các chỗ ở
+// người dùng quản lý vào phiên để gửi thông báo đúng người nhận.
+// Lỗi trả về là lỗi xác thực trước khi nâng cấp kết nối, người gọi trả 401.
+func ServeWebSocket(c *gin.Context) error {
+	if realtime == nil {
+		return errors.New("chưa cấu hình WebSocket")
+	}
+
+	token := websocketToken(c)
+	if token == "" {
+		return ErrMissingToken
+	}
+	claims, err := ParseAccessToken(token)
+	if err != nil {
+		return err
+	}
+	userID, role := claims.UserInfo.UserId, claims.UserInfo.Role
+	if err := ValidateSession(userID, claims.SessionID, c.ClientIP()); err != nil {
+		return err
+	}
+
+	accommodations := map[uint]struct{}{}
+	if role != 1 {
+		var ids []uint
+		if err := PermittedAccommodations(userID, PermAccommodationView).Pluck("id", &ids).Error; err != nil {
+			log.Println("❌ Lỗi lấy chỗ ở cho WebSocket:", err)
+			return ErrSessionCheckFailed
+		}
+		for _, id := range ids {
+			accommodations[id] = struct{}{}
+		}
+	}
+
+	err = realtime.HandleRequestWithKeys(c.Writer, c.Request, map[string]interface{}{
+		wsKeyUserID:         userID,
+		wsKeyRole:           role,
+		wsKeySessionID:      claims.SessionID,
+		wsKeyAccommodations: accommodations,
+	})
+	if err != nil {
+		log.Printf("❌ Lỗi WebSocket của user %d: %v", userID, err)
+	}
+	return nil
+}
+
+// notify gửi sự kiện tới các phiên WebSocket thỏa match
+func notify(eventType string, data interface{}, match func(*melody.Session) bool) error {
+	if realtime == nil {
+		return nil
+	}
+
+	message, err := json.Marshal(Event{Type: eventType, Data: data, SentAt: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := realtime.BroadcastFilter(message, match); err != nil && !errors.Is(err, melody.ErrClosed) {
+		log.Printf("❌ Lỗi gửi sự kiện %s qua WebSocket: %v", eventType, err)
+		return err
+	}
+	return nil
+}
+
+// NotifyUser gửi sự kiện tới mọi phiên đang kết nối của một người dùng
+func NotifyUser(userID uint, eventType string, data interface{}) error {
+	return notify(eventType, data, func(s *melody.Session) bool {
+		id, ok := s.Get(wsKeyUserID)
+		return ok && id.(uint) == userID
+	})
+}
+
+// NotifyRole gửi sự kiện tới mọi người dùng có role (0 user, 1 superadmin, 2 admin, 3 lễ tân)
+func NotifyRole(role int, eventType string, data interface{}) error {
+	return notify(eventType, data, func(s *melody.Session) bool {
+		r, ok := s.Get(wsKeyRole)
+		return ok && r.(int) == role
+	})
+}
+
+// NotifyAccommodation gửi sự kiện tới những người đang theo dõi một chỗ ở (chủ và nhân viên được giao)
+func NotifyAccommodation(accommodationID uint, eventType string, data interface{}) error {
+	return notify(eventType, data, func(s *melody.Session) bool {
+		ids, ok := s.Get(wsKeyAccommodations)
+		if !ok {
+			return false
+		}
+		_, watching := ids.(map[uint]struct{})[accommodationID]
+		return watching
+	})
+}
+
+// disconnect đóng các kết nối WebSocket thỏa match
+func disconnect(match func(*melody.Session) bool) {
+	if realtime == nil {
+		return
+	}
+	sessions, err := realtime.Sessions()
+	if err != nil {
+		return
+	}
+	for _, s := range sessions {
+		if match(s) {
+			s.Close()
+		}
+	}
+}
+
+// disconnectSession đóng các WebSocket mở bằng phiên đăng nhập vừa bị thu hồi
+func disconnectSession(sessionID string) {
+	disconnect(func(s *melody.Session) bool {
+		id, ok := s.Get(wsKeySessionID)
+		return ok && id.(string) == sessionID
+	})
+}
+
+// disconnectUser đóng mọi WebSocket của người dùng trừ các kết nối của phiên exceptSessionID (rỗng: đóng tất cả)
+func disconnectUser(userID uint, exceptSessionID string) {
+	disconnect(func(s *melody.Session) bool {
+		id, ok := s.Get(wsKeyUserID)
+		if !ok || id.(uint) != userID {
+			return false
+		}
+		sessionID, _ := s.Get(wsKeySessionID)
+		return exceptSessionID == "" || sessionID != exceptSessionID
+	})
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var ErrRefreshTokenReused = errors.New("Refresh token đã được sử dụng, toàn bộ phiên đăng nhập đã bị thu hồi")
+
+// TokenPair là cặp token trả về khi đăng nhập hoặc làm mới
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // Số giây còn hiệu lực của access token
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashTokenID(jti string) string {
+	sum := sha256.Sum256([]byte(jti))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueTokenPair ký access token và refresh token mới thuộc familyID, lưu refresh token trong transaction tx.
+// familyID cũng là mã phiên, được ghi vào access token để middleware kiểm tra phiên còn hiệu lực.
+func issueTokenPair(tx *gorm.DB, userInfo UserInfo, familyID, userAgent, ip string) (TokenPair, *models.RefreshToken, error) {
+	now := time.Now()
+	accessToken, err := signClaims(&Claims{
+		UserInfo:  userInfo,
+		SessionID: familyID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+		},
+	}, true)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+
+	jti, err := randomHex(32)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    userInfo.UserId,
+		FamilyID:  familyID,
+		TokenHash: hashTokenID(jti),
+		ExpiresAt: now.Add(RefreshTokenTTL),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return TokenPair{}, nil, fmt.Errorf("không thể lưu refresh token: %w", err)
+	}
+
+	refreshToken, err := signClaims(&Claims{
+		UserInfo: userInfo,
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: record.ExpiresAt.Unix(),
+		},
+	}, false)
+	if err != nil {
+		return TokenPair{}, nil, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(AccessTokenTTL / time.Second),
+	}, &record, nil
+}
+
+// IssueTokenPair phát hành cặp token cho một lần đăng nhập mới: tạo phiên và họ refresh token mới
+func IssueTokenPair(userInfo UserInfo, userAgent, ip string) (TokenPair, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	var pair TokenPair
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := createSession(tx, userInfo.UserId, familyID, userAgent, ip); err != nil {
+			return fmt.Errorf("không thể tạo phiên đăng nhập: %w", err)
+		}
+		issued, _, err := issueTokenPair(tx, userInfo, familyID, userAgent, ip)
+		pair = issued
+		return err
+	})
+	return pair, err
+}
+
+// RotateRefreshToken đổi refresh token lấy cặp token mới. Token cũ chỉ dùng được một lần:
+// dùng lại token đã xoay bị coi là token bị lộ, phiên và cả họ token của lần đăng nhập đó bị thu hồi.
+func RotateRefreshToken(refreshToken, userAgent, ip string) (TokenPair, error) {
+	claims, err := ParseToken(refreshToken, false)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if claims.Id == "" {
+		return TokenPair{}, ErrInvalidToken
+	}
+
+	var pair TokenPair
+	var rejectErr error
+	var disconnectRevoked func()
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashTokenID(claims.Id)).
+			First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if current.RevokedAt != nil || current.ExpiresAt.Before(time.Now()) {
+			return ErrInvalidToken
+		}
+		if current.RotatedAt != nil {
+			rejectErr = ErrRefreshTokenReused
+			log.Printf("⚠️ Refresh token của user %d bị dùng lại, thu hồi họ token %s\n", current.UserID, current.FamilyID)
+			disconnectRevoked = func() { disconnectSession(current.FamilyID) }
+			return revokeSession(tx, current.FamilyID, "reused", nil)
+		}
+
+		// Lấy lại role và trạng thái từ DB để token mới phản ánh thay đổi quyền hoặc khóa tài khoản
+		var user models.User
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			return ErrInvalidToken
+		}
+		if user.Status == 1 {
+			rejectErr = ErrInvalidToken
+			disconnectRevoked = func() { disconnectUser(user.ID, "") }
+			_, err := revokeUserSessions(tx, user.ID, "", "banned", nil)
+			return err
+		}
+
+		if err := refreshSession(tx, user.ID, current.FamilyID, userAgent, ip); err != nil {
+			return err
+		}
+
+		issued, next, err := issueTokenPair(tx, UserInfo{UserId: user.ID, Role: user.Role}, current.FamilyID, userAgent, ip)
+		if err != nil {
+			return err
+		}
+		pair = issued
+
+		now := time.Now()
+		return tx.Model(&current).Updates(map[string]interface{}{
+			"rotated_at":     now,
+			"replaced_by_id": next.ID,
+		}).Error
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+	// Việc thu hồi đã được lưu, sau đó mới đóng WebSocket của các phiên bị thu hồi và từ chối yêu cầu
+	if disconnectRevoked != nil {
+		disconnectRevoked()
+	}
+	if rejectErr != nil {
+		return TokenPair{}, rejectErr
+	}
+	return pair, nil
+}
+
+func revokeTokens(query *gorm.DB, reason string) error {
+	return query.Model(&models.RefreshToken{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason}).Error
+}
+
+// RevokeRefreshToken thu hồi phiên đăng nhập (cả họ token) của refresh token, dùng khi đăng xuất
+func RevokeRefreshToken(refreshToken string) (uint, error) {
+	claims, err := ParseToken(refreshToken, false)
+	if err != nil {
+		return 0, err
+	}
+
+	var current models.RefreshToken
+	if err := config.DB.Where("token_hash = ?", hashTokenID(claims.Id)).First(&current).Error; err != nil {
+		return 0, ErrInvalidToken
+	}
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return revokeSession(tx, current.FamilyID, "logout", nil)
+	})
+	if err == nil {
+		disconnectSession(current.FamilyID)
+	}
+	return current.UserID, err
+}
+
+// RevokeUserTokens thu hồi mọi phiên đăng nhập của user (đăng xuất tất cả, đổi mật khẩu, khóa tài khoản)
+func RevokeUserTokens(userID uint, reason string) error {
+	if _, err := RevokeUserSessions(userID, "", reason, nil); err != nil {
+		return fmt.Errorf("không thể thu hồi phiên đăng nhập: %w", err)
+	}
+	return nil
+}
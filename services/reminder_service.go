@@ -0,0 +1,203 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrUnsubscribeLinkInvalid = errors.New("Liên kết hủy đăng ký không hợp lệ")
+
+// reviewRequestWindow: đơn trả phòng trong khoảng này (tính đến hôm qua) mà chưa được mời đánh giá
+// vẫn được gửi, để job bị dừng vài ngày chạy lại vẫn gửi bù
+const reviewRequestWindow = 7
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UnsubscribeToken ký địa chỉ email bằng HMAC để liên kết hủy đăng ký trong email dùng được mà không cần đăng nhập
+func UnsubscribeToken(email string) string {
+	mac := hmac.New(sha256.New, otpSecret)
+	mac.Write([]byte("unsubscribe:" + normalizeEmail(email)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func unsubscribeURL(email string) string {
+	return fmt.Sprintf("%s/unsubscribe?email=%s&token=%s", frontendURL, url.QueryEscape(email), UnsubscribeToken(email))
+}
+
+func isEmailOptedOut(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Model(&models.EmailOptOut{}).Where("email = ?", normalizeEmail(email)).Count(&count).Error
+	return count > 0, err
+}
+
+// IsEmailOptedOut cho biết email đã từ chối nhận email nhắc lịch và mời đánh giá hay chưa
+func IsEmailOptedOut(email string) (bool, error) {
+	return isEmailOptedOut(config.DB, email)
+}
+
+// SetEmailOptOut bật (optOut = true) hoặc tắt việc từ chối nhận email nhắc lịch và mời đánh giá
+func SetEmailOptOut(email string, optOut bool) error {
+	email = normalizeEmail(email)
+	if email == "" {
+		return errors.New("email không hợp lệ")
+	}
+	if optOut {
+		return config.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.EmailOptOut{Email: email}).Error
+	}
+	return config.DB.Where("email = ?", email).Delete(&models.EmailOptOut{}).Error
+}
+
+// UnsubscribeEmail xử lý liên kết hủy đăng ký trong email nhắc lịch
+func UnsubscribeEmail(email, token string) error {
+	if normalizeEmail(email) == "" || !hmac.Equal([]byte(token), []byte(UnsubscribeToken(email))) {
+		return ErrUnsubscribeLinkInvalid
+	}
+	return SetEmailOptOut(email, true)
+}
+
+// reminderJob mô tả một loại email nhắc: chọn đơn theo filter, dựng dữ liệu cho mẫu email bằng data
+type reminderJob struct {
+	kind     string
+	template string
+	filter   func(query *gorm.DB) *gorm.DB
+	data     func(order models.Order) map[string]interface{}
+}
+
+// runReminderJob xếp hàng email nhắc cho các đơn thỏa filter và chưa được nhắc loại này
+func runReminderJob(job reminderJob) {
+	var orders []models.Order
+	query := config.DB.Preload("User").Preload("Accommodation").
+		Where("NOT EXISTS (SELECT 1 FROM guest_reminders WHERE guest_reminders.order_id = orders.id AND guest_reminders.kind = ?)", job.kind)
+	if err := job.filter(query).Find(&orders).Error; err != nil {
+		log.Printf("❌ Lỗi khi lấy đơn cần gửi nhắc %s: %v", job.kind, err)
+		return
+	}
+
+	queued := 0
+	for _, order := range orders {
+		ok, err := queueGuestReminder(job, order)
+		if err != nil {
+			log.Printf("❌ Lỗi khi xếp email nhắc %s cho đơn %d: %v", job.kind, order.ID, err)
+			continue
+		}
+		if ok {
+			queued++
+		}
+	}
+	if queued > 0 {
+		log.Printf("✅ Đã xếp %d email nhắc %s", queued, job.kind)
+	}
+}
+
+// queueGuestReminder ghi nhận nhắc (OrderID, Kind) và xếp email trong cùng transaction.
+// Nếu bản ghi đã có (job khác hoặc lần chạy trước đã xử lý) thì không gửi lại;
+// khách đã từ chối nhận hoặc không có email thì chỉ ghi nhận là bỏ qua.
+func queueGuestReminder(job reminderJob, order models.Order) (bool, error) {
+	email, name := order.GuestEmail, order.GuestName
+	if order.User != nil && order.User.Email != "" {
+		email, name = order.User.Email, order.User.Name
+	}
+	if name == "" {
+		name = "bạn"
+	}
+
+	queued := false
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		optedOut, err := isEmailOptedOut(tx, email)
+		if err != nil {
+			return err
+		}
+
+		reminder := models.GuestReminder{
+			OrderID: order.ID,
+			Kind:    job.kind,
+			Email:   email,
+			Skipped: email == "" || optedOut,
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 || reminder.Skipped {
+			return nil
+		}
+
+		data := job.data(order)
+		data["Name"] = name
+		data["UnsubscribeURL"] = unsubscribeURL(email)
+		if err := queueTemplatedEmail(tx, email, job.template, data); err != nil {
+			return err
+		}
+		queued = true
+		return nil
+	})
+	return queued, err
+}
+
+// SendGuestReminders gửi email nhắc nhận phòng cho đơn nhận phòng ngày mai và mời đánh giá cho đơn
+// đã trả phòng, được cron gọi mỗi giờ trong ngày; gọi nhiều lần không gửi trùng
+func SendGuestReminders() {
+	loc, err := time.LoadLocation("Asia/Ho_Chi_Minh")
+	if err != nil {
+		log.Println("❌ Lỗi khi tải múi giờ:", err)
+		return
+	}
+	today := time.Now().In(loc)
+	layout := "02/01/2006"
+
+	// Nhắc trước ngày nhận phòng: đơn đang giữ chỗ hoặc đã xác nhận
+	runReminderJob(reminderJob{
+		kind:     models.ReminderCheckIn,
+		template: "checkin_reminder",
+		filter: func(query *gorm.DB) *gorm.DB {
+			return query.Where("check_in_date = ? AND status IN ?", today.AddDate(0, 0, 1).Format(layout), []int{0, 1})
+		},
+		data: func(order models.Order) map[string]interface{} {
+			return map[string]interface{}{
+				"OrderID":           order.ID,
+				"AccommodationName": order.Accommodation.Name,
+				"Address":           order.Accommodation.Address,
+				"TimeCheckIn":       order.Accommodation.TimeCheckIn,
+				"CheckInDate":       order.CheckInDate,
+				"CheckOutDate":      order.CheckOutDate,
+			}
+		},
+	})
+
+	// Mời đánh giá sau ngày trả phòng: chỉ đơn đã xác nhận của khách có tài khoản (POST /rates cần userId).
+	// Liên kết mở trang đánh giá của frontend, trang này gửi POST /rates với chỗ ở và đơn tương ứng.
+	runReminderJob(reminderJob{
+		kind:     models.ReminderReview,
+		template: "review_request",
+		filter: func(query *gorm.DB) *gorm.DB {
+			return query.Where("status = ? AND user_id IS NOT NULL", 1).
+				Where("to_date(check_out_date, 'DD/MM/YYYY') BETWEEN ? AND ?",
+					today.AddDate(0, 0, -reviewRequestWindow).Format("2006-01-02"),
+					today.AddDate(0, 0, -1).Format("2006-01-02"))
+		},
+		data: func(order models.Order) map[string]interface{} {
+			return map[string]interface{}{
+				"AccommodationName": order.Accommodation.Name,
+				"CheckInDate":       order.CheckInDate,
+				"CheckOutDate":      order.CheckOutDate,
+				"RateURL": fmt.Sprintf("%s/rates?accommodationId=%d&orderId=%d",
+					frontendURL, order.AccommodationID, order.ID),
+			}
+		},
+	})
+}
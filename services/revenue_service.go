@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevenueDay chuẩn hóa thời điểm về 0h của ngày theo giờ địa phương, đúng khóa ngày của UserRevenue
+func RevenueDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// AddUserRevenue cộng (hoặc trừ nếu âm) doanh thu và số đơn vào ngày của admin, tạo dòng mới nếu ngày đó chưa có
+func AddUserRevenue(tx *gorm.DB, userID uint, date time.Time, amount float64, orderCount int) error {
+	day := RevenueDay(date)
+	initialCount := orderCount
+	if initialCount < 0 {
+		initialCount = 0
+	}
+
+	revenue := models.UserRevenue{UserID: userID, Date: day, Revenue: amount, OrderCount: initialCount}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"revenue":     gorm.Expr("user_revenues.revenue + ?", amount),
+			"order_count": gorm.Expr("GREATEST(user_revenues.order_count + ?, 0)", orderCount),
+			"updated_at":  time.Now(),
+		}),
+	}).Create(&revenue).Error; err != nil {
+		return fmt.Errorf("không thể cập nhật doanh thu người dùng: %w", err)
+	}
+	return nil
+}
+
+// AdjustInvoiceRevenue ghi phần điều chỉnh doanh thu của một hóa đơn lập ngày invoiceDate.
+// Doanh thu của các ngày trước hôm nay đã (hoặc sắp) được UpdateUserAmounts cộng vào số dư, nên phần tiền
+// điều chỉnh được ghi vào hôm nay để lần chuyển số dư kế tiếp cộng/trừ đúng cho admin; số đơn vẫn tính trên ngày lập hóa đơn.
+func AdjustInvoiceRevenue(tx *gorm.DB, userID uint, invoiceDate time.Time, amount float64, orderCount int) error {
+	now := time.Now()
+	if !RevenueDay(invoiceDate).Before(RevenueDay(now)) {
+		return AddUserRevenue(tx, userID, invoiceDate, amount, orderCount)
+	}
+	if orderCount != 0 {
+		if err := AddUserRevenue(tx, userID, invoiceDate, 0, orderCount); err != nil {
+			return err
+		}
+	}
+	return AddUserRevenue(tx, userID, now, amount, 0)
+}
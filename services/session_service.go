@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSessionRevoked     = errors.New("Phiên đăng nhập đã hết hiệu lực, vui lòng đăng nhập lại")
+	ErrSessionNotFound    = errors.New("Không tìm thấy phiên đăng nhập")
+	ErrSessionCheckFailed = errors.New("Không thể kiểm tra phiên đăng nhập")
+)
+
+// sessionTouchInterval: LastSeenAt chỉ được ghi lại khi lần ghi trước cũ hơn khoảng này,
+// tránh mỗi request đều phải update DB
+const sessionTouchInterval = time.Minute
+
+// deviceFromUserAgent đoán tên thiết bị (hệ điều hành - trình duyệt) từ User-Agent để hiển thị
+func deviceFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Không rõ"
+	}
+
+	platform := ""
+	switch {
+	case strings.Contains(ua, "iphone"):
+		platform = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		platform = "iPad"
+	case strings.Contains(ua, "android"):
+		platform = "Android"
+	case strings.Contains(ua, "windows"):
+		platform = "Windows"
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		platform = "macOS"
+	case strings.Contains(ua, "linux"):
+		platform = "Linux"
+	}
+
+	browser := ""
+	switch {
+	case strings.Contains(ua, "edg/"):
+		browser = "Edge"
+	case strings.Contains(ua, "opr/"), strings.Contains(ua, "opera"):
+		browser = "Opera"
+	case strings.Contains(ua, "chrome/"), strings.Contains(ua, "crios/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "firefox/"), strings.Contains(ua, "fxios/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "safari/"):
+		browser = "Safari"
+	}
+
+	switch {
+	case platform != "" && browser != "":
+		return platform + " - " + browser
+	case platform != "":
+		return platform
+	case browser != "":
+		return browser
+	}
+	return "Không rõ"
+}
+
+// createSession lưu phiên cho một lần đăng nhập mới, sessionID cũng là FamilyID của refresh token
+func createSession(tx *gorm.DB, userID uint, sessionID, userAgent, ip string) error {
+	now := time.Now()
+	return tx.Create(&models.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		Device:     deviceFromUserAgent(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}).Error
+}
+
+// refreshSession gia hạn phiên khi refresh token được xoay. Họ token phát hành trước khi có
+// bảng phiên chưa có bản ghi nên được tạo mới tại đây, người dùng không phải đăng nhập lại.
+func refreshSession(tx *gorm.DB, userID uint, sessionID, userAgent, ip string) error {
+	now := time.Now()
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"ip", "last_seen_at", "expires_at"}),
+	}).Create(&models.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		Device:     deviceFromUserAgent(userAgent),
+		UserAgent:  userAgent,
+		IP:         ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}).Error
+}
+
+// ValidateSession kiểm tra phiên của access token còn hiệu lực và cập nhật lần hoạt động cuối.
+// Token không mang mã phiên (phát hành trước khi có phiên) bị từ chối để có thể thu hồi được.
+func ValidateSession(userID uint, sessionID, ip string) error {
+	if sessionID == "" {
+		return ErrSessionRevoked
+	}
+
+	var session models.Session
+	if err := config.DB.Select("id", "revoked_at", "expires_at", "last_seen_at", "ip").
+		Where("id = ? AND user_id = ?", sessionID, userID).
+		First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		log.Println("Error loading session:", err)
+		return ErrSessionCheckFailed
+	}
+
+	now := time.Now()
+	if session.RevokedAt != nil || session.ExpiresAt.Before(now) {
+		return ErrSessionRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval || session.IP != ip {
+		if err := config.DB.Model(&models.Session{}).Where("id = ?", sessionID).
+			Updates(map[string]interface{}{"last_seen_at": now, "ip": ip}).Error; err != nil {
+			log.Println("Error updating session last seen:", err)
+		}
+	}
+	return nil
+}
+
+// ListSessions trả về các phiên còn hiệu lực của người dùng, mới hoạt động nhất trước
+func ListSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := config.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func revokeSessionRows(query *gorm.DB, reason string, revokedBy *uint) *gorm.DB {
+	return query.Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_reason": reason, "revoked_by": revokedBy})
+}
+
+// revokeSession thu hồi một phiên cùng họ refresh token của nó
+func revokeSession(tx *gorm.DB, sessionID, reason string, revokedBy *uint) error {
+	if err := revokeSessionRows(tx.Where("id = ?", sessionID), reason, revokedBy).Error; err != nil {
+		return err
+	}
+	return revokeTokens(tx.Where("family_id = ?", sessionID), reason)
+}
+
+// revokeUserSessions thu hồi mọi phiên của người dùng trừ exceptSessionID (rỗng: thu hồi tất cả),
+// trả về số phiên đã thu hồi
+func revokeUserSessions(tx *gorm.DB, userID uint, exceptSessionID, reason string, revokedBy *uint) (int64, error) {
+	sessions := tx.Where("user_id = ?", userID)
+	tokens := tx.Where("user_id = ?", userID)
+	if exceptSessionID != "" {
+		sessions = sessions.Where("id <> ?", exceptSessionID)
+		tokens = tokens.Where("family_id <> ?", exceptSessionID)
+	}
+
+	result := revokeSessionRows(sessions, reason, revokedBy)
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, revokeTokens(tokens, reason)
+}
+
+// RevokeSession thu hồi một phiên của người dùng; revokedBy là người thực hiện nếu không phải chính chủ.
+// Các WebSocket mở bằng phiên này bị đóng sau khi thu hồi.
+func RevokeSession(userID uint, sessionID, reason string, revokedBy *uint) error {
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		result := revokeSessionRows(tx.Where("id = ? AND user_id = ?", sessionID, userID), reason, revokedBy)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionNotFound
+		}
+		return revokeTokens(tx.Where("family_id = ?", sessionID), reason)
+	})
+	if err == nil {
+		disconnectSession(sessionID)
+	}
+	return err
+}
+
+// RevokeUserSessions thu hồi mọi phiên của người dùng trừ exceptSessionID, trả về số phiên đã thu hồi
+func RevokeUserSessions(userID uint, exceptSessionID, reason string, revokedBy *uint) (int64, error) {
+	var revoked int64
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		count, err := revokeUserSessions(tx, userID, exceptSessionID, reason, revokedBy)
+		revoked = count
+		return err
+	})
+	if err == nil {
+		disconnectUser(userID, exceptSessionID)
+	}
+	return revoked, err
+}
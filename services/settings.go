@@ -0,0 +1,15 @@
+package services
+
+import "new/config"
+
+// Configure truyền cấu hình đã nạp khi khởi động cho các service, thay cho việc tự đọc biến môi trường
+func Configure(cfg *config.AppConfig) {
+	configureTokens(cfg.JWT)
+	configureOTP(cfg.Security)
+	configureTwoFactor(cfg.Security)
+	configureMail(cfg)
+	configureRealtime(cfg)
+	configureOutbox(cfg.Mail)
+	configureBooking(cfg.Booking)
+	InitPaymentProviders(cfg.Payment)
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"net/url"
+	"time"
+
+	"new/config"
+)
+
+var (
+	payoutConfig config.PayoutConfig
+	frontendURL  = "https://trothalo.click"
+)
+
+func configureMail(cfg *config.AppConfig) {
+	payoutConfig = cfg.Payout
+	if cfg.FrontendURL != "" {
+		frontendURL = cfg.FrontendURL
+	}
+
+	from := cfg.SMTP.From
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+	switch cfg.Mail.Backend {
+	case config.MailBackendFile:
+		mailer = &FileMailer{Path: cfg.Mail.FilePath, From: from}
+		log.Println("📧 Email được ghi vào", cfg.Mail.FilePath, "thay vì gửi đi")
+	case config.MailBackendMemory:
+		mailer = &MemoryMailer{From: from}
+		log.Println("📧 Email chỉ được giữ trong bộ nhớ, không gửi đi")
+	default:
+		mailer = &SMTPMailer{Config: cfg.SMTP}
+	}
+}
+
+// SMTPMailer gửi email qua máy chủ SMTP (STARTTLS, đăng nhập PLAIN) bằng tài khoản trong cấu hình
+type SMTPMailer struct {
+	Config config.SMTPConfig
+}
+
+func (m *SMTPMailer) Send(email Email) error {
+	if !m.Config.Configured() {
+		return errors.New("chưa cấu hình SMTP, không thể gửi email")
+	}
+
+	message, err := buildMessage(m.Config.From, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", m.Config.Username, m.Config.Password.Value(), m.Config.Host)
+	return smtp.SendMail(fmt.Sprintf("%s:%d", m.Config.Host, m.Config.Port), auth, envelopeAddress(m.Config.From), email.To, message)
+}
+
+// PayoutQRCodeURL tạo ảnh VietQR chuyển khoản số tiền amount vào tài khoản nhận phí của hệ thống
+func PayoutQRCodeURL(amount int) string {
+	return fmt.Sprintf("https://img.vietqr.io/image/%s-%s-compact.jpg?amount=%d&addInfo=%s",
+		url.PathEscape(payoutConfig.BankCode), url.PathEscape(payoutConfig.AccountNumber), amount,
+		url.QueryEscape("Chuyen khoan phi"))
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"new/config"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrMissingToken = errors.New("Authorization header is missing")
+	ErrInvalidToken = errors.New("Invalid token")
+	ErrExpiredToken = errors.New("Token đã hết hạn")
+)
+
+// ClaimsContextKey là key lưu claims đã xác thực trong gin.Context
+const ClaimsContextKey = "claims"
+
+// tokenKeyRing giữ khóa ký hiện tại và các khóa cũ còn được chấp nhận khi xác thực (xoay vòng khóa qua header kid)
+type tokenKeyRing struct {
+	currentKID string
+	keys       map[string][]byte
+}
+
+var (
+	accessKeys  tokenKeyRing
+	refreshKeys tokenKeyRing
+)
+
+// newKeyRing tạo bộ khóa từ khóa hiện tại và các khóa cũ dạng "kid:secret,kid:secret"
+func newKeyRing(currentKID string, secret, previous config.Secret) tokenKeyRing {
+	ring := tokenKeyRing{currentKID: currentKID, keys: map[string][]byte{}}
+	if ring.currentKID == "" {
+		ring.currentKID = "default"
+	}
+	if secret != "" {
+		ring.keys[ring.currentKID] = []byte(secret.Value())
+	} else {
+		log.Println("⚠️ Thiếu khóa ký token, không thể ký hoặc xác thực token")
+	}
+
+	for _, entry := range strings.Split(previous.Value(), ",") {
+		kid, key, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || kid == "" || key == "" || kid == ring.currentKID {
+			continue
+		}
+		ring.keys[kid] = []byte(key)
+	}
+	return ring
+}
+
+func configureTokens(cfg config.JWTConfig) {
+	accessKeys = newKeyRing(cfg.AccessKID, cfg.AccessSecret, cfg.AccessPreviousKeys)
+	refreshKeys = newKeyRing(cfg.RefreshKID, cfg.RefreshSecret, cfg.RefreshPreviousKeys)
+}
+
+func tokenKeys(isAccessToken bool) tokenKeyRing {
+	if isAccessToken {
+		return accessKeys
+	}
+	return refreshKeys
+}
+
+// signClaims ký claims bằng HS256 với khóa hiện tại, ghi kid vào header
+func signClaims(claims *Claims, isAccessToken bool) (string, error) {
+	ring := tokenKeys(isAccessToken)
+	key, exists := ring.keys[ring.currentKID]
+	if !exists {
+		return "", errors.New("chưa cấu hình khóa ký token")
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ring.currentKID
+
+	return token.SignedString(key)
+}
+
+// ParseToken xác thực chữ ký HS256 theo kid và hạn của token, trả về claims.
+// Token không có kid (phát hành trước khi có xoay vòng khóa) được kiểm tra bằng khóa hiện tại.
+func ParseToken(tokenString string, isAccessToken bool) (*Claims, error) {
+	ring := tokenKeys(isAccessToken)
+	parser := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Alg()}}
+
+	claims := &Claims{}
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			kid = ring.currentKID
+		}
+		key, exists := ring.keys[kid]
+		if !exists {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		return key, nil
+	})
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+			return nil, ErrExpiredToken
+		}
+		return nil, ErrInvalidToken
+	}
+
+	// StandardClaims bỏ qua exp = 0, nhưng token của hệ thống luôn phải có hạn
+	if !token.Valid || claims.ExpiresAt == 0 || claims.UserInfo.UserId == 0 {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	return ParseToken(tokenString, true)
+}
+
+// AuthenticateRequest trả về claims của request: lấy từ context nếu middleware đã xác thực,
+// ngược lại xác thực header Authorization và phiên của token rồi lưu vào context cho các lần gọi sau
+func AuthenticateRequest(c *gin.Context) (*Claims, error) {
+	if value, exists := c.Get(ClaimsContextKey); exists {
+		if claims, ok := value.(*Claims); ok {
+			return claims, nil
+		}
+	}
+
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims, err := ParseAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateSession(claims.UserInfo.UserId, claims.SessionID, c.ClientIP()); err != nil {
+		return nil, err
+	}
+
+	c.Set(ClaimsContextKey, claims)
+	c.Set("currentUserID", claims.UserInfo.UserId)
+	c.Set("currentUserRole", claims.UserInfo.Role)
+	return claims, nil
+}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("Tài khoản chưa bật xác thực hai lớp")
+	ErrTwoFactorAlreadyEnabled = errors.New("Tài khoản đã bật xác thực hai lớp")
+	ErrTwoFactorNotSetup       = errors.New("Chưa khởi tạo xác thực hai lớp, vui lòng tạo mã bí mật trước")
+	ErrTwoFactorInvalidCode    = errors.New("Mã xác thực hai lớp không hợp lệ")
+	ErrTwoFactorRequired       = errors.New("Vai trò của bạn bắt buộc bật xác thực hai lớp")
+	ErrTwoFactorChallenge      = errors.New("Phiên xác thực hai lớp không hợp lệ hoặc đã hết hạn, vui lòng đăng nhập lại")
+)
+
+const (
+	totpPeriod = 30 // giây
+	totpDigits = 6
+	totpSkew   = 1 // chấp nhận lệch một bước (±30 giây) do đồng hồ thiết bị
+
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type twoFactorSettings struct {
+	requiredRoles map[int]bool
+	issuer        string
+	key           []byte
+}
+
+var twoFactorConfig = twoFactorSettings{requiredRoles: map[int]bool{}, issuer: "Trothalo"}
+
+// configureTwoFactor nhận cấu hình 2FA; TwoFactorRequiredRoles rỗng thì 2FA là tùy chọn với mọi role
+func configureTwoFactor(cfg config.SecurityConfig) {
+	settings := twoFactorSettings{requiredRoles: map[int]bool{}, issuer: cfg.TOTPIssuer}
+	if settings.issuer == "" {
+		settings.issuer = "Trothalo"
+	}
+	for _, role := range cfg.TwoFactorRequiredRoles {
+		settings.requiredRoles[role] = true
+	}
+	key := sha256.Sum256([]byte(cfg.TOTPEncryptionKey.Value()))
+	settings.key = key[:]
+
+	twoFactorConfig = settings
+}
+
+// TwoFactorRequired cho biết role có bắt buộc xác thực hai lớp không
+func TwoFactorRequired(role int) bool {
+	return twoFactorConfig.requiredRoles[role]
+}
+
+func encryptTOTPSecret(secret string) (string, error) {
+	block, err := aes.NewCipher(twoFactorConfig.key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func decryptTOTPSecret(encrypted string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(twoFactorConfig.key)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("mã bí mật 2FA không hợp lệ")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("không thể giải mã mã bí mật 2FA: %w", err)
+	}
+	return string(plain), nil
+}
+
+// totpAt tính mã TOTP (HMAC-SHA1, 6 số) tại bước thời gian step theo RFC 6238
+func totpAt(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// matchTOTP trả về bước thời gian khớp với code, bỏ qua các bước đã dùng (<= lastStep) để mã không bị dùng lại
+func matchTOTP(secretBase32, code string, lastStep int64, now time.Time) (int64, bool) {
+	secret, err := totpEncoding.DecodeString(strings.ToUpper(secretBase32))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for delta := -totpSkew; delta <= totpSkew; delta++ {
+		step := current + int64(delta)
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpAt(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+func normalizeSecondFactorCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// OtpauthURI tạo URI otpauth:// để ứng dụng xác thực quét QR
+func OtpauthURI(account, secret string) string {
+	issuer := twoFactorConfig.issuer
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", strconv.Itoa(totpDigits))
+	query.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + query.Encode()
+}
+
+func twoFactorAccount(user models.User) string {
+	if user.Email != "" {
+		return user.Email
+	}
+	return user.PhoneNumber
+}
+
+// TwoFactorEnabled cho biết người dùng đã bật xác thực hai lớp chưa
+func TwoFactorEnabled(userID uint) bool {
+	var count int64
+	config.DB.Model(&models.TwoFactor{}).Where("user_id = ? AND enabled = ?", userID, true).Count(&count)
+	return count > 0
+}
+
+// TwoFactorStatus trả về trạng thái 2FA và số mã khôi phục chưa dùng
+func TwoFactorStatus(userID uint) (bool, int64, error) {
+	var recoveryLeft int64
+	if err := config.DB.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&recoveryLeft).Error; err != nil {
+		return false, 0, err
+	}
+	return TwoFactorEnabled(userID), recoveryLeft, nil
+}
+
+// beginTwoFactorSetup tạo mã bí mật mới (chưa bật) cho người dùng.
+// reusePending giữ mã bí mật đang chờ xác nhận để người dùng không phải quét lại QR.
+func beginTwoFactorSetup(user models.User, reusePending bool) (string, string, error) {
+	var secret string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var record models.TwoFactor
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", user.ID).First(&record).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		exists := err == nil
+		if exists && record.Enabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		if exists && reusePending {
+			if pending, err := decryptTOTPSecret(record.SecretEncrypted); err == nil {
+				secret = pending
+				return nil
+			}
+		}
+
+		raw := make([]byte, 20)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		secret = totpEncoding.EncodeToString(raw)
+		encrypted, err := encryptTOTPSecret(secret)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return tx.Model(&record).Updates(map[string]interface{}{
+				"secret_encrypted": encrypted,
+				"last_used_step":   0,
+			}).Error
+		}
+		return tx.Create(&models.TwoFactor{UserID: user.ID, SecretEncrypted: encrypted}).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return secret, OtpauthURI(twoFactorAccount(user), secret), nil
+}
+
+// BeginTwoFactorSetup tạo mã bí mật và URI otpauth; 2FA chỉ bật sau khi EnableTwoFactor xác nhận mã đầu tiên
+func BeginTwoFactorSetup(user models.User) (string, string, error) {
+	return beginTwoFactorSetup(user, false)
+}
+
+// replaceRecoveryCodes hủy các mã khôi phục cũ và tạo bộ mới, trả về mã gốc để hiển thị một lần
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, RecoveryCodeCount)
+	records := make([]models.TwoFactorRecoveryCode, 0, RecoveryCodeCount)
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw, err := randomHex(5)
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		records = append(records, models.TwoFactorRecoveryCode{
+			UserID:   userID,
+			CodeHash: hashOTP(userID, "recovery", raw),
+		})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnableTwoFactor bật 2FA khi code khớp mã bí mật đang chờ, trả về các mã khôi phục
+func EnableTwoFactor(userID uint, code string) ([]string, error) {
+	var recoveryCodes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var record models.TwoFactor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&record).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTwoFactorNotSetup
+			}
+			return err
+		}
+		if record.Enabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		secret, err := decryptTOTPSecret(record.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, normalizeSecondFactorCode(code), record.LastUsedStep, time.Now())
+		if !ok {
+			return ErrTwoFactorInvalidCode
+		}
+
+		now := time.Now()
+		if err := tx.Model(&record).Updates(map[string]interface{}{
+			"enabled":        true,
+			"enabled_at":     now,
+			"last_used_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		recoveryCodes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// verifySecondFactor kiểm tra mã TOTP hoặc mã khôi phục (mỗi mã khôi phục chỉ dùng được một lần)
+func verifySecondFactor(tx *gorm.DB, userID uint, code string) error {
+	var record models.TwoFactor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id = ? AND enabled = ?", userID, true).
+		First(&record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+
+	code = normalizeSecondFactorCode(code)
+	if isTOTPCode(code) {
+		secret, err := decryptTOTPSecret(record.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, code, record.LastUsedStep, time.Now())
+		if !ok {
+			return ErrTwoFactorInvalidCode
+		}
+		return tx.Model(&record).Update("last_used_step", step).Error
+	}
+
+	result := tx.Model(&models.TwoFactorRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashOTP(userID, "recovery", code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	return nil
+}
+
+// VerifySecondFactor kiểm tra mã TOTP hoặc mã khôi phục của người dùng đã bật 2FA
+func VerifySecondFactor(userID uint, code string) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, userID, code)
+	})
+}
+
+// DisableTwoFactor tắt 2FA sau khi xác thực mã; role bắt buộc 2FA thì không được tắt
+func DisableTwoFactor(userID uint, role int, code string) error {
+	if TwoFactorRequired(role) {
+		return ErrTwoFactorRequired
+	}
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TwoFactorRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes tạo bộ mã khôi phục mới sau khi xác thực mã, các mã cũ hết hiệu lực
+func RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var recoveryCodes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+		var err error
+		recoveryCodes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+// TwoFactorChallenge là phản hồi "chờ xác thực hai lớp" của đăng nhập, thay cho access token.
+// SetupRequired: role bắt buộc 2FA nhưng người dùng chưa đăng ký, kèm mã bí mật để đăng ký ngay.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+	ExpiresIn         int64  `json:"expiresIn"`
+	SetupRequired     bool   `json:"setupRequired"`
+	Secret            string `json:"secret,omitempty"`
+	OtpauthURI        string `json:"otpauthUri,omitempty"`
+}
+
+// NeedsTwoFactor cho biết lần đăng nhập của user phải qua bước xác thực thứ hai không
+func NeedsTwoFactor(user models.User) bool {
+	return TwoFactorRequired(user.Role) || TwoFactorEnabled(user.ID)
+}
+
+// StartTwoFactorChallenge tạo challenge ngắn hạn, dùng một lần cho bước xác thực thứ hai.
+// Challenge được lưu trong kho mã dùng một lần (mục đích login) nên có hạn và giới hạn số lần thử.
+func StartTwoFactorChallenge(user models.User) (TwoFactorChallenge, error) {
+	token, err := IssueOTPToken(user.ID, models.OTPPurposeLogin)
+	if err != nil {
+		return TwoFactorChallenge{}, err
+	}
+
+	challenge := TwoFactorChallenge{
+		TwoFactorRequired: true,
+		Challenge:         fmt.Sprintf("%d.%s", user.ID, token),
+		ExpiresIn:         int64(otpTTL[models.OTPPurposeLogin] / time.Second),
+	}
+	if !TwoFactorEnabled(user.ID) {
+		secret, uri, err := beginTwoFactorSetup(user, true)
+		if err != nil {
+			return TwoFactorChallenge{}, err
+		}
+		challenge.SetupRequired = true
+		challenge.Secret = secret
+		challenge.OtpauthURI = uri
+	}
+	return challenge, nil
+}
+
+// CompleteTwoFactorChallenge xác thực challenge và mã thứ hai, trả về người dùng để phát hành token.
+// Nếu người dùng đang đăng ký bắt buộc thì mã đầu tiên đồng thời bật 2FA và trả về mã khôi phục.
+func CompleteTwoFactorChallenge(challenge, code string) (models.User, []string, error) {
+	idPart, token, found := strings.Cut(challenge, ".")
+	userID, err := strconv.ParseUint(idPart, 10, 64)
+	if !found || err != nil || token == "" {
+		return models.User{}, nil, ErrTwoFactorChallenge
+	}
+
+	var recoveryCodes []string
+	err = ConsumeOTPWithFactor(uint(userID), models.OTPPurposeLogin, token, func() error {
+		if TwoFactorEnabled(uint(userID)) {
+			return VerifySecondFactor(uint(userID), code)
+		}
+		codes, err := EnableTwoFactor(uint(userID), code)
+		recoveryCodes = codes
+		return err
+	})
+	if errors.Is(err, ErrOTPInvalid) || errors.Is(err, ErrOTPExpired) {
+		return models.User{}, nil, ErrTwoFactorChallenge
+	}
+	if err != nil {
+		return models.User{}, nil, err
+	}
+
+	var user models.User
+	if err := config.DB.Preload("Banks").First(&user, userID).Error; err != nil {
+		return models.User{}, nil, ErrTwoFactorChallenge
+	}
+	return user, recoveryCodes, nil
+}
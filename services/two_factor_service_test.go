@@ -0,0 +1,149 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"new/config"
+	"new/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// setupTwoFactorDB mở SQLite tạm với bảng 2FA và khóa mã hóa mã bí mật cố định
+func setupTwoFactorDB(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("không mở được SQLite: %v", err)
+	}
+	if err := db.AutoMigrate(&models.TwoFactor{}, &models.TwoFactorRecoveryCode{}); err != nil {
+		t.Fatalf("không tạo được bảng: %v", err)
+	}
+
+	previousDB, previousConfig := config.DB, twoFactorConfig
+	config.DB = db
+	twoFactorConfig.key = []byte("0123456789abcdef0123456789abcdef")
+	t.Cleanup(func() {
+		config.DB = previousDB
+		twoFactorConfig = previousConfig
+	})
+}
+
+// enableTestTwoFactor lưu mã bí mật đã bật 2FA cho userID, trả về mã bí mật dạng base32
+func enableTestTwoFactor(t *testing.T, userID uint) string {
+	t.Helper()
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	encrypted, err := encryptTOTPSecret(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := models.TwoFactor{UserID: userID, SecretEncrypted: encrypted, Enabled: true}
+	if err := config.DB.Create(&record).Error; err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// Bộ mã thử SHA1 của RFC 6238 (phụ lục B), lấy 6 chữ số cuối của mã 8 chữ số
+func TestTOTPMatchesRFC6238Vectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpAt(secret, tt.unix/totpPeriod); got != tt.code {
+			t.Errorf("totpAt(T=%d) = %s, muốn %s", tt.unix, got, tt.code)
+		}
+
+		now := time.Unix(tt.unix, 0)
+		if step, ok := matchTOTP(totpEncoding.EncodeToString(secret), tt.code, 0, now); !ok || step != tt.unix/totpPeriod {
+			t.Errorf("matchTOTP(T=%d) = (%d, %v), muốn (%d, true)", tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestMatchTOTPRejectsUsedStep(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+	code := totpAt([]byte("12345678901234567890"), now.Unix()/totpPeriod)
+
+	step, ok := matchTOTP(secret, code, 0, now)
+	if !ok {
+		t.Fatal("mã hợp lệ bị từ chối")
+	}
+	if _, ok := matchTOTP(secret, code, step, now); ok {
+		t.Fatal("mã của bước đã dùng vẫn được chấp nhận")
+	}
+	// Mã của bước trước vẫn trong độ lệch cho phép nhưng không được dùng lại sau khi bước mới đã dùng
+	if _, ok := matchTOTP(secret, code, step, now.Add(totpPeriod*time.Second)); ok {
+		t.Fatal("mã cũ được chấp nhận sau khi đã dùng bước mới hơn")
+	}
+}
+
+func TestVerifySecondFactorRejectsReplay(t *testing.T) {
+	setupTwoFactorDB(t)
+	secret := enableTestTwoFactor(t, 1)
+
+	raw, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totpAt(raw, time.Now().Unix()/totpPeriod)
+
+	if err := VerifySecondFactor(1, code); err != nil {
+		t.Fatalf("lần đầu: %v", err)
+	}
+	if err := VerifySecondFactor(1, code); !errors.Is(err, ErrTwoFactorInvalidCode) {
+		t.Fatalf("dùng lại mã trong cùng bước: err = %v, muốn %v", err, ErrTwoFactorInvalidCode)
+	}
+}
+
+func TestVerifySecondFactorRecoveryCodeSingleUse(t *testing.T) {
+	setupTwoFactorDB(t)
+	enableTestTwoFactor(t, 1)
+
+	var codes []string
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, 1)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || !strings.Contains(codes[0], "-") {
+		t.Fatalf("mã khôi phục không đúng định dạng: %v", codes)
+	}
+
+	// Mã có gạch ngang chỉ dùng được một lần, nhập lại không gạch ngang cũng bị từ chối
+	if err := VerifySecondFactor(1, codes[0]); err != nil {
+		t.Fatalf("mã khôi phục có gạch ngang: %v", err)
+	}
+	if err := VerifySecondFactor(1, strings.ReplaceAll(codes[0], "-", "")); !errors.Is(err, ErrTwoFactorInvalidCode) {
+		t.Fatalf("dùng lại mã khôi phục: err = %v, muốn %v", err, ErrTwoFactorInvalidCode)
+	}
+
+	// Mã nhập không gạch ngang, viết hoa vẫn được chấp nhận một lần
+	second := strings.ToUpper(strings.ReplaceAll(codes[1], "-", ""))
+	if err := VerifySecondFactor(1, second); err != nil {
+		t.Fatalf("mã khôi phục không gạch ngang: %v", err)
+	}
+	if err := VerifySecondFactor(1, codes[1]); !errors.Is(err, ErrTwoFactorInvalidCode) {
+		t.Fatalf("dùng lại mã khôi phục: err = %v, muốn %v", err, ErrTwoFactorInvalidCode)
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"new/config"
 	"new/models"
 
-	"github.com/olahol/melody"
 	"gorm.io/gorm"
 )
 
@@ -33,7 +32,7 @@ func GetTodayUserRevenue() ([]models.UserRevenue, error) {
 }
 
 // UpdateUserAmounts cập nhật amount của user dựa trên revenue hôm nay
-func UpdateUserAmounts(m *melody.Melody) error {
+func UpdateUserAmounts() error {
 	db := config.DB
 
 	revenues, err := GetTodayUserRevenue()
@@ -49,6 +48,7 @@ func UpdateUserAmounts(m *melody.Melody) error {
 
 	// Bắt đầu transaction
 	tx := db.Begin()
+	var notifications []models.Notification
 
 	for _, rev := range revenues {
 		adjustedRevenue := rev.Revenue * 0.7
@@ -62,12 +62,27 @@ func UpdateUserAmounts(m *melody.Melody) error {
 		}
 		log.Printf("✅ Cập nhật thành công user_id %d: +%.2f\n", rev.UserID, rev.Revenue)
 
-		//thông báo
-		message := fmt.Sprintf("🔔 User %d đã được cộng %.2f vào tài khoản.", rev.UserID, rev.Revenue)
-		m.Broadcast([]byte(message))
+		//thông báo cho chính chủ tài khoản
+		created, err := CreateNotifications(tx, []uint{rev.UserID}, NotificationInput{
+			Type:    NotificationBalanceCredited,
+			Title:   "Số dư được cộng",
+			Body:    fmt.Sprintf("Doanh thu ngày %s: %.2f đã được cộng vào tài khoản.", rev.Date.Format("02/01/2006"), adjustedRevenue),
+			Payload: map[string]interface{}{"amount": adjustedRevenue, "date": rev.Date},
+		})
+		if err != nil {
+			tx.Rollback()
+			log.Printf("❌ Lỗi tạo thông báo cho user %d: %v\n", rev.UserID, err)
+			return err
+		}
+		notifications = append(notifications, created...)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		log.Println("❌ Lỗi commit cập nhật amount:", err)
+		return err
 	}
 
-	tx.Commit()
+	PublishNotifications(notifications)
 
 	log.Println("✅ Hoàn tất cập nhật amount cho tất cả users.")
 	return nil